@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// client calls the /api endpoints of the server
+type client struct {
+	server string
+	http   *http.Client
+}
+
+func newClient(server string) *client {
+	return &client{
+		server: strings.TrimSuffix(server, "/"),
+		http:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// resp is the envelope of the responses
+type resp struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// call posts req as JSON to the api and decodes the data into result if not nil
+func (c *client) call(api string, req interface{}, result interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpResp, err := c.http.Post(c.server+"/api/"+api, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	var r resp
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("%s: %s: %s", api, httpResp.Status, strings.TrimSpace(string(data)))
+	}
+	if r.Code != 0 {
+		return fmt.Errorf("%s: %s", api, r.Msg)
+	}
+	if result == nil || len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, result)
+}
+
+func (c *client) LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error) {
+	var tasks []*model.TaskItem
+	if err := c.call("listTasks", map[string]interface{}{"mode": mode}, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (c *client) AddTask(task *model.TaskItem) (*model.TaskItem, error) {
+	added := &model.TaskItem{}
+	if err := c.call("addTask", task, added); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (c *client) AddTaskNote(taskID int64, note string) error {
+	return c.call("addTaskNote", map[string]interface{}{"taskID": taskID, "note": note}, nil)
+}
+
+// MoveTask moves through a batch, there is no single endpoint for it
+func (c *client) MoveTask(taskID int64, parentID int64, index int) error {
+	_, err := c.Batch([]*model.BatchOperation{{
+		Op:       model.BatchOpMove,
+		TaskID:   taskID,
+		ParentID: parentID,
+		Index:    &index,
+	}})
+	return err
+}
+
+func (c *client) Batch(ops []*model.BatchOperation) ([]*model.BatchResult, error) {
+	var result struct {
+		Results []*model.BatchResult `json:"results"`
+	}
+	if err := c.call("batch", map[string]interface{}{"operations": ops}, &result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/flatten"
+	"github.com/xhd2015/task-banner/server/service/task/query"
+)
+
+// loadTask loads all tasks and finds the task with id
+func loadTask(b backend, id int64) (*model.TaskItem, error) {
+	tasks, err := b.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	t := model.FindTask(tasks, id)
+	if t == nil {
+		return nil, fmt.Errorf("%w: %d", task.ErrTaskNotFound, id)
+	}
+	return t, nil
+}
+
+func runAdd(opts *globalOptions, args []string) error {
+	var parent string
+	var mode string
+	var words []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if args[i] == "--parent" || args[i] == "--mode" {
+			if i+1 >= n {
+				return fmt.Errorf("%v requires arg", args[i])
+			}
+			if args[i] == "--parent" {
+				parent = args[i+1]
+			} else {
+				mode = args[i+1]
+			}
+			i++
+			continue
+		}
+		if args[i] == "--" {
+			words = append(words, args[i+1:]...)
+			break
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		words = append(words, args[i])
+	}
+	title := strings.TrimSpace(strings.Join(words, " "))
+	if title == "" {
+		return fmt.Errorf("requires title")
+	}
+	b := opts.backend()
+	newTask := &model.TaskItem{
+		Title:     title,
+		StartTime: model.ToSwiftTimestamp(time.Now()),
+		Status:    model.TaskStatusCreated,
+		SubTasks:  []*model.TaskItem{},
+		Notes:     []string{},
+	}
+	if parent != "" {
+		parentID, err := parseTaskID(parent)
+		if err != nil {
+			return err
+		}
+		if parentID != 0 {
+			p, err := loadTask(b, parentID)
+			if err != nil {
+				return err
+			}
+			newTask.ParentID = parentID
+			// subtasks show up in the mode of their parent
+			newTask.Mode = p.Mode
+		}
+	}
+	if mode != "" {
+		newTask.Mode = loadMode(mode)
+	} else if newTask.ParentID == 0 {
+		active, err := activeMode()
+		if err != nil {
+			return err
+		}
+		newTask.Mode = loadMode(active)
+	}
+	added, err := b.AddTask(newTask)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(added)
+	}
+	fmt.Printf("added %s\n", formatTask(added, false))
+	return nil
+}
+
+func runLs(opts *globalOptions, args []string) error {
+	var mode string
+	var all bool
+	var status string
+	var queryStr string
+	var depth int
+	var flat bool
+	var root string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		switch args[i] {
+		case "--help", "-h":
+			fmt.Println(strings.TrimSpace(lsHelp))
+			return nil
+		case "--all":
+			all = true
+			continue
+		case "--flat":
+			flat = true
+			continue
+		case "--mode", "--status", "-q", "--query", "--depth":
+			if i+1 >= n {
+				return fmt.Errorf("%v requires arg", args[i])
+			}
+			value := args[i+1]
+			switch args[i] {
+			case "--mode":
+				mode = value
+			case "--status":
+				status = value
+			case "--depth":
+				d, err := strconv.Atoi(value)
+				if err != nil || d < 1 {
+					return fmt.Errorf("invalid depth: %s", value)
+				}
+				depth = d
+			default:
+				queryStr = value
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		if root != "" {
+			return fmt.Errorf("unrecognized arg: %v", args[i])
+		}
+		root = args[i]
+	}
+	if status != "" {
+		queryStr = strings.TrimSpace(queryStr + " status:" + status)
+	}
+	q, err := query.Parse(queryStr)
+	if err != nil {
+		return err
+	}
+	if all {
+		mode = modeAll
+	}
+	if mode == "" {
+		mode, err = activeMode()
+		if err != nil {
+			return err
+		}
+	}
+
+	b := opts.backend()
+	var tasks []*model.TaskItem
+	if root != "" {
+		rootID, err := parseTaskID(root)
+		if err != nil {
+			return err
+		}
+		t, err := loadTask(b, rootID)
+		if err != nil {
+			return err
+		}
+		tasks = []*model.TaskItem{t}
+		// the mode of a subtree is that of its root
+		mode = modeAll
+	} else {
+		tasks, err = b.LoadTasks(loadMode(mode))
+		if err != nil {
+			return err
+		}
+	}
+
+	showMode := mode == modeAll
+	if flat {
+		rows := flatten.Flatten(tasks, q)
+		if opts.json {
+			flatTasks := make([]*model.TaskItem, 0, len(rows))
+			for _, row := range rows {
+				cl := row.Task.ShallowClone()
+				cl.SubTasks = []*model.TaskItem{}
+				flatTasks = append(flatTasks, cl)
+			}
+			return printJSON(flatTasks)
+		}
+		for _, row := range rows {
+			path := strings.Join(row.Path, flatten.PathSeparator)
+			if path != "" {
+				path += flatten.PathSeparator
+			}
+			fmt.Printf("%s\n", formatTaskTitle(row.Task, path+row.Task.Title, showMode))
+		}
+		return nil
+	}
+	filtered := query.Apply(tasks, &query.Options{Query: q, Result: query.ResultTree})
+	if depth > 0 {
+		filtered = limitDepth(filtered, depth)
+	}
+	if opts.json {
+		return printJSON(filtered)
+	}
+	model.WalkTasks(filtered, func(t *model.TaskItem, d int) bool {
+		fmt.Printf("%s%s\n", strings.Repeat("  ", d), formatTask(t, showMode))
+		return true
+	})
+	return nil
+}
+
+// limitDepth copies the tree down to depth levels
+func limitDepth(tasks []*model.TaskItem, depth int) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0, len(tasks))
+	for _, t := range tasks {
+		cl := t.ShallowClone()
+		if depth > 1 {
+			cl.SubTasks = limitDepth(t.SubTasks, depth-1)
+		} else {
+			cl.SubTasks = []*model.TaskItem{}
+		}
+		result = append(result, cl)
+	}
+	return result
+}
+
+// formatTask formats a task as one line, e.g.
+//
+//	#12 [x] (A) deploy prod  due 2026-10-20  2 notes
+func formatTask(t *model.TaskItem, showMode bool) string {
+	return formatTaskTitle(t, t.Title, showMode)
+}
+
+func formatTaskTitle(t *model.TaskItem, title string, showMode bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#%d %s ", t.ID, statusMark(t.Status))
+	if t.Priority != "" {
+		fmt.Fprintf(&sb, "(%s) ", t.Priority)
+	}
+	sb.WriteString(title)
+	if showMode && t.Mode != "" {
+		fmt.Fprintf(&sb, "  @%s", t.Mode)
+	}
+	if t.DueTime != 0 {
+		fmt.Fprintf(&sb, "  due %s", model.ConvertSwiftTimestamp(t.DueTime).Local().Format("2006-01-02"))
+	}
+	switch len(t.Notes) {
+	case 0:
+	case 1:
+		sb.WriteString("  1 note")
+	default:
+		fmt.Fprintf(&sb, "  %d notes", len(t.Notes))
+	}
+	return sb.String()
+}
+
+func statusMark(status model.TaskStatus) string {
+	switch status {
+	case model.TaskStatusDone:
+		return "[x]"
+	case model.TaskStatusArchived:
+		return "[-]"
+	}
+	return "[ ]"
+}
+
+// parseIDs parses the task ids of args, handling global flags
+// and the boolean flags of the command
+func parseIDs(opts *globalOptions, args []string, flags map[string]*bool) ([]int64, error) {
+	var ids []int64
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return nil, err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if flag, ok := flags[args[i]]; ok {
+			*flag = true
+			continue
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return nil, fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		id, err := parseTaskID(args[i])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("requires task id")
+	}
+	return ids, nil
+}
+
+func runDone(opts *globalOptions, args []string) error {
+	ids, err := parseIDs(opts, args, nil)
+	if err != nil {
+		return err
+	}
+	b := opts.backend()
+	status := string(model.TaskStatusDone)
+	ops := make([]*model.BatchOperation, 0, len(ids))
+	for _, id := range ids {
+		ops = append(ops, &model.BatchOperation{Op: model.BatchOpUpdate, TaskID: id, Update: &model.TaskUpdate{Status: &status}})
+	}
+	if _, err := b.Batch(ops); err != nil {
+		return err
+	}
+	tasks, err := b.LoadTasks("")
+	if err != nil {
+		return err
+	}
+	updated := make([]*model.TaskItem, 0, len(ids))
+	for _, id := range ids {
+		t := model.FindTask(tasks, id)
+		if t == nil {
+			return fmt.Errorf("%w: %d", task.ErrTaskNotFound, id)
+		}
+		updated = append(updated, t)
+	}
+	if opts.json {
+		return printJSON(updated)
+	}
+	for _, t := range updated {
+		fmt.Printf("done %s\n", formatTask(t, false))
+	}
+	return nil
+}
+
+func runNote(opts *globalOptions, args []string) error {
+	var words []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if args[i] == "--" {
+			words = append(words, args[i+1:]...)
+			break
+		}
+		words = append(words, args[i])
+	}
+	if len(words) < 2 {
+		return fmt.Errorf("usage: note ID TEXT")
+	}
+	id, err := parseTaskID(words[0])
+	if err != nil {
+		return err
+	}
+	note := strings.TrimSpace(strings.Join(words[1:], " "))
+	if note == "" {
+		return fmt.Errorf("requires note text")
+	}
+	b := opts.backend()
+	if err := b.AddTaskNote(id, note); err != nil {
+		return err
+	}
+	t, err := loadTask(b, id)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(t)
+	}
+	fmt.Printf("noted %s\n", formatTask(t, false))
+	return nil
+}
+
+func runMv(opts *globalOptions, args []string) error {
+	index := -1
+	var positional []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if args[i] == "--index" {
+			if i+1 >= n {
+				return fmt.Errorf("%v requires arg", args[i])
+			}
+			index, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return fmt.Errorf("invalid index: %s", args[i+1])
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		positional = append(positional, args[i])
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: mv ID PARENT [--index N]")
+	}
+	id, err := parseTaskID(positional[0])
+	if err != nil {
+		return err
+	}
+	parentID, err := parseTaskID(positional[1])
+	if err != nil {
+		return err
+	}
+	b := opts.backend()
+	if err := b.MoveTask(id, parentID, index); err != nil {
+		return err
+	}
+	t, err := loadTask(b, id)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(t)
+	}
+	fmt.Printf("moved %s\n", formatTask(t, false))
+	return nil
+}
+
+func runRm(opts *globalOptions, args []string) error {
+	var force bool
+	ids, err := parseIDs(opts, args, map[string]*bool{"--force": &force, "-f": &force})
+	if err != nil {
+		return err
+	}
+	b := opts.backend()
+	tasks, err := b.LoadTasks("")
+	if err != nil {
+		return err
+	}
+	var given []*model.TaskItem
+	for _, id := range ids {
+		t := model.FindTask(tasks, id)
+		if t == nil {
+			return fmt.Errorf("%w: %d", task.ErrTaskNotFound, id)
+		}
+		if len(t.SubTasks) > 0 && !force {
+			return fmt.Errorf("#%d has subtasks, use --force to remove them too", id)
+		}
+		given = append(given, t)
+	}
+	// tasks within the subtree of another one go with it
+	var removing []*model.TaskItem
+	var ops []*model.BatchOperation
+	for i, t := range given {
+		if within(given, i) {
+			continue
+		}
+		removing = append(removing, t)
+		ops = append(ops, &model.BatchOperation{Op: model.BatchOpRemove, TaskID: t.ID})
+	}
+	if _, err := b.Batch(ops); err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(removing)
+	}
+	for _, t := range removing {
+		fmt.Printf("removed %s\n", formatTask(t, false))
+	}
+	return nil
+}
+
+// within reports whether tasks[index] is in the subtree of another
+// task of tasks, or listed before
+func within(tasks []*model.TaskItem, index int) bool {
+	t := tasks[index]
+	for i, other := range tasks {
+		if other.ID == t.ID {
+			if i < index {
+				return true
+			}
+			continue
+		}
+		if model.FindTask(other.SubTasks, t.ID) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func runMode(opts *globalOptions, args []string) error {
+	var mode string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		if mode != "" {
+			return fmt.Errorf("usage: mode [work|life|all]")
+		}
+		mode = args[i]
+	}
+	switch mode {
+	case "", string(model.TaskModeWork), string(model.TaskModeLife), modeAll:
+	default:
+		return fmt.Errorf("unknown mode: %s, expect work, life or all", mode)
+	}
+	if mode != "" {
+		conf, err := readConfig()
+		if err != nil {
+			return err
+		}
+		conf.Mode = mode
+		if err := writeConfig(conf); err != nil {
+			return err
+		}
+	}
+	active, err := activeMode()
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(map[string]string{"mode": active})
+	}
+	fmt.Println(active)
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// completeCommand is called by the completion scripts with the words
+// typed after task-banner, the last being the word to complete. It prints
+// one candidate per line, optionally followed by a tab and a description.
+const completeCommand = "__complete"
+
+const bashCompletion = `
+_task_banner() {
+    local IFS=$'\n'
+    COMPREPLY=($(task-banner __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F _task_banner task-banner
+`
+
+const zshCompletion = `
+#compdef task-banner
+_task_banner() {
+    local -a values descriptions
+    local line value
+    for line in "${(@f)$(task-banner __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -n $line ]] || continue
+        value=${line%%$'\t'*}
+        values+=("$value")
+        if [[ $line == *$'\t'* ]]; then
+            descriptions+=("$value  -- ${line#*$'\t'}")
+        else
+            descriptions+=("$value")
+        fi
+    done
+    if (( ${#values} )); then
+        # the candidates are already filtered, titles match in the middle
+        compadd -U -l -d descriptions -a values
+    else
+        _files
+    fi
+}
+compdef _task_banner task-banner
+`
+
+const fishCompletion = `
+complete -c task-banner -f -a '(task-banner __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`
+
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: completion bash|zsh|fish")
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell: %s, expect bash, zsh or fish", args[0])
+	}
+	fmt.Println(strings.TrimSpace(script))
+	return nil
+}
+
+type candidate struct {
+	value       string
+	description string
+}
+
+var commandCandidates = []candidate{
+	{"add", "add a task"},
+	{"ls", "list tasks"},
+	{"done", "mark tasks done"},
+	{"note", "append a note"},
+	{"mv", "move a task"},
+	{"rm", "remove tasks"},
+	{"mode", "show or switch the active mode"},
+	{"completion", "print the shell completion script"},
+}
+
+var globalFlags = []string{"--server", "--file", "--json", "--help"}
+
+// commandFlags are the flags of each command, those taking a value end with =
+var commandFlags = map[string][]string{
+	"add": {"--parent=", "--mode="},
+	"ls":  {"--all", "--mode=", "--status=", "--query=", "-q=", "--depth=", "--flat"},
+	"mv":  {"--index="},
+	"rm":  {"--force"},
+}
+
+// maxTaskPositionals is the number of leading args of a command that are task ids
+var maxTaskPositionals = map[string]int{
+	"ls":   1,
+	"done": -1,
+	"note": 1,
+	"mv":   2,
+	"rm":   -1,
+}
+
+func runComplete(opts *globalOptions, args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	words, cur := args[:len(args)-1], args[len(args)-1]
+
+	var cmd string
+	var positionals int
+	// pendingFlag is the flag whose value is being completed
+	var pendingFlag string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if strings.HasPrefix(w, "-") {
+			if takesValue(cmd, w) && i+1 >= len(words) {
+				pendingFlag = w
+				break
+			}
+			// picks up --server and --file to load the tasks from
+			consumed, _ := opts.parse(words, i)
+			if consumed == 0 && takesValue(cmd, w) {
+				consumed = 2
+			}
+			if consumed > 1 {
+				i += consumed - 1
+			}
+			continue
+		}
+		if cmd == "" {
+			cmd = w
+			continue
+		}
+		positionals++
+	}
+
+	var candidates []candidate
+	switch {
+	case pendingFlag == "--mode":
+		candidates = modeCandidates(cmd == "ls")
+	case pendingFlag == "--status":
+		candidates = []candidate{{string(model.TaskStatusCreated), ""}, {string(model.TaskStatusDone), ""}, {string(model.TaskStatusArchived), ""}}
+	case pendingFlag == "--parent":
+		printCandidates(taskCandidates(opts, cur))
+		return nil
+	case pendingFlag != "":
+		// files, numbers or free text, left to the shell
+	case strings.HasPrefix(cur, "-"):
+		for _, flag := range append(commandFlags[cmd], globalFlags...) {
+			candidates = append(candidates, candidate{value: strings.TrimSuffix(flag, "=")})
+		}
+	case cmd == "":
+		candidates = commandCandidates
+	case cmd == "mode" && positionals == 0:
+		candidates = modeCandidates(true)
+	case cmd == "completion" && positionals == 0:
+		candidates = []candidate{{"bash", ""}, {"zsh", ""}, {"fish", ""}}
+	default:
+		max, ok := maxTaskPositionals[cmd]
+		if ok && (max < 0 || positionals < max) {
+			printCandidates(taskCandidates(opts, cur))
+			return nil
+		}
+	}
+	var matched []candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.value, cur) {
+			matched = append(matched, c)
+		}
+	}
+	printCandidates(matched)
+	return nil
+}
+
+func printCandidates(candidates []candidate) {
+	for _, c := range candidates {
+		if c.description == "" {
+			fmt.Println(c.value)
+		} else {
+			fmt.Printf("%s\t%s\n", c.value, c.description)
+		}
+	}
+}
+
+func takesValue(cmd string, flag string) bool {
+	if flag == "--server" || flag == "--file" {
+		return true
+	}
+	for _, f := range commandFlags[cmd] {
+		if f == flag+"=" {
+			return true
+		}
+	}
+	return false
+}
+
+func modeCandidates(withAll bool) []candidate {
+	candidates := []candidate{{string(model.TaskModeWork), ""}, {string(model.TaskModeLife), ""}}
+	if withAll {
+		candidates = append(candidates, candidate{modeAll, ""})
+	}
+	return candidates
+}
+
+// taskCandidates lists the tasks whose id starts with cur,
+// or whose title contains cur, with the title as description
+func taskCandidates(opts *globalOptions, cur string) []candidate {
+	tasks, err := opts.backend().LoadTasks("")
+	if err != nil {
+		return nil
+	}
+	cur = strings.TrimPrefix(cur, "#")
+	lower := strings.ToLower(cur)
+	var candidates []candidate
+	model.WalkTasks(tasks, func(t *model.TaskItem, depth int) bool {
+		id := strconv.FormatInt(t.ID, 10)
+		if strings.HasPrefix(id, cur) || strings.Contains(strings.ToLower(t.Title), lower) {
+			candidates = append(candidates, candidate{value: id, description: t.Title})
+		}
+		return true
+	})
+	return candidates
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// modeAll is the active mode listing the tasks of all modes
+const modeAll = "all"
+
+// config is kept in task-banner/config.json under the user config directory
+type config struct {
+	// Mode is the active mode, work if empty, all for every mode
+	Mode string `json:"mode,omitempty"`
+}
+
+func configFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "task-banner", "config.json"), nil
+}
+
+func readConfig() (*config, error) {
+	conf := &config{}
+	file, err := configFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conf, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	return conf, nil
+}
+
+func writeConfig(conf *config) error {
+	file, err := configFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// activeMode returns the name of the active mode, work by default
+func activeMode() (string, error) {
+	conf, err := readConfig()
+	if err != nil {
+		return "", err
+	}
+	if conf.Mode == "" {
+		return string(model.TaskModeWork), nil
+	}
+	return conf.Mode, nil
+}
+
+// loadMode converts a mode name to the mode to load, empty for all
+func loadMode(mode string) model.TaskMode {
+	if mode == modeAll {
+		return ""
+	}
+	return model.TaskMode(mode)
+}
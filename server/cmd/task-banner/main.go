@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/local_impl"
+)
+
+const help = `
+task-banner manages the tasks of the banner from the command line.
+
+Usage: task-banner [OPTIONS] <COMMAND> [ARGS]
+
+Commands:
+  add [--parent ID] [--mode MODE] TITLE   add a task, in the active mode by default
+  ls [ID] [OPTIONS]                       list tasks as a tree, see ls --help
+  done ID...                              mark tasks done, all or none
+  note ID TEXT                            append a note to a task
+  mv ID PARENT [--index N]                move a task under PARENT, 0 for top level
+  rm [--force] ID...                      remove tasks, all or none, --force if they have subtasks
+  mode [work|life|all]                    show or switch the active mode
+  completion bash|zsh|fish                print the shell completion script
+
+A task ID may be written as 12 or #12.
+
+Options:
+  --server URL   the server, defaults to $TASK_BANNER_SERVER or http://localhost:7021
+  --file FILE    open the tasks file directly instead of the server, defaults to
+                 $TASK_BANNER_FILE. Server hooks are not run, and the server
+                 should not be running on the same file.
+  --json         print results as JSON
+  --help         show help message
+
+The active mode is only known to this command, it is kept in
+task-banner/config.json under the user config directory.
+`
+
+const lsHelp = `
+Usage: task-banner ls [ID] [OPTIONS]
+
+Lists the tasks of the active mode as a tree, or the subtree of ID.
+Matching tasks are shown with all their subtasks, filtered out tasks
+are still shown as the parents of matching ones.
+
+Options:
+  --all             all modes instead of the active one
+  --mode MODE       tasks of MODE instead of the active one
+  --status STATUS   only tasks of STATUS, comma separated, e.g. created
+  -q, --query Q     filter by query, e.g. 'has:notes title:~deploy'
+  --depth N         show N levels, 1 for top level only
+  --flat            one task per line with its path instead of a tree
+`
+
+func main() {
+	err := handle(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// globalOptions are accepted before and after the command
+type globalOptions struct {
+	server string
+	file   string
+	json   bool
+}
+
+// parse consumes a global flag at args[i], returns the number of args
+// consumed, 0 if args[i] is not a global flag
+func (c *globalOptions) parse(args []string, i int) (int, error) {
+	switch args[i] {
+	case "--json":
+		c.json = true
+		return 1, nil
+	case "--server", "--file":
+		if i+1 >= len(args) {
+			return 0, fmt.Errorf("%v requires arg", args[i])
+		}
+		if args[i] == "--server" {
+			c.server = args[i+1]
+		} else {
+			c.file = args[i+1]
+		}
+		return 2, nil
+	}
+	return 0, nil
+}
+
+func handle(args []string) error {
+	opts := &globalOptions{}
+	var cmd string
+	var cmdArgs []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		consumed, err := opts.parse(args, i)
+		if err != nil {
+			return err
+		}
+		if consumed > 0 {
+			i += consumed - 1
+			continue
+		}
+		if args[i] == "--help" || args[i] == "-h" {
+			fmt.Println(strings.TrimSpace(help))
+			return nil
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		cmd = args[i]
+		cmdArgs = args[i+1:]
+		break
+	}
+	if cmd == "" {
+		return fmt.Errorf("requires command, see --help")
+	}
+	switch cmd {
+	case "add":
+		return runAdd(opts, cmdArgs)
+	case "ls":
+		return runLs(opts, cmdArgs)
+	case "done":
+		return runDone(opts, cmdArgs)
+	case "note":
+		return runNote(opts, cmdArgs)
+	case "mv":
+		return runMv(opts, cmdArgs)
+	case "rm":
+		return runRm(opts, cmdArgs)
+	case "mode":
+		return runMode(opts, cmdArgs)
+	case "completion":
+		return runCompletion(cmdArgs)
+	case completeCommand:
+		return runComplete(opts, cmdArgs)
+	case "help":
+		fmt.Println(strings.TrimSpace(help))
+		return nil
+	}
+	return fmt.Errorf("unrecognized command: %v, see --help", cmd)
+}
+
+// backend is the part of the task storage used by the commands,
+// implemented by the server client and by the local storage
+type backend interface {
+	LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error)
+	AddTask(task *model.TaskItem) (*model.TaskItem, error)
+	AddTaskNote(taskID int64, note string) error
+	MoveTask(taskID int64, parentID int64, index int) error
+	// Batch applies all operations or none
+	Batch(ops []*model.BatchOperation) ([]*model.BatchResult, error)
+}
+
+func (c *globalOptions) backend() backend {
+	file := c.file
+	if file == "" {
+		file = os.Getenv("TASK_BANNER_FILE")
+	}
+	if file != "" {
+		return local_impl.New(file)
+	}
+	server := c.server
+	if server == "" {
+		server = os.Getenv("TASK_BANNER_SERVER")
+	}
+	if server == "" {
+		server = "http://localhost:7021"
+	}
+	return newClient(server)
+}
+
+// parseTaskID parses 12 or #12
+func parseTaskID(s string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "#"), 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid task id: %s", s)
+	}
+	return id, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
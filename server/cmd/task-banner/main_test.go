@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// setup isolates the config and returns a tasks file holding
+// #1 Release with the subtask #2 Draft
+func setup(t *testing.T) string {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("TASK_BANNER_FILE", "")
+	t.Setenv("TASK_BANNER_SERVER", "")
+	file := filepath.Join(dir, "tasks.json")
+	run(t, "--file", file, "add", "Release")
+	run(t, "--file", file, "add", "--parent", "1", "Draft")
+	return file
+}
+
+// run runs the command and returns what it printed
+func run(t *testing.T, args ...string) string {
+	out, err := runErr(t, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func runErr(t *testing.T, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	err = handle(args)
+	w.Close()
+	return <-output, err
+}
+
+func decodeTasks(t *testing.T, s string) []*model.TaskItem {
+	var tasks []*model.TaskItem
+	if err := json.Unmarshal([]byte(s), &tasks); err != nil {
+		t.Fatalf("invalid JSON %q: %v", s, err)
+	}
+	return tasks
+}
+
+func taskIDs(tasks []*model.TaskItem) []int64 {
+	ids := make([]int64, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestParseIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		ids   []int64
+		force bool
+		json  bool
+		file  string
+		err   string
+	}{
+		{name: "ids", args: []string{"1", "#12"}, ids: []int64{1, 12}},
+		{name: "flag", args: []string{"3", "-f"}, ids: []int64{3}, force: true},
+		{name: "global flags", args: []string{"--json", "4", "--file", "tasks.json", "5"}, ids: []int64{4, 5}, json: true, file: "tasks.json"},
+		{name: "file without value", args: []string{"4", "--file"}, err: "--file requires arg"},
+		{name: "unknown flag", args: []string{"--all", "1"}, err: "unrecognized flag: --all"},
+		{name: "invalid", args: []string{"twelve"}, err: "invalid task id: twelve"},
+		{name: "negative", args: []string{"#-1"}, err: "invalid task id: #-1"},
+		{name: "none", args: []string{"--json"}, err: "requires task id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &globalOptions{}
+			var force bool
+			ids, err := parseIDs(opts, tt.args, map[string]*bool{"--force": &force, "-f": &force})
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expect error %q, actual: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ids, tt.ids) || force != tt.force || opts.json != tt.json || opts.file != tt.file {
+				t.Fatalf("unexpected ids %v force %v options %+v", ids, force, opts)
+			}
+		})
+	}
+}
+
+func TestGlobalFlagsAfterCommand(t *testing.T) {
+	file := setup(t)
+	tests := []struct {
+		name string
+		args []string
+		ids  []int64
+	}{
+		{name: "before", args: []string{"--file", file, "--json", "ls"}, ids: []int64{1}},
+		{name: "after", args: []string{"ls", "--json", "--file", file}, ids: []int64{1}},
+		{name: "around", args: []string{"--json", "ls", "1", "--flat", "--file", file}, ids: []int64{1, 2}},
+		{name: "add", args: []string{"add", "Plan", "--file", file, "--json"}, ids: []int64{3}},
+		{name: "done", args: []string{"done", "#3", "--json", "--file", file}, ids: []int64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := run(t, tt.args...)
+			if !strings.HasPrefix(out, "[") {
+				out = "[" + out + "]"
+			}
+			if ids := taskIDs(decodeTasks(t, out)); !slices.Equal(ids, tt.ids) {
+				t.Fatalf("expect %v, actual: %v", tt.ids, ids)
+			}
+		})
+	}
+
+	if _, err := runErr(t, "ls", "--file"); err == nil || err.Error() != "--file requires arg" {
+		t.Fatalf("expect --file to require an arg, actual: %v", err)
+	}
+}
+
+func TestDoubleDash(t *testing.T) {
+	file := setup(t)
+	added := run(t, "--file", file, "--json", "add", "--", "--json", "is", "a", "flag")
+	var task model.TaskItem
+	if err := json.Unmarshal([]byte(added), &task); err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "--json is a flag" {
+		t.Fatalf("expect the words after -- as title, actual: %q", task.Title)
+	}
+	if _, err := runErr(t, "--file", file, "add", "--json-ish"); err == nil || err.Error() != "unrecognized flag: --json-ish" {
+		t.Fatalf("expect flags rejected before --, actual: %v", err)
+	}
+
+	out := run(t, "--file", file, "note", "1", "--", "--file", "is", "not", "read")
+	if !strings.HasPrefix(out, "noted #1") {
+		t.Fatalf("expect a text output, actual: %q", out)
+	}
+	tasks := decodeTasks(t, run(t, "--file", file, "--json", "ls", "1"))
+	if notes := tasks[0].Notes; len(notes) != 1 || notes[0] != "--file is not read" {
+		t.Fatalf("expect the note after --, actual: %v", notes)
+	}
+}
+
+func TestDoneAllOrNone(t *testing.T) {
+	file := setup(t)
+	if _, err := runErr(t, "--file", file, "done", "2", "9"); err == nil {
+		t.Fatal("expect an error for the missing task")
+	}
+	tasks := decodeTasks(t, run(t, "--file", file, "--json", "ls", "2"))
+	if tasks[0].Status != model.TaskStatusCreated {
+		t.Fatalf("expect #2 left open, actual: %s", tasks[0].Status)
+	}
+
+	out := run(t, "--file", file, "done", "2", "1")
+	if out != "done #2 [x] Draft\ndone #1 [x] Release\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestLsFlat(t *testing.T) {
+	file := setup(t)
+	run(t, "--file", file, "add", "--parent", "2", "Outline")
+	run(t, "--file", file, "add", "Plan")
+
+	out := run(t, "--file", file, "ls", "--flat", "-q", "-title:Draft")
+	expect := "#4 [ ] Plan\n#1 [ ] Release\n#3 [ ] Release / Draft / Outline\n"
+	if out != expect {
+		t.Fatalf("expect:\n%s\nactual:\n%s", expect, out)
+	}
+	tasks := decodeTasks(t, run(t, "--file", file, "ls", "--flat", "-q", "-title:Draft", "--json"))
+	if ids := taskIDs(tasks); !slices.Equal(ids, []int64{4, 1, 3}) {
+		t.Fatalf("expect the same tasks as the text output, actual: %v", ids)
+	}
+	for _, task := range tasks {
+		if len(task.SubTasks) != 0 {
+			t.Fatalf("expect no subtasks, actual: %+v", task)
+		}
+	}
+}
+
+func TestLimitDepth(t *testing.T) {
+	tree := func() []*model.TaskItem {
+		return []*model.TaskItem{
+			{ID: 1, SubTasks: []*model.TaskItem{
+				{ID: 2, SubTasks: []*model.TaskItem{{ID: 3}}},
+			}},
+			{ID: 4},
+		}
+	}
+	tests := []struct {
+		depth  int
+		expect []int64
+	}{
+		{depth: 1, expect: []int64{1, 4}},
+		{depth: 2, expect: []int64{1, 2, 4}},
+		{depth: 3, expect: []int64{1, 2, 3, 4}},
+		{depth: 5, expect: []int64{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		tasks := tree()
+		limited := limitDepth(tasks, tt.depth)
+		var ids []int64
+		model.WalkTasks(limited, func(t *model.TaskItem, depth int) bool {
+			ids = append(ids, t.ID)
+			return true
+		})
+		if !slices.Equal(ids, tt.expect) {
+			t.Errorf("depth %d: expect %v, actual: %v", tt.depth, tt.expect, ids)
+		}
+		if len(tasks[0].SubTasks[0].SubTasks) != 1 {
+			t.Errorf("depth %d: expect the input unchanged", tt.depth)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package crdt implements a state based CRDT for task trees, so that
+// task files edited independently on several devices can be merged
+// deterministically without losing changes.
+//
+// Scalar fields are last-writer-wins registers, the parent of a task is a
+// register too so moves are merged like any other field, siblings are
+// ordered by a register holding a fractional position, and notes form a
+// sequence where concurrent insertions are all kept.
+package crdt
+
+// Clock orders writes, Counter comes first and Replica breaks ties.
+// The zero Clock is the state both replicas start from.
+type Clock struct {
+	Counter int64  `json:"counter"`
+	Replica string `json:"replica"`
+}
+
+func (c Clock) IsZero() bool {
+	return c.Counter == 0 && c.Replica == ""
+}
+
+// Less reports whether c happened before o
+func (c Clock) Less(o Clock) bool {
+	if c.Counter != o.Counter {
+		return c.Counter < o.Counter
+	}
+	return c.Replica < o.Replica
+}
+
+// LWW is a last-writer-wins register
+type LWW[T comparable] struct {
+	Value T     `json:"value"`
+	Clock Clock `json:"clock"`
+}
+
+// Set writes v if clock is newer than the current one
+func (c *LWW[T]) Set(v T, clock Clock) {
+	if c.Clock.Less(clock) {
+		c.Value = v
+		c.Clock = clock
+	}
+}
+
+func (c *LWW[T]) Merge(o LWW[T]) {
+	c.Set(o.Value, o.Clock)
+}
@@ -0,0 +1,314 @@
+package crdt
+
+import (
+	"encoding/json"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// baseIndex indexes the common ancestor of two task files
+type baseIndex struct {
+	tasks    map[int64]*model.TaskItem
+	parents  map[int64]int64
+	children map[int64][]int64
+	position map[int64]int
+}
+
+func newBaseIndex(tasks []*model.TaskItem) *baseIndex {
+	c := &baseIndex{
+		tasks:    make(map[int64]*model.TaskItem),
+		parents:  make(map[int64]int64),
+		children: make(map[int64][]int64),
+		position: make(map[int64]int),
+	}
+	c.add(0, tasks)
+	return c
+}
+
+func (c *baseIndex) add(parentID int64, tasks []*model.TaskItem) {
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		c.tasks[task.ID] = task
+		c.parents[task.ID] = parentID
+		c.position[task.ID] = len(c.children[parentID])
+		c.children[parentID] = append(c.children[parentID], task.ID)
+		c.add(task.ID, task.SubTasks)
+	}
+}
+
+// FromTasks builds the doc of one replica from its tasks and the common base,
+// base may be nil if unknown. Fields equal to the base keep a zero clock,
+// changed ones are stamped with the task revision and replica.
+func FromTasks(base []*model.TaskItem, tasks []*model.TaskItem, replica string) *Doc {
+	idx := newBaseIndex(base)
+	doc := NewDoc()
+
+	var walk func(parentID int64, list []*model.TaskItem)
+	walk = func(parentID int64, list []*model.TaskItem) {
+		list = nonNil(list)
+		ids := make([]int64, len(list))
+		for i, task := range list {
+			ids[i] = task.ID
+		}
+		positions := siblingPositions(idx.children[parentID], ids)
+		for i, task := range list {
+			revision := task.Revision
+			if revision < 1 {
+				revision = 1
+			}
+			clock := Clock{Counter: revision, Replica: replica}
+			doc.Nodes[task.ID] = fromTask(idx, task, parentID, positions[i], clock)
+			walk(task.ID, task.SubTasks)
+		}
+	}
+	walk(0, tasks)
+
+	// removed by this replica
+	for id, task := range idx.tasks {
+		if _, ok := doc.Nodes[id]; ok {
+			continue
+		}
+		node := &Node{
+			ID:         id,
+			Title:      LWW[string]{Value: task.Title},
+			StartTime:  LWW[model.SwiftTimestamp]{Value: task.StartTime},
+			DueTime:    LWW[model.SwiftTimestamp]{Value: task.DueTime},
+			DoneTime:   LWW[model.SwiftTimestamp]{Value: task.DoneTime},
+			Priority:   LWW[string]{Value: task.Priority},
+			ExternalID: LWW[string]{Value: task.ExternalID},
+			Links:      LWW[string]{Value: encodeLinks(task.Links)},
+			Mode:       LWW[model.TaskMode]{Value: task.Mode},
+			Status:     LWW[model.TaskStatus]{Value: task.Status},
+			Parent:     LWW[int64]{Value: idx.parents[id]},
+			Position:   LWW[float64]{Value: float64(idx.position[id])},
+			Notes:      baseNotes(task.Notes, task.NoteTimes),
+			History:    task.StatusHistory,
+			Revision:   task.Revision,
+			Removed:    true,
+		}
+		doc.Nodes[id] = node
+	}
+	return doc
+}
+
+func fromTask(idx *baseIndex, task *model.TaskItem, parentID int64, position *float64, clock Clock) *Node {
+	node := &Node{
+		ID:       task.ID,
+		Revision: task.Revision,
+	}
+	baseTask, ok := idx.tasks[task.ID]
+	if !ok {
+		node.Created = true
+		node.Origin = clock.Replica
+		node.Modified = true
+		node.Title = LWW[string]{Value: task.Title, Clock: clock}
+		node.StartTime = LWW[model.SwiftTimestamp]{Value: task.StartTime, Clock: clock}
+		node.DueTime = LWW[model.SwiftTimestamp]{Value: task.DueTime, Clock: clock}
+		node.DoneTime = LWW[model.SwiftTimestamp]{Value: task.DoneTime, Clock: clock}
+		node.Priority = LWW[string]{Value: task.Priority, Clock: clock}
+		node.ExternalID = LWW[string]{Value: task.ExternalID, Clock: clock}
+		node.Links = LWW[string]{Value: encodeLinks(task.Links), Clock: clock}
+		node.Mode = LWW[model.TaskMode]{Value: task.Mode, Clock: clock}
+		node.Status = LWW[model.TaskStatus]{Value: task.Status, Clock: clock}
+		node.Parent = LWW[int64]{Value: parentID, Clock: clock}
+		node.Position = LWW[float64]{Value: *position, Clock: clock}
+		node.Notes = diffNotes(nil, nil, task.Notes, task.NoteTimes, clock)
+		node.History = task.StatusHistory
+		return node
+	}
+
+	node.Title = register(&node.Modified, baseTask.Title, task.Title, clock)
+	node.StartTime = register(&node.Modified, baseTask.StartTime, task.StartTime, clock)
+	node.DueTime = register(&node.Modified, baseTask.DueTime, task.DueTime, clock)
+	node.DoneTime = register(&node.Modified, baseTask.DoneTime, task.DoneTime, clock)
+	node.Priority = register(&node.Modified, baseTask.Priority, task.Priority, clock)
+	node.ExternalID = register(&node.Modified, baseTask.ExternalID, task.ExternalID, clock)
+	node.Links = register(&node.Modified, encodeLinks(baseTask.Links), encodeLinks(task.Links), clock)
+	node.Mode = register(&node.Modified, baseTask.Mode, task.Mode, clock)
+	node.Status = register(&node.Modified, baseTask.Status, task.Status, clock)
+	node.Parent = register(&node.Modified, idx.parents[task.ID], parentID, clock)
+	if position == nil {
+		node.Position = LWW[float64]{Value: float64(idx.position[task.ID])}
+	} else {
+		node.Position = LWW[float64]{Value: *position, Clock: clock}
+		node.Modified = true
+	}
+	node.Notes = diffNotes(baseTask.Notes, baseTask.NoteTimes, task.Notes, task.NoteTimes, clock)
+	node.History = mergeHistory(baseTask.StatusHistory, task.StatusHistory)
+	for _, note := range node.Notes {
+		if note.Deleted || note.ID.Clock == clock {
+			node.Modified = true
+			break
+		}
+	}
+	if node.Revision < baseTask.Revision {
+		node.Revision = baseTask.Revision
+	}
+	return node
+}
+
+func register[T comparable](modified *bool, base T, value T, clock Clock) LWW[T] {
+	if base == value {
+		return LWW[T]{Value: value}
+	}
+	*modified = true
+	return LWW[T]{Value: value, Clock: clock}
+}
+
+// encodeLinks encodes links as a comparable value, empty for no links
+func encodeLinks(links []*model.TaskLink) string {
+	if len(links) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(links)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeLinks(s string) []*model.TaskLink {
+	if s == "" {
+		return nil
+	}
+	var links []*model.TaskLink
+	if err := json.Unmarshal([]byte(s), &links); err != nil {
+		return nil
+	}
+	return links
+}
+
+func nonNil(list []*model.TaskItem) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0, len(list))
+	for _, task := range list {
+		if task != nil {
+			result = append(result, task)
+		}
+	}
+	return result
+}
+
+// siblingPositions returns nil for tasks staying in their base order,
+// tasks inserted or moved get a position between their stable neighbours
+func siblingPositions(baseIDs []int64, ids []int64) []*float64 {
+	basePos := make(map[int64]int, len(baseIDs))
+	for i, id := range baseIDs {
+		basePos[id] = i
+	}
+	stable := lcs(len(baseIDs), len(ids), func(i, j int) bool {
+		return baseIDs[i] == ids[j]
+	})
+	isStable := make([]bool, len(ids))
+	for _, pair := range stable {
+		isStable[pair[1]] = true
+	}
+
+	positions := make([]*float64, len(ids))
+	lo := -1.0
+	for i := 0; i < len(ids); {
+		if isStable[i] {
+			lo = float64(basePos[ids[i]])
+			i++
+			continue
+		}
+		j := i
+		for j < len(ids) && !isStable[j] {
+			j++
+		}
+		hi := float64(len(baseIDs))
+		if j < len(ids) {
+			hi = float64(basePos[ids[j]])
+		}
+		k := j - i
+		for n := 0; n < k; n++ {
+			p := lo + (hi-lo)*float64(n+1)/float64(k+1)
+			positions[i+n] = &p
+		}
+		i = j
+	}
+	return positions
+}
+
+func baseNotes(notes []string, times []model.SwiftTimestamp) map[NoteID]*Note {
+	result := make(map[NoteID]*Note, len(notes))
+	var prev *NoteID
+	for i, text := range notes {
+		id := NoteID{Index: i}
+		result[id] = &Note{ID: id, After: prev, Text: text, Time: noteTime(times, i)}
+		prev = &id
+	}
+	return result
+}
+
+// diffNotes keeps the base notes found in notes, tombstones the others,
+// and inserts the rest after the note preceding them
+func diffNotes(base []string, baseTimes []model.SwiftTimestamp, notes []string, times []model.SwiftTimestamp, clock Clock) map[NoteID]*Note {
+	result := baseNotes(base, baseTimes)
+	matched := lcs(len(base), len(notes), func(i, j int) bool {
+		return base[i] == notes[j]
+	})
+	baseOf := make(map[int]int, len(matched))
+	kept := make(map[int]bool, len(matched))
+	for _, pair := range matched {
+		baseOf[pair[1]] = pair[0]
+		kept[pair[0]] = true
+	}
+	for i := range base {
+		if !kept[i] {
+			result[NoteID{Index: i}].Deleted = true
+		}
+	}
+	var prev *NoteID
+	for j, text := range notes {
+		if i, ok := baseOf[j]; ok {
+			id := NoteID{Index: i}
+			prev = &id
+			continue
+		}
+		id := NoteID{Clock: clock, Index: j}
+		result[id] = &Note{ID: id, After: prev, Text: text, Time: noteTime(times, j)}
+		prev = &id
+	}
+	return result
+}
+
+func noteTime(times []model.SwiftTimestamp, i int) model.SwiftTimestamp {
+	if i < len(times) {
+		return times[i]
+	}
+	return 0
+}
+
+// lcs returns the index pairs of a longest common subsequence
+func lcs(n int, m int, equal func(i, j int) bool) [][2]int {
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < n && j < m; {
+		if equal(i, j) {
+			pairs = append(pairs, [2]int{i, j})
+			i++
+			j++
+		} else if dp[i+1][j] >= dp[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return pairs
+}
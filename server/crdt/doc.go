@@ -0,0 +1,383 @@
+package crdt
+
+import (
+	"sort"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// NoteID identifies a note element, notes from the base get a zero Clock
+type NoteID struct {
+	Clock Clock `json:"clock"`
+	Index int   `json:"index"`
+}
+
+func (c NoteID) Less(o NoteID) bool {
+	if c.Clock != o.Clock {
+		return c.Clock.Less(o.Clock)
+	}
+	return c.Index < o.Index
+}
+
+// Note is an element of the note sequence, removed notes stay as tombstones
+type Note struct {
+	ID NoteID `json:"id"`
+	// After is the element this note was inserted after, nil means the head
+	After   *NoteID `json:"after,omitempty"`
+	Text    string  `json:"text"`
+	Deleted bool    `json:"deleted,omitempty"`
+	// Time is when the note was added, 0 if unknown
+	Time model.SwiftTimestamp `json:"time,omitempty"`
+}
+
+type Node struct {
+	ID int64 `json:"id"`
+
+	Title     LWW[string]               `json:"title"`
+	StartTime LWW[model.SwiftTimestamp] `json:"startTime"`
+	DueTime   LWW[model.SwiftTimestamp] `json:"dueTime"`
+	DoneTime  LWW[model.SwiftTimestamp] `json:"doneTime"`
+	Priority  LWW[string]               `json:"priority"`
+	// ExternalID is not expected to change, but kept like the other fields
+	ExternalID LWW[string]           `json:"externalID"`
+	Mode       LWW[model.TaskMode]   `json:"mode"`
+	Status     LWW[model.TaskStatus] `json:"status"`
+	Parent     LWW[int64]            `json:"parent"`
+	// Links is the link list encoded by encodeLinks, the whole list is one register
+	Links LWW[string] `json:"links"`
+	// Position orders siblings, ties are broken by ID
+	Position LWW[float64] `json:"position"`
+
+	Notes map[NoteID]*Note `json:"-"`
+	// History is the union of the status changes of both replicas
+	History []*model.StatusChange `json:"history,omitempty"`
+
+	Revision int64 `json:"revision"`
+	// Created is set if the node is not in the base, Origin is the replica creating it
+	Created bool   `json:"created,omitempty"`
+	Origin  string `json:"origin,omitempty"`
+	// Removed is set if a replica removed the node, Modified if any replica
+	// changed it since the base. A node both removed and modified is kept.
+	Removed  bool `json:"removed,omitempty"`
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Doc is the replicated state of a whole task tree
+type Doc struct {
+	Nodes map[int64]*Node
+}
+
+func NewDoc() *Doc {
+	return &Doc{Nodes: make(map[int64]*Node)}
+}
+
+func (c *Node) clone() *Node {
+	cl := *c
+	cl.Notes = make(map[NoteID]*Note, len(c.Notes))
+	for id, note := range c.Notes {
+		n := *note
+		cl.Notes[id] = &n
+	}
+	return &cl
+}
+
+func (c *Node) merge(o *Node) {
+	c.Title.Merge(o.Title)
+	c.StartTime.Merge(o.StartTime)
+	c.DueTime.Merge(o.DueTime)
+	c.DoneTime.Merge(o.DoneTime)
+	c.Priority.Merge(o.Priority)
+	c.Links.Merge(o.Links)
+	c.ExternalID.Merge(o.ExternalID)
+	c.Mode.Merge(o.Mode)
+	c.Status.Merge(o.Status)
+	c.Parent.Merge(o.Parent)
+	c.Position.Merge(o.Position)
+	c.History = mergeHistory(c.History, o.History)
+	for id, note := range o.Notes {
+		existing, ok := c.Notes[id]
+		if !ok {
+			n := *note
+			c.Notes[id] = &n
+			continue
+		}
+		existing.Deleted = existing.Deleted || note.Deleted
+	}
+	if o.Revision > c.Revision {
+		c.Revision = o.Revision
+	}
+	c.Removed = c.Removed || o.Removed
+	c.Modified = c.Modified || o.Modified
+	// both created it with the same content
+	c.Created = c.Created && o.Created
+	if o.Origin < c.Origin {
+		c.Origin = o.Origin
+	}
+}
+
+// Merge combines two docs into a new one, the result does not depend on the order.
+//
+// Tasks created independently by both replicas may get the same ID, if their
+// titles differ the one from the greater replica is moved to a fresh ID.
+func Merge(a *Doc, b *Doc) *Doc {
+	if b.less(a) {
+		a, b = b, a
+	}
+	result := NewDoc()
+	var maxID int64
+	for id, node := range a.Nodes {
+		result.Nodes[id] = node.clone()
+		if id > maxID {
+			maxID = id
+		}
+	}
+	for id := range b.Nodes {
+		if id > maxID {
+			maxID = id
+		}
+	}
+
+	// remap colliding creations of b
+	remap := make(map[int64]int64)
+	ids := b.sortedIDs()
+	for _, id := range ids {
+		node := b.Nodes[id]
+		existing, ok := result.Nodes[id]
+		if ok && node.Created && existing.Created && node.Title.Value != existing.Title.Value {
+			maxID++
+			remap[id] = maxID
+		}
+	}
+	for _, id := range ids {
+		node := b.Nodes[id].clone()
+		if newID, ok := remap[id]; ok {
+			node.ID = newID
+		}
+		if newParent, ok := remap[node.Parent.Value]; ok {
+			node.Parent.Value = newParent
+		}
+		existing, ok := result.Nodes[node.ID]
+		if !ok {
+			result.Nodes[node.ID] = node
+			continue
+		}
+		existing.merge(node)
+	}
+	return result
+}
+
+// less orders docs so Merge is commutative
+func (c *Doc) less(o *Doc) bool {
+	return c.origin() < o.origin()
+}
+
+func (c *Doc) origin() string {
+	origin := ""
+	for _, node := range c.Nodes {
+		if node.Created && (origin == "" || node.Origin < origin) {
+			origin = node.Origin
+		}
+	}
+	return origin
+}
+
+func (c *Doc) sortedIDs() []int64 {
+	ids := make([]int64, 0, len(c.Nodes))
+	for id := range c.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Tasks materializes the doc as a task tree
+func (c *Doc) Tasks() []*model.TaskItem {
+	alive := c.aliveNodes()
+	parents := c.resolveParents(alive)
+
+	items := make(map[int64]*model.TaskItem, len(alive))
+	for id := range alive {
+		node := c.Nodes[id]
+		texts, times := node.noteTexts()
+		items[id] = &model.TaskItem{
+			ID:            id,
+			Title:         node.Title.Value,
+			StartTime:     node.StartTime.Value,
+			DueTime:       node.DueTime.Value,
+			DoneTime:      node.DoneTime.Value,
+			Priority:      node.Priority.Value,
+			ExternalID:    node.ExternalID.Value,
+			Links:         decodeLinks(node.Links.Value),
+			ParentID:      parents[id],
+			SubTasks:      []*model.TaskItem{},
+			Mode:          node.Mode.Value,
+			Status:        node.Status.Value,
+			Notes:         texts,
+			NoteTimes:     times,
+			StatusHistory: node.History,
+			Revision:      node.Revision,
+		}
+	}
+
+	roots := []*model.TaskItem{}
+	for _, id := range c.sortedIDs() {
+		item, ok := items[id]
+		if !ok {
+			continue
+		}
+		if item.ParentID == 0 {
+			roots = append(roots, item)
+			continue
+		}
+		parent := items[item.ParentID]
+		parent.SubTasks = append(parent.SubTasks, item)
+	}
+	var sortSiblings func(list []*model.TaskItem)
+	sortSiblings = func(list []*model.TaskItem) {
+		sort.SliceStable(list, func(i, j int) bool {
+			pi := c.Nodes[list[i].ID].Position.Value
+			pj := c.Nodes[list[j].ID].Position.Value
+			if pi != pj {
+				return pi < pj
+			}
+			return list[i].ID < list[j].ID
+		})
+		for _, item := range list {
+			sortSiblings(item.SubTasks)
+		}
+	}
+	sortSiblings(roots)
+	return roots
+}
+
+// aliveNodes drops removed nodes unless modified by another replica,
+// or still holding a live descendant
+func (c *Doc) aliveNodes() map[int64]bool {
+	alive := make(map[int64]bool, len(c.Nodes))
+	for id, node := range c.Nodes {
+		if !node.Removed || node.Modified {
+			alive[id] = true
+		}
+	}
+	for id := range c.Nodes {
+		if !alive[id] {
+			continue
+		}
+		seen := map[int64]bool{id: true}
+		for p := c.Nodes[id].Parent.Value; p != 0 && !seen[p]; {
+			seen[p] = true
+			parent, ok := c.Nodes[p]
+			if !ok {
+				break
+			}
+			alive[p] = true
+			p = parent.Parent.Value
+		}
+	}
+	return alive
+}
+
+// resolveParents attaches nodes in the order their parent was last written,
+// a move that would form a cycle is dropped and the node goes to the top level
+func (c *Doc) resolveParents(alive map[int64]bool) map[int64]int64 {
+	ids := make([]int64, 0, len(alive))
+	for id := range alive {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ci := c.Nodes[ids[i]].Parent.Clock
+		cj := c.Nodes[ids[j]].Parent.Clock
+		if ci != cj {
+			return ci.Less(cj)
+		}
+		return ids[i] < ids[j]
+	})
+	parents := make(map[int64]int64, len(ids))
+	isAncestor := func(ancestor int64, id int64) bool {
+		for p := id; p != 0; p = parents[p] {
+			if p == ancestor {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range ids {
+		p := c.Nodes[id].Parent.Value
+		if p == 0 || !alive[p] || isAncestor(id, p) {
+			parents[id] = 0
+			continue
+		}
+		parents[id] = p
+	}
+	return parents
+}
+
+// noteTexts orders the note sequence: an element follows the one it was
+// inserted after, among elements inserted after the same one newer come first
+// noteTexts returns the notes in order with their times, times are nil if all unknown
+func (c *Node) noteTexts() ([]string, []model.SwiftTimestamp) {
+	children := make(map[NoteID][]*Note)
+	var heads []*Note
+	for _, note := range c.Notes {
+		if note.After == nil {
+			heads = append(heads, note)
+			continue
+		}
+		if _, ok := c.Notes[*note.After]; !ok {
+			heads = append(heads, note)
+			continue
+		}
+		children[*note.After] = append(children[*note.After], note)
+	}
+	newerFirst := func(list []*Note) {
+		sort.Slice(list, func(i, j int) bool {
+			return list[j].ID.Less(list[i].ID)
+		})
+	}
+	texts := []string{}
+	var times []model.SwiftTimestamp
+	known := false
+	var visit func(list []*Note)
+	visit = func(list []*Note) {
+		newerFirst(list)
+		for _, note := range list {
+			if !note.Deleted {
+				texts = append(texts, note.Text)
+				times = append(times, note.Time)
+				known = known || note.Time != 0
+			}
+			visit(children[note.ID])
+		}
+	}
+	visit(heads)
+	if !known {
+		times = nil
+	}
+	return texts, times
+}
+
+// mergeHistory returns the status changes of a and b ordered by time,
+// changes in both are kept once
+func mergeHistory(a []*model.StatusChange, b []*model.StatusChange) []*model.StatusChange {
+	seen := make(map[model.StatusChange]bool, len(a)+len(b))
+	var merged []*model.StatusChange
+	for _, list := range [][]*model.StatusChange{a, b} {
+		for _, change := range list {
+			if change == nil || seen[*change] {
+				continue
+			}
+			seen[*change] = true
+			merged = append(merged, change)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Time != merged[j].Time {
+			return merged[i].Time < merged[j].Time
+		}
+		if merged[i].From != merged[j].From {
+			return merged[i].From < merged[j].From
+		}
+		return merged[i].To < merged[j].To
+	})
+	return merged
+}
@@ -0,0 +1,163 @@
+package crdt
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func baseTasks() []*model.TaskItem {
+	return []*model.TaskItem{
+		{ID: 1, Title: "Release", Revision: 1, Notes: []string{"draft"}, SubTasks: []*model.TaskItem{
+			{ID: 2, ParentID: 1, Title: "Write notes", Revision: 1},
+		}},
+		{ID: 3, Title: "Groceries", Revision: 1},
+	}
+}
+
+func find(tasks []*model.TaskItem, id int64) *model.TaskItem {
+	task := model.FindTask(tasks, id)
+	if task == nil {
+		panic("task not found: " + strconv.FormatInt(id, 10))
+	}
+	return task
+}
+
+func remove(tasks []*model.TaskItem, id int64) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0, len(tasks))
+	for _, task := range tasks {
+		if task.ID == id {
+			continue
+		}
+		task.SubTasks = remove(task.SubTasks, id)
+		result = append(result, task)
+	}
+	return result
+}
+
+// formatTree formats ids with titles, subtasks in parentheses
+func formatTree(tasks []*model.TaskItem) string {
+	var parts []string
+	for _, task := range tasks {
+		s := strconv.FormatInt(task.ID, 10) + ":" + task.Title
+		if len(task.SubTasks) > 0 {
+			s += "(" + formatTree(task.SubTasks) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func merge(t *testing.T, a []*model.TaskItem, b []*model.TaskItem) []*model.TaskItem {
+	t.Helper()
+	base := baseTasks()
+	ab := Merge(FromTasks(base, a, "a"), FromTasks(base, b, "b")).Tasks()
+	ba := Merge(FromTasks(base, b, "b"), FromTasks(base, a, "a")).Tasks()
+	if !reflect.DeepEqual(ab, ba) {
+		t.Fatalf("merge is not commutative:\n%s\n%s", toJSON(ab), toJSON(ba))
+	}
+	return ab
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestMergeUnchanged(t *testing.T) {
+	tasks := merge(t, baseTasks(), baseTasks())
+	if actual, expect := formatTree(tasks), "1:Release(2:Write notes) 3:Groceries"; actual != expect {
+		t.Fatalf("expect %q, actual: %q", expect, actual)
+	}
+}
+
+func TestMergeDifferentFields(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	find(a, 2).Title = "Write release notes"
+	find(a, 2).Revision = 2
+	find(b, 2).Status = model.TaskStatusDone
+	find(b, 2).Revision = 2
+
+	task := find(merge(t, a, b), 2)
+	if task.Title != "Write release notes" || task.Status != model.TaskStatusDone {
+		t.Fatalf("expect both edits kept, actual: %s", toJSON(task))
+	}
+}
+
+func TestMergeSameFieldNewerRevisionWins(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	find(a, 3).Title = "Groceries for Monday"
+	find(a, 3).Revision = 2
+	find(b, 3).Title = "Weekly groceries"
+	find(b, 3).Revision = 4
+
+	if title := find(merge(t, a, b), 3).Title; title != "Weekly groceries" {
+		t.Fatalf("expect the newer title, actual: %q", title)
+	}
+}
+
+func TestMergeNotesFromBothSides(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	find(a, 1).Notes = append(find(a, 1).Notes, "from a")
+	find(a, 1).Revision = 2
+	find(b, 1).Notes = append(find(b, 1).Notes, "from b")
+	find(b, 1).Revision = 2
+
+	notes := find(merge(t, a, b), 1).Notes
+	if len(notes) != 3 || notes[0] != "draft" {
+		t.Fatalf("expect the base note followed by both added notes, actual: %q", notes)
+	}
+}
+
+func TestMergeRemoved(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	a = remove(a, 3)
+	if actual, expect := formatTree(merge(t, a, b)), "1:Release(2:Write notes)"; actual != expect {
+		t.Fatalf("expect %q, actual: %q", expect, actual)
+	}
+
+	// removed on one side but edited on the other is kept
+	find(b, 3).Title = "Groceries and bread"
+	find(b, 3).Revision = 2
+	if actual, expect := formatTree(merge(t, a, b)), "1:Release(2:Write notes) 3:Groceries and bread"; actual != expect {
+		t.Fatalf("expect %q, actual: %q", expect, actual)
+	}
+}
+
+func TestMergeCreatedOnBothSides(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	a = append(a, &model.TaskItem{ID: 4, Title: "Call mom", Revision: 1})
+	b = append(b, &model.TaskItem{ID: 4, Title: "Book flights", Revision: 1})
+
+	tasks := merge(t, a, b)
+	if actual, expect := formatTree(tasks), "1:Release(2:Write notes) 3:Groceries 4:Call mom 5:Book flights"; actual != expect {
+		t.Fatalf("expect %q, actual: %q", expect, actual)
+	}
+}
+
+func TestMergeMovesFormingCycle(t *testing.T) {
+	a, b := baseTasks(), baseTasks()
+	// a moves 3 under 2, b moves 1 under 3
+	a[1].ParentID = 2
+	a[1].Revision = 2
+	a[0].SubTasks[0].SubTasks = []*model.TaskItem{a[1]}
+	a = a[:1]
+	b[0].ParentID = 3
+	b[0].Revision = 2
+	b[1].SubTasks = []*model.TaskItem{b[0]}
+	b = b[1:]
+
+	tasks := merge(t, a, b)
+	seen := make(map[int64]int)
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		seen[task.ID]++
+		return true
+	})
+	if !reflect.DeepEqual(seen, map[int64]int{1: 1, 2: 1, 3: 1}) {
+		t.Fatalf("expect every task once, actual: %s", formatTree(tasks))
+	}
+}
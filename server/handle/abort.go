@@ -1,13 +1,24 @@
 package handle
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+
+	"github.com/xhd2015/task-banner/server/handle/model"
 )
 
 func AbortWithErr(w http.ResponseWriter, err error) {
+	var codeErr *CodeError
+	if errors.As(err, &codeErr) {
+		if codeErr.Data != nil {
+			AbortWithErrData(w, codeErr.Code, err, codeErr.Data)
+			return
+		}
+		AbortWithErrCode(w, codeErr.Code, err)
+		return
+	}
 	AbortWithErrCode(w, http.StatusInternalServerError, err)
 }
 
@@ -20,8 +31,26 @@ func AbortWithErrCode(w http.ResponseWriter, code int, err error) {
 	}
 }
 
+func AbortWithErrData(w http.ResponseWriter, code int, err error, data interface{}) {
+	jsonData, marshalErr := MarshalJSON(w, &model.Resp{
+		Code: code,
+		Msg:  err.Error(),
+		Data: data,
+	})
+	if marshalErr != nil {
+		AbortWithErrCode(w, code, err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_, writeErr := w.Write(jsonData)
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "write error: %v", writeErr)
+	}
+}
+
 func ResponseJSON(w http.ResponseWriter, data interface{}) {
-	jsonData, err := json.Marshal(data)
+	jsonData, err := MarshalJSON(w, data)
 	if err != nil {
 		AbortWithErr(w, err)
 		return
@@ -0,0 +1,36 @@
+package handle
+
+import "net/http"
+
+// CodeError is an error responded with the given http status code
+type CodeError struct {
+	Code int
+	Err  error
+	// Data is optionally responded along with the error message
+	Data interface{}
+}
+
+func NewCodeError(code int, err error) *CodeError {
+	return &CodeError{Code: code, Err: err}
+}
+
+func NotFound(err error) *CodeError {
+	return NewCodeError(http.StatusNotFound, err)
+}
+
+func BadRequest(err error) *CodeError {
+	return NewCodeError(http.StatusBadRequest, err)
+}
+
+func (c *CodeError) WithData(data interface{}) *CodeError {
+	c.Data = data
+	return c
+}
+
+func (c *CodeError) Error() string {
+	return c.Err.Error()
+}
+
+func (c *CodeError) Unwrap() error {
+	return c.Err
+}
@@ -1,7 +1,6 @@
 package handle
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -59,7 +58,7 @@ func Wrap(handler interface{}) func(w http.ResponseWriter, r *http.Request) {
 		if err = ParseRequest(w, r, req.Interface()); err != nil {
 			return
 		}
-		ctx := context.Background()
+		ctx := r.Context()
 		res := v.Call([]reflect.Value{reflect.ValueOf(ctx), req})
 		if numOut == 0 {
 			return
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OptionalBool accepts true/false both as JSON booleans
+// and as strings from query parameters
+type OptionalBool string
+
+func (c *OptionalBool) UnmarshalJSON(data []byte) error {
+	*c = OptionalBool(data)
+	return nil
+}
+
+func (c OptionalBool) Bool() (bool, error) {
+	s := string(c)
+	if strings.HasPrefix(s, "\"") {
+		var err error
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return false, err
+		}
+	}
+	if s == "" || s == "null" {
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
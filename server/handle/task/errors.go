@@ -0,0 +1,46 @@
+package task
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/hook"
+	"github.com/xhd2015/task-banner/server/service/task/snapshot"
+	"github.com/xhd2015/task-banner/server/service/task/template"
+	"github.com/xhd2015/task-banner/server/service/task/webhook"
+)
+
+// wrapError maps errors of the storage to http status codes
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var conflict *task.ConflictError
+	if errors.As(err, &conflict) {
+		return handle.NewCodeError(http.StatusConflict, err).WithData(conflict)
+	}
+	if errors.Is(err, task.ErrTaskNotFound) ||
+		errors.Is(err, snapshot.ErrSnapshotNotFound) || errors.Is(err, snapshot.ErrTaskNotInSnapshot) ||
+		errors.Is(err, template.ErrTemplateNotFound) || errors.Is(err, webhook.ErrWebhookNotFound) {
+		return handle.NotFound(err)
+	}
+	var opErr *task.BatchOpError
+	if errors.As(err, &opErr) || errors.Is(err, task.ErrInvalidOperation) ||
+		errors.Is(err, template.ErrMissingVariables) || errors.Is(err, hook.ErrVetoed) {
+		return handle.BadRequest(err)
+	}
+	return err
+}
+
+// applyConditional applies a single operation guarded by its expected revision
+func applyConditional(op *model.BatchOperation) error {
+	_, err := service.Batch([]*model.BatchOperation{op})
+	var opErr *task.BatchOpError
+	if errors.As(err, &opErr) {
+		err = opErr.Err
+	}
+	return wrapError(err)
+}
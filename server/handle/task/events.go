@@ -0,0 +1,100 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// keepAliveInterval keeps idle connections from being closed by proxies
+const keepAliveInterval = 15 * time.Second
+
+// Events streams task changes as Server-Sent Events.
+//
+// Query parameters:
+//   - mode: only events of tasks visible in the mode
+//   - lastEventID: resume after the event, the Last-Event-ID header takes precedence
+//
+// A `resync` event is sent if events after lastEventID are no longer available,
+// the client should reload all tasks.
+func Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handle.AbortWithErr(w, errors.New("streaming not supported"))
+		return
+	}
+	lastEventIDStr := r.Header.Get("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = r.URL.Query().Get("lastEventID")
+	}
+	var lastEventID int64
+	if lastEventIDStr != "" {
+		var err error
+		lastEventID, err = strconv.ParseInt(lastEventIDStr, 10, 64)
+		if err != nil {
+			handle.AbortWithErrCode(w, http.StatusBadRequest, fmt.Errorf("invalid last event id: %s", lastEventIDStr))
+			return
+		}
+	}
+	mode := model.TaskMode(r.URL.Query().Get("mode"))
+
+	sub := service.Subscribe(lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if sub.Missed {
+		fmt.Fprintf(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, ev := range sub.Replay {
+		if ev.MatchMode(mode) {
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprintf(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-sub.C:
+			if !ok {
+				// lagging behind, the client reconnects with Last-Event-ID
+				return
+			}
+			if !ev.MatchMode(mode) {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev *model.TaskEvent) error {
+	data, err := handle.MarshalJSON(w, ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
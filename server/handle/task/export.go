@@ -0,0 +1,349 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/flatten"
+	"github.com/xhd2015/task-banner/server/service/task/ical"
+	"github.com/xhd2015/task-banner/server/service/task/importer"
+	"github.com/xhd2015/task-banner/server/service/task/markdown"
+	"github.com/xhd2015/task-banner/server/service/task/query"
+	"github.com/xhd2015/task-banner/server/service/task/todotxt"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatICal     = "ical"
+	FormatTodoTxt  = "todotxt"
+	FormatCSV      = "csv"
+	FormatXLSX     = "xlsx"
+
+	// import only, see package importer
+	FormatTaskwarrior = string(importer.SourceTaskwarrior)
+	FormatGitHub      = string(importer.SourceGitHub)
+	FormatJira        = string(importer.SourceJira)
+)
+
+// Export renders tasks in a text format.
+//
+// Query parameters:
+//   - format: markdown, ical, todotxt, csv, xlsx
+//   - mode: only tasks visible in the mode
+//   - rootID: export the subtree of the task instead of the whole tree
+//
+// csv and xlsx have a row per task, with extra parameters:
+//   - columns: comma separated columns, see package flatten, `all` for every column
+//   - query: only rows of tasks matching the query, see package query
+func Export(w http.ResponseWriter, r *http.Request) {
+	export(w, r, r.URL.Query().Get("format"))
+}
+
+// ExportICS serves the tasks as an iCalendar feed for calendar clients to
+// subscribe, with the query parameters of Export. Calendars PUT or POST
+// back are imported like Import, the tasks of the feed itself are
+// recognized by their UID and skipped, only new ones are added.
+func ExportICS(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		importTasks(w, r, FormatICal)
+		return
+	}
+	export(w, r, FormatICal)
+}
+
+func export(w http.ResponseWriter, r *http.Request, format string) {
+	params := r.URL.Query()
+	rootID, err := queryInt64(r, "rootID")
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	tasks, err := service.LoadTasks(model.TaskMode(params.Get("mode")))
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	if rootID != 0 {
+		root := model.FindTask(tasks, rootID)
+		if root == nil {
+			handle.AbortWithErr(w, taskNotFound(rootID))
+			return
+		}
+		tasks = []*model.TaskItem{root}
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case FormatMarkdown:
+		contentType = "text/markdown; charset=utf-8"
+		err = markdown.Render(&buf, tasks)
+	case FormatICal:
+		contentType = "text/calendar; charset=utf-8"
+		err = ical.Render(&buf, tasks, "Tasks")
+	case FormatTodoTxt:
+		contentType = "text/plain; charset=utf-8"
+		err = todotxt.Render(&buf, tasks)
+	case FormatCSV, FormatXLSX:
+		var table [][]string
+		var columns []flatten.Column
+		table, columns, err = flattenTasks(tasks, params.Get("columns"), params.Get("query"))
+		if err != nil {
+			break
+		}
+		if format == FormatCSV {
+			contentType = "text/csv; charset=utf-8"
+			cw := csv.NewWriter(&buf)
+			err = cw.WriteAll(table)
+		} else {
+			contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+			w.Header().Set("Content-Disposition", `attachment; filename="tasks.xlsx"`)
+			err = flatten.WriteXLSX(&buf, table, columns, "Tasks")
+		}
+	default:
+		err = handle.BadRequest(fmt.Errorf("unsupported format: %q", format))
+	}
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func flattenTasks(tasks []*model.TaskItem, columnsParam string, queryParam string) ([][]string, []flatten.Column, error) {
+	columns, err := flatten.ParseColumns(columnsParam)
+	if err != nil {
+		return nil, nil, handle.BadRequest(err)
+	}
+	q, err := query.Parse(queryParam)
+	if err != nil {
+		return nil, nil, handle.BadRequest(err)
+	}
+	return flatten.Table(flatten.Flatten(tasks, q), columns), columns, nil
+}
+
+// Import adds the tasks in the request body, all of them or none.
+// Tasks with an external ID already present are skipped, see ImportResponse.
+//
+// Query parameters:
+//   - format: markdown, ical, todotxt, taskwarrior, github, jira
+//   - parentID: the task to add top level tasks under, 0 for top level
+//   - mode: mode of the top level tasks without one given in the body
+//   - dryRun: true to only preview the tasks to add
+func Import(w http.ResponseWriter, r *http.Request) {
+	importTasks(w, r, r.URL.Query().Get("format"))
+}
+
+type ImportFileRequest struct {
+	// Source is taskwarrior, github or jira
+	Source string `json:"source"`
+	// Path of the export file on the server, relative to TASK_IMPORT_DIR
+	// or an absolute path inside it
+	Path     string         `json:"path"`
+	Mode     model.TaskMode `json:"mode"`
+	ParentID int64          `json:"parentID"`
+	DryRun   bool           `json:"dryRun"`
+}
+
+// ImportFile imports an export file of another task tool read from disk, like Import.
+// Only files in the directory TASK_IMPORT_DIR can be read, it is disabled without it.
+func ImportFile(ctx context.Context, req *ImportFileRequest) (*ImportResponse, error) {
+	source, err := importer.ParseSource(req.Source)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	if req.Path == "" {
+		return nil, handle.BadRequest(errors.New("requires path"))
+	}
+	path, err := importFilePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	tasks, err := importer.Parse(source, data, req.Mode)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	return importPlan(tasks, req.ParentID, req.DryRun)
+}
+
+// importFilePath resolves path in the import directory, following symlinks
+// so a link cannot point outside of it
+func importFilePath(path string) (string, error) {
+	dir := os.Getenv("TASK_IMPORT_DIR")
+	if dir == "" {
+		return "", handle.NewCodeError(http.StatusForbidden, errors.New("importing files is disabled, set TASK_IMPORT_DIR or upload to /api/import"))
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("TASK_IMPORT_DIR: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	outside := handle.NewCodeError(http.StatusForbidden, fmt.Errorf("%s is outside of TASK_IMPORT_DIR", path))
+	if !inDir(root, path) {
+		return "", outside
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", handle.BadRequest(err)
+	}
+	if !inDir(root, resolved) {
+		return "", outside
+	}
+	return resolved, nil
+}
+
+func inDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+func importTasks(w http.ResponseWriter, r *http.Request, format string) {
+	query := r.URL.Query()
+	parentID, err := queryInt64(r, "parentID")
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	dryRun := query.Get("dryRun") == "true"
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+
+	mode := model.TaskMode(query.Get("mode"))
+	var tasks []*model.TaskItem
+	switch format {
+	case FormatMarkdown:
+		tasks, err = markdown.Parse(bytes.NewReader(body), mode)
+	case FormatICal:
+		tasks, err = ical.Parse(bytes.NewReader(body), mode)
+	case FormatTodoTxt:
+		tasks, err = todotxt.Parse(bytes.NewReader(body), mode)
+	case FormatTaskwarrior, FormatGitHub, FormatJira:
+		tasks, err = importer.Parse(importer.Source(format), body, mode)
+	default:
+		err = fmt.Errorf("unsupported format: %q", format)
+	}
+	if err != nil {
+		handle.AbortWithErr(w, handle.BadRequest(err))
+		return
+	}
+
+	resp, err := importPlan(tasks, parentID, dryRun)
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	handle.ResponseJSON(w, handle_model.NewResp(resp))
+}
+
+type ImportResponse struct {
+	DryRun bool `json:"dryRun,omitempty"`
+	// Tasks are the trees that would be added, only set on dry run
+	Tasks []*model.TaskItem `json:"tasks,omitempty"`
+	// Skipped are the tasks whose external ID or ID is already present
+	Skipped []*importer.Skipped `json:"skipped"`
+	// Results of the batch adding the tasks, not set on dry run
+	Results []*model.BatchResult `json:"results"`
+}
+
+// importPlan adds tasks except those imported before
+func importPlan(tasks []*model.TaskItem, parentID int64, dryRun bool) (*ImportResponse, error) {
+	existing, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	plan := importer.Dedupe(existing, tasks)
+	if dryRun {
+		return &ImportResponse{
+			DryRun:  true,
+			Tasks:   plan.Tasks,
+			Skipped: plan.Skipped,
+			Results: []*model.BatchResult{},
+		}, nil
+	}
+	results, err := addTasks(plan.Tasks, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return &ImportResponse{
+		Skipped: plan.Skipped,
+		Results: results,
+	}, nil
+}
+
+// addTasks adds task trees under parentID in one batch, keeping their order,
+// a top level task with its own ParentID goes under that task instead
+func addTasks(tasks []*model.TaskItem, parentID int64) ([]*model.BatchResult, error) {
+	if len(tasks) == 0 {
+		return []*model.BatchResult{}, nil
+	}
+	end := -1
+	var ops []*model.BatchOperation
+	var walk func(tasks []*model.TaskItem, parentRef string)
+	walk = func(tasks []*model.TaskItem, parentRef string) {
+		for _, t := range tasks {
+			if t == nil {
+				continue
+			}
+			ref := "import" + strconv.Itoa(len(ops))
+			op := &model.BatchOperation{
+				Op:        model.BatchOpAdd,
+				Ref:       ref,
+				ParentRef: parentRef,
+				Index:     &end,
+				Task:      t,
+			}
+			if parentRef == "" {
+				op.ParentID = parentID
+				if t.ParentID != 0 {
+					op.ParentID = t.ParentID
+				}
+			}
+			ops = append(ops, op)
+			walk(t.SubTasks, ref)
+		}
+	}
+	walk(tasks, "")
+	results, err := service.Batch(ops)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return results, nil
+}
+
+func queryInt64(r *http.Request, name string) (int64, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, handle.BadRequest(fmt.Errorf("invalid %s: %s", name, s))
+	}
+	return v, nil
+}
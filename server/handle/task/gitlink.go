@@ -0,0 +1,96 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/service/task/gitlink"
+)
+
+var (
+	gitScanner      *gitlink.Scanner
+	gitScanInterval time.Duration
+)
+
+const defaultGitScanInterval = 5 * time.Minute
+
+// newGitScanner links commits of the repositories configured by
+// environment variables:
+//   - TASK_GIT_REPOS: work trees separated by the path list separator, ':' on unix
+//   - TASK_GIT_SCAN_INTERVAL: e.g. 10m, 0 to only scan on /api/scanCommits
+//   - TASK_GIT_FIXES_DONE: true to mark tasks referred to by fixes task #N or fixes #N done
+//
+// The last commit seen of each repository is kept in tasks.gitlink.json for tasks.json.
+func newGitScanner(tasksFile string) {
+	var repos []string
+	for _, repo := range filepath.SplitList(os.Getenv("TASK_GIT_REPOS")) {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		return
+	}
+	var opts gitlink.Options
+	if s := os.Getenv("TASK_GIT_FIXES_DONE"); s != "" {
+		fixesDone, err := strconv.ParseBool(s)
+		if err != nil {
+			log.Printf("invalid TASK_GIT_FIXES_DONE %q, not marking tasks done", s)
+		}
+		opts.FixesDone = fixesDone
+	}
+	gitScanInterval = defaultGitScanInterval
+	if s := os.Getenv("TASK_GIT_SCAN_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			log.Printf("invalid TASK_GIT_SCAN_INTERVAL %q, using %v", s, gitScanInterval)
+		} else {
+			gitScanInterval = d
+		}
+	}
+	stateFile := strings.TrimSuffix(tasksFile, filepath.Ext(tasksFile)) + ".gitlink.json"
+	gitScanner = gitlink.NewScanner(service, repos, stateFile, opts)
+}
+
+// StartGitScanner scans the configured repositories periodically
+func StartGitScanner() {
+	if gitScanner == nil || gitScanInterval == 0 {
+		return
+	}
+	go gitScanner.Run(context.Background(), gitScanInterval)
+}
+
+type ScanCommitsRequest struct {
+	// Repo is a directory of the repository to scan, all if empty.
+	// A post-commit hook can call:
+	//
+	//	curl -s localhost:7021/api/scanCommits -d "{\"repo\":\"$(pwd)\"}"
+	Repo string `json:"repo"`
+}
+
+type ScanCommitsResponse struct {
+	Repos []*gitlink.RepoResult `json:"repos"`
+}
+
+// ScanCommits links new commits of the repositories to the tasks they
+// refer to, like "task #12"
+func ScanCommits(ctx context.Context, req *ScanCommitsRequest) (*ScanCommitsResponse, error) {
+	if gitScanner == nil {
+		return nil, handle.BadRequest(errors.New("no git repositories configured, set TASK_GIT_REPOS"))
+	}
+	results, err := gitScanner.Scan(ctx, req.Repo)
+	if errors.Is(err, gitlink.ErrRepoNotConfigured) {
+		return nil, handle.BadRequest(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ScanCommitsResponse{Repos: results}, nil
+}
@@ -0,0 +1,164 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/links"
+)
+
+type ExtractLinksRequest struct {
+	// TaskID extracts from the notes of the task and its subtasks, 0 for all tasks
+	TaskID handle_model.OptionalNumber `json:"taskID"`
+	// DryRun only reports the links found
+	DryRun handle_model.OptionalBool `json:"dryRun"`
+}
+
+type ExtractedLinks struct {
+	TaskID int64  `json:"taskID"`
+	Title  string `json:"title"`
+	// Added are the links found in notes not in the links of the task yet
+	Added []*model.TaskLink `json:"added"`
+}
+
+type ExtractLinksResponse struct {
+	DryRun bool              `json:"dryRun,omitempty"`
+	Tasks  []*ExtractedLinks `json:"tasks"`
+}
+
+// ExtractLinks moves the URLs mentioned in notes to the links of the tasks,
+// the notes are left as is
+func ExtractLinks(ctx context.Context, req *ExtractLinksRequest) (*ExtractLinksResponse, error) {
+	rootID, err := req.TaskID.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid taskID: %w", err))
+	}
+	dryRun, err := req.DryRun.Bool()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid dryRun: %w", err))
+	}
+	tasks, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	if rootID != 0 {
+		root := model.FindTask(tasks, rootID)
+		if root == nil {
+			return nil, wrapError(task.ErrTaskNotFound)
+		}
+		tasks = []*model.TaskItem{root}
+	}
+	resp := &ExtractLinksResponse{DryRun: dryRun, Tasks: []*ExtractedLinks{}}
+	var ops []*model.BatchOperation
+	model.WalkTasks(tasks, func(t *model.TaskItem, depth int) bool {
+		var found []*model.TaskLink
+		for _, note := range t.Notes {
+			found = append(found, links.Extract(note)...)
+		}
+		merged, added := links.Merge(t.Links, found)
+		if len(added) == 0 {
+			return true
+		}
+		resp.Tasks = append(resp.Tasks, &ExtractedLinks{TaskID: t.ID, Title: t.Title, Added: added})
+		revision := t.Revision
+		ops = append(ops, &model.BatchOperation{
+			Op:               model.BatchOpUpdate,
+			TaskID:           t.ID,
+			Update:           &model.TaskUpdate{Links: &merged},
+			ExpectedRevision: &revision,
+		})
+		return true
+	})
+	if dryRun || len(ops) == 0 {
+		return resp, nil
+	}
+	if _, err := service.Batch(ops); err != nil {
+		return nil, wrapError(err)
+	}
+	return resp, nil
+}
+
+type FindByLinkRequest struct {
+	// Ref is a URL, an external ID like github:owner/repo#12,
+	// owner/repo#12, #12 or a Jira key like PROJ-12
+	Ref string `json:"ref"`
+	// Notes also searches links mentioned in notes but not extracted
+	Notes handle_model.OptionalBool `json:"notes"`
+}
+
+type LinkMatch struct {
+	TaskID int64           `json:"taskID"`
+	Title  string          `json:"title"`
+	Path   []string        `json:"path"`
+	Link   *model.TaskLink `json:"link"`
+	// InNote is set if the link is only mentioned in a note
+	InNote bool `json:"inNote,omitempty"`
+}
+
+type FindByLinkResponse struct {
+	Matches []*LinkMatch `json:"matches"`
+}
+
+// FindByLink finds the tasks referencing a URL, PR, issue or commit
+func FindByLink(ctx context.Context, req *FindByLinkRequest) (*FindByLinkResponse, error) {
+	if req.Ref == "" {
+		return nil, handle.BadRequest(errors.New("requires ref"))
+	}
+	match, err := links.Matcher(req.Ref)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	inNotes, err := req.Notes.Bool()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid notes: %w", err))
+	}
+	tasks, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	resp := &FindByLinkResponse{Matches: []*LinkMatch{}}
+	var walk func(tasks []*model.TaskItem, path []string)
+	walk = func(tasks []*model.TaskItem, path []string) {
+		for _, t := range tasks {
+			if t == nil {
+				continue
+			}
+			add := func(link *model.TaskLink, inNote bool) {
+				resp.Matches = append(resp.Matches, &LinkMatch{
+					TaskID: t.ID,
+					Title:  t.Title,
+					Path:   path,
+					Link:   links.Complete(link),
+					InNote: inNote,
+				})
+			}
+			matched := false
+			for _, link := range t.Links {
+				if match(link) {
+					add(link, false)
+					matched = true
+					break
+				}
+			}
+			if !matched && inNotes {
+			notes:
+				for _, note := range t.Notes {
+					for _, link := range links.Extract(note) {
+						if match(link) {
+							add(link, true)
+							break notes
+						}
+					}
+				}
+			}
+			walk(t.SubTasks, append(path[:len(path):len(path)], t.Title))
+		}
+	}
+	walk(tasks, []string{})
+	return resp, nil
+}
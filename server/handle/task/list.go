@@ -0,0 +1,178 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/query"
+)
+
+func parseListOptions(req *ListTasksRequest) (*query.Options, error) {
+	q, err := query.Parse(req.Query)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	result, err := query.ParseResultMode(req.Result)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	sortKeys, err := query.ParseSort(req.Sort)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	limit, err := req.Limit.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid limit: %w", err))
+	}
+	offset, err := req.Offset.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid offset: %w", err))
+	}
+	return &query.Options{
+		Query:  q,
+		Result: result,
+		Sort:   sortKeys,
+		Limit:  int(limit),
+		Offset: int(offset),
+	}, nil
+}
+
+type shapeOptions struct {
+	depth  int
+	fields map[string]bool
+}
+
+// taskFields are the JSON names of the task fields that can be selected
+var taskFields = jsonFields(reflect.TypeOf(model.TaskItem{}))
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+func parseShapeOptions(depth handle_model.OptionalNumber, fields string) (*shapeOptions, error) {
+	d, err := depth.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid depth: %w", err))
+	}
+	shape := &shapeOptions{depth: int(d)}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !taskFields[field] {
+			return nil, handle.BadRequest(fmt.Errorf("unknown field: %s", field))
+		}
+		if shape.fields == nil {
+			shape.fields = map[string]bool{
+				"id":       true,
+				"subTasks": true,
+			}
+		}
+		shape.fields[field] = true
+	}
+	return shape, nil
+}
+
+// shapeTasks refreshes child counts of the filtered tree, cuts the tree at
+// the requested depth, and projects the requested fields.
+// The result is either []*model.TaskItem or []map[string]interface{} if fields are given.
+func shapeTasks(tasks []*model.TaskItem, result query.ResultMode, shape *shapeOptions) (interface{}, error) {
+	if result != query.ResultFlat {
+		fillCounts(tasks)
+	}
+	if shape.depth > 0 {
+		tasks = limitDepth(tasks, shape.depth)
+	}
+	if shape.fields == nil {
+		return tasks, nil
+	}
+	return projectTasks(tasks, shape.fields)
+}
+
+// fillCounts sets child counts on every node, returns the number of nodes
+func fillCounts(tasks []*model.TaskItem) int {
+	n := 0
+	for _, task := range tasks {
+		task.ChildCount = len(task.SubTasks)
+		task.DescendantCount = fillCounts(task.SubTasks)
+		n += 1 + task.DescendantCount
+	}
+	return n
+}
+
+func limitDepth(tasks []*model.TaskItem, depth int) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0, len(tasks))
+	for _, task := range tasks {
+		cl := task.ShallowClone()
+		if depth <= 1 {
+			cl.SubTasks = []*model.TaskItem{}
+		} else {
+			cl.SubTasks = limitDepth(task.SubTasks, depth-1)
+		}
+		result = append(result, cl)
+	}
+	return result
+}
+
+func projectTasks(tasks []*model.TaskItem, fields map[string]bool) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		cl := task.ShallowClone()
+		cl.SubTasks = nil
+		data, err := json.Marshal(cl)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		for k := range m {
+			if !fields[k] {
+				delete(m, k)
+			}
+		}
+		// typed times follow the negotiated time format
+		times := map[string]interface{}{
+			"startTime":     cl.StartTime,
+			"dueTime":       cl.DueTime,
+			"doneTime":      cl.DoneTime,
+			"statusHistory": cl.StatusHistory,
+			"noteTimes":     cl.NoteTimes,
+		}
+		for k, v := range times {
+			if _, ok := m[k]; ok {
+				m[k] = v
+			}
+		}
+		// omitempty counts
+		for _, k := range []string{"childCount", "descendantCount"} {
+			if fields[k] {
+				if _, ok := m[k]; !ok {
+					m[k] = 0
+				}
+			}
+		}
+		subTasks, err := projectTasks(task.SubTasks, fields)
+		if err != nil {
+			return nil, err
+		}
+		m["subTasks"] = subTasks
+		result = append(result, m)
+	}
+	return result, nil
+}
@@ -0,0 +1,22 @@
+package task
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/xhd2015/task-banner/server/service/task/todotxt"
+)
+
+// StartMirrors starts keeping the files configured by environment
+// variables in sync with the tasks:
+//   - TODO_TXT_FILE: a todo.txt copy of all tasks
+func StartMirrors() {
+	if file := os.Getenv("TODO_TXT_FILE"); file != "" {
+		go func() {
+			if err := todotxt.Mirror(context.Background(), service, file); err != nil {
+				log.Printf("todo.txt mirror %s stopped: %v", file, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,129 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/report"
+)
+
+// StandupReport lists the tasks completed, started, noted and still in
+// progress on a day, grouped by mode.
+//
+// Query parameters:
+//   - date: the day as 2006-01-02, yesterday if empty
+//   - mode: only tasks visible in the mode
+//   - format: json or markdown, json if empty
+//
+// The day is in the time zone negotiated by the timeZone parameter or
+// the X-Time-Zone header, the server's if not given.
+func StandupReport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	loc := reportLocation(r.Context())
+	day, err := parseDay(params.Get("date"), loc, -1)
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	format := params.Get("format")
+	if format != "" && format != "json" && format != FormatMarkdown {
+		handle.AbortWithErr(w, handle.BadRequest(fmt.Errorf("unsupported format: %q", format)))
+		return
+	}
+
+	tasks, err := service.LoadTasks(model.TaskMode(params.Get("mode")))
+	if err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	standup := report.BuildStandup(tasks, day)
+	if format != FormatMarkdown {
+		handle.ResponseJSON(w, handle_model.NewResp(standup))
+		return
+	}
+	var buf bytes.Buffer
+	if err := report.RenderStandup(&buf, standup); err != nil {
+		handle.AbortWithErr(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// defaultStatsDays is the range of stats without from
+const defaultStatsDays = 7
+
+// maxStatsDays bounds the days of a range
+const maxStatsDays = 366
+
+type StatsRequest struct {
+	// From and To are the first and last day as 2006-01-02, To defaults
+	// to today and From to 7 days up to To
+	From string         `json:"from"`
+	To   string         `json:"to"`
+	Mode model.TaskMode `json:"mode"`
+	// Limit caps the task lists, 10 if empty
+	Limit handle_model.OptionalNumber `json:"limit"`
+}
+
+// Stats computes throughput, cycle time and the split by mode over a range
+// of days, in the time zone negotiated like StandupReport
+func Stats(ctx context.Context, req *StatsRequest) (*report.Stats, error) {
+	loc := reportLocation(ctx)
+	last, err := parseDay(req.To, loc, 0)
+	if err != nil {
+		return nil, err
+	}
+	var first time.Time
+	if req.From == "" {
+		first = time.Date(last.Year(), last.Month(), last.Day()-(defaultStatsDays-1), 0, 0, 0, 0, loc)
+	} else if first, err = parseDay(req.From, loc, 0); err != nil {
+		return nil, err
+	}
+	if first.After(last) {
+		return nil, handle.BadRequest(fmt.Errorf("from %s is after to %s", req.From, req.To))
+	}
+	if last.Sub(first) > maxStatsDays*24*time.Hour {
+		return nil, handle.BadRequest(fmt.Errorf("range exceeds %d days", maxStatsDays))
+	}
+	limit, err := req.Limit.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid limit: %s", req.Limit))
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	tasks, err := service.LoadTasks(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	return report.BuildStats(tasks, first, last, int(limit)), nil
+}
+
+// reportLocation returns the time zone of the request, the server's if not given
+func reportLocation(ctx context.Context) *time.Location {
+	if loc, ok := handle.TimeZone(ctx); ok {
+		return loc
+	}
+	return time.Local
+}
+
+// parseDay returns the start of the day, or of today plus offset days if empty
+func parseDay(date string, loc *time.Location, offset int) (time.Time, error) {
+	if date == "" {
+		now := time.Now().In(loc)
+		return time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, loc), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, handle.BadRequest(fmt.Errorf("invalid date: %s, expect 2006-01-02", date))
+	}
+	return day, nil
+}
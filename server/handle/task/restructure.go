@@ -0,0 +1,66 @@
+package task
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+type CloneTaskRequest struct {
+	TaskID int64 `json:"taskID"`
+	model.CloneOptions
+}
+
+// CloneTask deep-copies the subtree of a task with new IDs
+func CloneTask(ctx context.Context, req *CloneTaskRequest) (*model.TaskItem, error) {
+	if req.TaskID == 0 {
+		return nil, handle.BadRequest(errors.New("requires taskID"))
+	}
+	copied, err := service.CloneTask(req.TaskID, &req.CloneOptions)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return copied, nil
+}
+
+type MergeTasksRequest struct {
+	// SourceID is the task folded into TargetID and removed
+	SourceID int64 `json:"sourceID"`
+	TargetID int64 `json:"targetID"`
+}
+
+// MergeTasks moves the subtasks, notes and links of one task into another
+func MergeTasks(ctx context.Context, req *MergeTasksRequest) (*model.TaskItem, error) {
+	if req.SourceID == 0 || req.TargetID == 0 {
+		return nil, handle.BadRequest(errors.New("requires sourceID and targetID"))
+	}
+	merged, err := service.MergeTasks(req.SourceID, req.TargetID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return merged, nil
+}
+
+type SplitTaskRequest struct {
+	TaskID int64 `json:"taskID"`
+	model.SplitOptions
+}
+
+type SplitTaskResponse struct {
+	// Tasks are the new siblings, from notes first then the moved subtasks
+	Tasks []*model.TaskItem `json:"tasks"`
+}
+
+// SplitTask turns notes or subtasks of a task into new siblings
+func SplitTask(ctx context.Context, req *SplitTaskRequest) (*SplitTaskResponse, error) {
+	if req.TaskID == 0 {
+		return nil, handle.BadRequest(errors.New("requires taskID"))
+	}
+	created, err := service.SplitTask(req.TaskID, &req.SplitOptions)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &SplitTaskResponse{Tasks: created}, nil
+}
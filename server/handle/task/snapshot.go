@@ -0,0 +1,206 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/snapshot"
+)
+
+var snapshots *snapshot.Store
+
+// default retention, 30 snapshots within 90 days
+const (
+	defaultSnapshotKeep   = 30
+	defaultSnapshotMaxAge = 90 * 24 * time.Hour
+)
+
+// newSnapshotStore keeps snapshots in a directory next to the tasks file,
+// configured by environment variables:
+//   - TASK_SNAPSHOT_DIR: the directory, defaults to tasks.snapshots for tasks.json
+//   - TASK_SNAPSHOT_KEEP: number of snapshots kept, 0 for no limit
+//   - TASK_SNAPSHOT_MAX_AGE: snapshots older are removed, e.g. 720h, 0 for no limit
+func newSnapshotStore(tasksFile string) *snapshot.Store {
+	dir := os.Getenv("TASK_SNAPSHOT_DIR")
+	if dir == "" {
+		dir = strings.TrimSuffix(tasksFile, filepath.Ext(tasksFile)) + ".snapshots"
+	}
+	retention := snapshot.Retention{
+		MaxCount: defaultSnapshotKeep,
+		MaxAge:   defaultSnapshotMaxAge,
+	}
+	if s := os.Getenv("TASK_SNAPSHOT_KEEP"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			log.Printf("invalid TASK_SNAPSHOT_KEEP %q, keeping %d", s, retention.MaxCount)
+		} else {
+			retention.MaxCount = n
+		}
+	}
+	if s := os.Getenv("TASK_SNAPSHOT_MAX_AGE"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			log.Printf("invalid TASK_SNAPSHOT_MAX_AGE %q, using %v", s, retention.MaxAge)
+		} else {
+			retention.MaxAge = d
+		}
+	}
+	return snapshot.NewStore(dir, retention)
+}
+
+const (
+	SnapshotActionList   = "list"
+	SnapshotActionCreate = "create"
+	SnapshotActionDiff   = "diff"
+	SnapshotActionDelete = "delete"
+)
+
+type SnapshotsRequest struct {
+	// Action is list, create, diff or delete, list if empty
+	Action string `json:"action"`
+	// Name describes the snapshot to create
+	Name string `json:"name"`
+	// ID is the snapshot to diff or delete
+	ID string `json:"id"`
+	// To is the snapshot to diff against, the current tasks if empty
+	To string `json:"to"`
+}
+
+type SnapshotsResponse struct {
+	Snapshots []*snapshot.Snapshot `json:"snapshots,omitempty"`
+	Snapshot  *snapshot.Snapshot   `json:"snapshot,omitempty"`
+	Diff      *snapshot.Diff       `json:"diff,omitempty"`
+}
+
+// Snapshots creates, lists, diffs and deletes snapshots of the whole store
+func Snapshots(ctx context.Context, req *SnapshotsRequest) (*SnapshotsResponse, error) {
+	switch req.Action {
+	case "", SnapshotActionList:
+		list, err := snapshots.List()
+		if err != nil {
+			return nil, err
+		}
+		return &SnapshotsResponse{Snapshots: list}, nil
+	case SnapshotActionCreate:
+		created, err := createSnapshot(req.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &SnapshotsResponse{Snapshot: created}, nil
+	case SnapshotActionDiff:
+		if req.ID == "" {
+			return nil, handle.BadRequest(errors.New("requires id"))
+		}
+		from, before, err := snapshots.Load(req.ID)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		var after []*model.TaskItem
+		if req.To != "" {
+			_, after, err = snapshots.Load(req.To)
+		} else {
+			after, err = service.LoadTasks("")
+		}
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		return &SnapshotsResponse{Snapshot: from, Diff: snapshot.Compare(before, after)}, nil
+	case SnapshotActionDelete:
+		if req.ID == "" {
+			return nil, handle.BadRequest(errors.New("requires id"))
+		}
+		if err := snapshots.Delete(req.ID); err != nil {
+			return nil, wrapError(err)
+		}
+		return &SnapshotsResponse{}, nil
+	}
+	return nil, handle.BadRequest(fmt.Errorf("unknown action: %s", req.Action))
+}
+
+func createSnapshot(name string) (*snapshot.Snapshot, error) {
+	revision, err := service.Revision()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	return snapshots.Create(name, tasks, revision)
+}
+
+type RestoreSnapshotRequest struct {
+	ID string `json:"id"`
+	// TaskID restores only the subtree of the task, 0 for all tasks
+	TaskID int64 `json:"taskID"`
+	// ExpectedRevision fails with a conflict if the store was modified, optional
+	ExpectedRevision *int64 `json:"expectedRevision"`
+}
+
+type RestoreSnapshotResponse struct {
+	// Backup is the snapshot of the tasks before restoring, to undo the restore
+	Backup *snapshot.Snapshot `json:"backup"`
+}
+
+// RestoreSnapshot replaces the tasks, or the subtree of a task, with
+// those of a snapshot. A snapshot of the tasks is taken before, and
+// removed again if the restore fails.
+func RestoreSnapshot(ctx context.Context, req *RestoreSnapshotRequest) (*RestoreSnapshotResponse, error) {
+	if req.ID == "" {
+		return nil, handle.BadRequest(errors.New("requires id"))
+	}
+	_, tasks, err := snapshots.Load(req.ID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	revision, err := service.Revision()
+	if err != nil {
+		return nil, err
+	}
+	current, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpectedRevision != nil && *req.ExpectedRevision != revision {
+		return nil, wrapError(&task.ConflictError{
+			ExpectedRevision: *req.ExpectedRevision,
+			ActualRevision:   revision,
+			Tasks:            current,
+		})
+	}
+	name := "before restoring " + req.ID
+	if req.TaskID != 0 {
+		name += fmt.Sprintf(" task %d", req.TaskID)
+	}
+	// pruned only once restored, the retention must not take the
+	// snapshot being restored
+	backup, err := snapshots.Add(name, current, revision)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := snapshot.Restore(current, tasks, req.TaskID)
+	if err == nil {
+		// the store must not change since the tasks were loaded
+		err = service.SaveTasks(restored, &revision)
+	}
+	if err != nil {
+		if deleteErr := snapshots.Delete(backup.ID); deleteErr != nil {
+			log.Printf("delete backup %s: %v", backup.ID, deleteErr)
+		}
+		return nil, wrapError(err)
+	}
+	if err := snapshots.Prune(req.ID, backup.ID); err != nil {
+		log.Printf("prune snapshots: %v", err)
+	}
+	return &RestoreSnapshotResponse{Backup: backup}, nil
+}
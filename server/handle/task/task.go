@@ -2,85 +2,437 @@ package task
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
 	"github.com/xhd2015/task-banner/server/model"
 	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/hook"
 	"github.com/xhd2015/task-banner/server/service/task/local_impl"
+	"github.com/xhd2015/task-banner/server/service/task/query"
+	"github.com/xhd2015/task-banner/server/service/task/validate"
 )
 
-var service task.ITaskStorage
+var (
+	service task.ITaskStorage
+	storage *local_impl.LocalStorage
+)
 
-func init() {
+// Init opens the tasks and the stores kept next to them, configured by
+// environment variables, it must be called before serving:
+//   - TASK_JSON_FILE: the tasks file, defaults to tasks.json
+//   - TASK_HOOKS: comma separated built-in hooks to enable
+func Init() error {
 	file := "tasks.json"
 	envFile := os.Getenv("TASK_JSON_FILE")
 	if envFile != "" {
 		file = envFile
 	}
-	service = local_impl.New(file)
+	if err := hook.EnableBuiltins(os.Getenv("TASK_HOOKS")); err != nil {
+		return fmt.Errorf("TASK_HOOKS: %w", err)
+	}
+	storage = local_impl.New(file)
+	service = hook.Wrap(storage, hook.DefaultRegistry)
+	snapshots = newSnapshotStore(file)
+	templates = newTemplateStore(file)
+	newWebhooks(file)
+	newGitScanner(file)
+	return nil
+}
+
+// MigrateTimes rewrites the Swift timestamps of the tasks file as RFC 3339
+// times if TASK_STORE_TIME_FORMAT is rfc3339, a snapshot is taken before.
+// The stored format is kept otherwise.
+func MigrateTimes() error {
+	s := os.Getenv("TASK_STORE_TIME_FORMAT")
+	if s == "" {
+		return nil
+	}
+	format, err := model.ParseTimeFormat(s)
+	if err != nil {
+		return fmt.Errorf("TASK_STORE_TIME_FORMAT: %w", err)
+	}
+	if format != model.TimeFormatRFC3339 {
+		return nil
+	}
+	current, err := storage.TimeFormat()
+	if err != nil {
+		return err
+	}
+	if current == format {
+		return nil
+	}
+	backup, err := createSnapshot("before migrating times")
+	if err != nil {
+		return fmt.Errorf("snapshot before migrating times: %w", err)
+	}
+	migrated, err := storage.MigrateTimes()
+	if err != nil {
+		return err
+	}
+	if migrated {
+		log.Printf("migrated times to RFC 3339, snapshot %s has the tasks before", backup.ID)
+	}
+	return nil
 }
 
 type ListTasksRequest struct {
 	Mode model.TaskMode `json:"mode"`
+
+	// Query filters tasks, see package query for the syntax
+	Query string `json:"query"`
+	// Result is either "tree"(default) or "flat"
+	Result string `json:"result"`
+	// Sort is a comma separated list of fields, prefix `-` for descending
+	Sort   string                      `json:"sort"`
+	Limit  handle_model.OptionalNumber `json:"limit"`
+	Offset handle_model.OptionalNumber `json:"offset"`
+
+	// RootID lists the subtree of the given task instead of the whole tree
+	RootID handle_model.OptionalNumber `json:"rootID"`
+	// Depth limits the levels returned, 1 means top level only, <= 0 means unlimited
+	Depth handle_model.OptionalNumber `json:"depth"`
+	// Fields is a comma separated list of fields to return, id and subTasks are always returned
+	Fields string `json:"fields"`
+}
+
+type GetTaskRequest struct {
+	TaskID handle_model.OptionalNumber `json:"taskID"`
+}
+
+// GetTask returns the task together with its subtree
+func GetTask(ctx context.Context, req *GetTaskRequest) (*model.TaskItem, error) {
+	taskID, err := parseTaskID(req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	t := model.FindTask(tasks, taskID)
+	if t == nil {
+		return nil, taskNotFound(taskID)
+	}
+	fillCounts([]*model.TaskItem{t})
+	return t, nil
+}
+
+type GetTaskPathRequest struct {
+	TaskID handle_model.OptionalNumber `json:"taskID"`
+}
+
+// GetTaskPath returns the ancestors from the root down to the task itself,
+// without subtasks
+func GetTaskPath(ctx context.Context, req *GetTaskPathRequest) ([]*model.TaskItem, error) {
+	taskID, err := parseTaskID(req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	path := model.FindTaskPath(tasks, taskID)
+	if path == nil {
+		return nil, taskNotFound(taskID)
+	}
+	result := make([]*model.TaskItem, 0, len(path))
+	for _, t := range path {
+		cl := t.ShallowClone()
+		cl.ChildCount = len(t.SubTasks)
+		cl.SubTasks = []*model.TaskItem{}
+		result = append(result, cl)
+	}
+	return result, nil
+}
+
+func parseTaskID(id handle_model.OptionalNumber) (int64, error) {
+	taskID, err := id.Int64()
+	if err != nil {
+		return 0, handle.BadRequest(fmt.Errorf("invalid taskID: %w", err))
+	}
+	if taskID == 0 {
+		return 0, handle.BadRequest(errors.New("requires taskID"))
+	}
+	return taskID, nil
+}
+
+func taskNotFound(taskID int64) error {
+	return handle.NotFound(fmt.Errorf("%w: %d", task.ErrTaskNotFound, taskID))
 }
 
 type UpdateTaskRequest struct {
 	TaskID int64             `json:"taskID"`
 	Update *model.TaskUpdate `json:"update"`
+	// ExpectedRevision rejects the update with 409 if the task has been modified since
+	ExpectedRevision *int64 `json:"expectedRevision"`
+}
+
+func ListTasks(ctx context.Context, req *ListTasksRequest) (interface{}, error) {
+	opts, err := parseListOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	shape, err := parseShapeOptions(req.Depth, req.Fields)
+	if err != nil {
+		return nil, err
+	}
+	rootID, err := req.RootID.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid rootID: %w", err))
+	}
+	tasks, err := service.LoadTasks(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if rootID != 0 {
+		root := model.FindTask(tasks, rootID)
+		if root == nil {
+			return nil, taskNotFound(rootID)
+		}
+		tasks = []*model.TaskItem{root}
+	}
+	fillCounts(tasks)
+	return shapeTasks(query.Apply(tasks, opts), opts.Result, shape)
 }
 
-func ListTasks(ctx context.Context, req *ListTasksRequest) ([]*model.TaskItem, error) {
-	return service.LoadTasks(req.Mode)
+type ListChildrenRequest struct {
+	// ParentID is the task whose direct children are listed, 0 lists top level tasks
+	ParentID handle_model.OptionalNumber `json:"parentID"`
+	Mode     model.TaskMode              `json:"mode"`
+	Query    string                      `json:"query"`
+	Sort     string                      `json:"sort"`
+	Limit    handle_model.OptionalNumber `json:"limit"`
+	Offset   handle_model.OptionalNumber `json:"offset"`
+	// Depth defaults to 1, i.e. children without grandchildren
+	Depth  handle_model.OptionalNumber `json:"depth"`
+	Fields string                      `json:"fields"`
+}
+
+func ListChildren(ctx context.Context, req *ListChildrenRequest) (interface{}, error) {
+	opts, err := parseListOptions(&ListTasksRequest{
+		Query:  req.Query,
+		Sort:   req.Sort,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	depth := req.Depth
+	if depth == "" {
+		depth = "1"
+	}
+	shape, err := parseShapeOptions(depth, req.Fields)
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := req.ParentID.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid parentID: %w", err))
+	}
+	tasks, err := service.LoadTasks(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != 0 {
+		parent := model.FindTask(tasks, parentID)
+		if parent == nil {
+			return nil, taskNotFound(parentID)
+		}
+		tasks = parent.SubTasks
+	}
+	fillCounts(tasks)
+	return shapeTasks(query.Apply(tasks, opts), opts.Result, shape)
 }
 
 func AddTask(ctx context.Context, task *model.TaskItem) (*model.TaskItem, error) {
-	return service.AddTask(task)
+	added, err := service.AddTask(task)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return added, nil
 }
 
 func UpdateTask(ctx context.Context, req *UpdateTaskRequest) error {
-	return service.UpdateTask(req.TaskID, req.Update)
+	if req.ExpectedRevision != nil {
+		return applyConditional(&model.BatchOperation{
+			Op:               model.BatchOpUpdate,
+			TaskID:           req.TaskID,
+			Update:           req.Update,
+			ExpectedRevision: req.ExpectedRevision,
+		})
+	}
+	return wrapError(service.UpdateTask(req.TaskID, req.Update))
 }
 
+const (
+	SavePolicyStrict = "strict"
+	SavePolicyRepair = "repair"
+)
+
 type SaveTasksRequest struct {
+	// Tasks replace all tasks, those posted with revision 0 keep the
+	// stored fields they omit, see task.ITaskStorage.SaveTasks
 	Tasks []*model.TaskItem `json:"tasks"`
+	// Policy decides what to do with an invalid tree:
+	// "strict"(default) rejects it, "repair" fixes it before saving
+	Policy string `json:"policy"`
+	// ExpectedRevision rejects the save with 409 if the store has been modified since
+	ExpectedRevision *int64 `json:"expectedRevision"`
+}
+
+type SaveTasksResponse struct {
+	// Problems found in the posted tree, all of them are repaired if saved
+	Problems []*validate.Problem `json:"problems"`
+}
+
+func SaveTasks(ctx context.Context, req *SaveTasksRequest) (*SaveTasksResponse, error) {
+	tasks := req.Tasks
+	if tasks == nil {
+		tasks = []*model.TaskItem{}
+	}
+	var problems []*validate.Problem
+	switch req.Policy {
+	case "", SavePolicyStrict:
+		problems = validate.Validate(tasks)
+		if len(problems) > 0 {
+			return nil, handle.BadRequest(fmt.Errorf("invalid tasks: %d problems found, first: %s %s", len(problems), problems[0].Path, problems[0].Message)).WithData(&SaveTasksResponse{Problems: problems})
+		}
+	case SavePolicyRepair:
+		tasks, problems = validate.Repair(tasks)
+	default:
+		return nil, handle.BadRequest(fmt.Errorf("unknown policy: %s, expect strict or repair", req.Policy))
+	}
+	if err := service.SaveTasks(tasks, req.ExpectedRevision); err != nil {
+		return nil, wrapError(err)
+	}
+	if problems == nil {
+		problems = []*validate.Problem{}
+	}
+	return &SaveTasksResponse{Problems: problems}, nil
 }
 
-func SaveTasks(ctx context.Context, req *SaveTasksRequest) error {
-	return service.SaveTasks(req.Tasks)
+type GetRevisionRequest struct {
+}
+
+type GetRevisionResponse struct {
+	Revision int64 `json:"revision"`
+}
+
+// GetRevision returns the revision of the whole store, for saveTasks
+func GetRevision(ctx context.Context, req *GetRevisionRequest) (*GetRevisionResponse, error) {
+	revision, err := service.Revision()
+	if err != nil {
+		return nil, err
+	}
+	return &GetRevisionResponse{Revision: revision}, nil
 }
 
 type RemoveTaskRequest struct {
-	TaskID int64 `json:"taskID"`
+	TaskID           int64  `json:"taskID"`
+	ExpectedRevision *int64 `json:"expectedRevision"`
 }
 
 func RemoveTask(ctx context.Context, req *RemoveTaskRequest) error {
-	return service.RemoveTask(req.TaskID)
+	if req.ExpectedRevision != nil {
+		return applyConditional(&model.BatchOperation{
+			Op:               model.BatchOpRemove,
+			TaskID:           req.TaskID,
+			ExpectedRevision: req.ExpectedRevision,
+		})
+	}
+	return wrapError(service.RemoveTask(req.TaskID))
 }
 
 type ExchangeOrderRequest struct {
 	TaskID         int64 `json:"taskID"`
 	ExchangeTaskID int64 `json:"exchangeTaskID"`
+	// ExpectedRevision rejects the exchange with 409 if taskID has been modified since
+	ExpectedRevision *int64 `json:"expectedRevision"`
 }
 
 func ExchangeOrder(ctx context.Context, req *ExchangeOrderRequest) error {
-	return service.ExchangeOrder(req.TaskID, req.ExchangeTaskID)
+	return wrapError(service.ExchangeOrder(req.TaskID, req.ExchangeTaskID, req.ExpectedRevision))
 }
 
 type AddTaskNoteRequest struct {
-	TaskID int64  `json:"taskID"`
-	Note   string `json:"note"`
+	TaskID           int64  `json:"taskID"`
+	Note             string `json:"note"`
+	ExpectedRevision *int64 `json:"expectedRevision"`
 }
 
 func AddTaskNote(ctx context.Context, req *AddTaskNoteRequest) error {
-	return service.AddTaskNote(req.TaskID, req.Note)
+	if req.ExpectedRevision != nil {
+		return applyConditional(&model.BatchOperation{
+			Op:               model.BatchOpNote,
+			TaskID:           req.TaskID,
+			Note:             req.Note,
+			ExpectedRevision: req.ExpectedRevision,
+		})
+	}
+	return wrapError(service.AddTaskNote(req.TaskID, req.Note))
 }
 
 type UpdateTaskNoteRequest struct {
-	TaskID    int64  `json:"taskID"`
-	NoteIndex int    `json:"noteIndex"`
-	NewText   string `json:"newText"`
+	TaskID           int64  `json:"taskID"`
+	NoteIndex        int    `json:"noteIndex"`
+	NewText          string `json:"newText"`
+	ExpectedRevision *int64 `json:"expectedRevision"`
 }
 
 func UpdateTaskNote(ctx context.Context, req *UpdateTaskNoteRequest) error {
-	return service.UpdateTaskNote(req.TaskID, req.NoteIndex, req.NewText)
+	if req.ExpectedRevision != nil {
+		noteIndex := req.NoteIndex
+		return applyConditional(&model.BatchOperation{
+			Op:               model.BatchOpNote,
+			TaskID:           req.TaskID,
+			Note:             req.NewText,
+			NoteIndex:        &noteIndex,
+			ExpectedRevision: req.ExpectedRevision,
+		})
+	}
+	return wrapError(service.UpdateTaskNote(req.TaskID, req.NoteIndex, req.NewText))
+}
+
+type BatchRequest struct {
+	Operations []*model.BatchOperation `json:"operations"`
+}
+
+type BatchResponse struct {
+	Results []*model.BatchResult `json:"results"`
+}
+
+// Batch applies all operations in order, either all of them or none
+func Batch(ctx context.Context, req *BatchRequest) (*BatchResponse, error) {
+	if len(req.Operations) == 0 {
+		return nil, handle.BadRequest(errors.New("requires operations"))
+	}
+	results, err := service.Batch(req.Operations)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &BatchResponse{Results: results}, nil
+}
+
+type SyncRequest struct {
+	// Cursor is the id of the last change the client has applied, 0 for the first sync
+	Cursor int64 `json:"cursor"`
+	// Operations are queued while offline, set expectedRevision to detect conflicts
+	Operations []*model.BatchOperation `json:"operations"`
+}
+
+// Sync reconciles an offline client: its queued operations are applied,
+// then the changes it has missed are returned
+func Sync(ctx context.Context, req *SyncRequest) (*model.SyncResult, error) {
+	result, err := service.Sync(req.Cursor, req.Operations)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return result, nil
 }
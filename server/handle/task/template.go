@@ -0,0 +1,195 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/template"
+)
+
+var templates *template.Store
+
+// newTemplateStore keeps templates in TASK_TEMPLATE_FILE,
+// defaults to tasks.templates.json for tasks.json
+func newTemplateStore(tasksFile string) *template.Store {
+	file := os.Getenv("TASK_TEMPLATE_FILE")
+	if file == "" {
+		file = strings.TrimSuffix(tasksFile, filepath.Ext(tasksFile)) + ".templates.json"
+	}
+	return template.NewStore(file)
+}
+
+const (
+	TemplateActionList   = "list"
+	TemplateActionGet    = "get"
+	TemplateActionSave   = "save"
+	TemplateActionDelete = "delete"
+)
+
+type TemplatesRequest struct {
+	// Action is list, get, save or delete, list if empty
+	Action string `json:"action"`
+	// Name is the template to get or delete
+	Name string `json:"name"`
+	// Template is the template to save, written by hand
+	Template *template.Template `json:"template"`
+	// Overwrite replaces an existing template with the same name on save
+	Overwrite bool `json:"overwrite"`
+}
+
+type TemplatesResponse struct {
+	Templates []*template.Template `json:"templates,omitempty"`
+	Template  *template.Template   `json:"template,omitempty"`
+}
+
+// Templates lists, gets, saves and deletes templates
+func Templates(ctx context.Context, req *TemplatesRequest) (*TemplatesResponse, error) {
+	switch req.Action {
+	case "", TemplateActionList:
+		list, err := templates.List()
+		if err != nil {
+			return nil, err
+		}
+		return &TemplatesResponse{Templates: list}, nil
+	case TemplateActionGet:
+		if req.Name == "" {
+			return nil, handle.BadRequest(errors.New("requires name"))
+		}
+		t, err := templates.Get(req.Name)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		return &TemplatesResponse{Template: t}, nil
+	case TemplateActionSave:
+		if req.Template == nil {
+			return nil, handle.BadRequest(errors.New("requires template"))
+		}
+		t := *req.Template
+		t.Tasks = template.Capture(t.Tasks, nil)
+		saved, err := templates.Save(&t, req.Overwrite)
+		if err != nil {
+			return nil, handle.BadRequest(err)
+		}
+		return &TemplatesResponse{Template: saved}, nil
+	case TemplateActionDelete:
+		if req.Name == "" {
+			return nil, handle.BadRequest(errors.New("requires name"))
+		}
+		if err := templates.Delete(req.Name); err != nil {
+			return nil, wrapError(err)
+		}
+		return &TemplatesResponse{}, nil
+	}
+	return nil, handle.BadRequest(fmt.Errorf("unknown action: %s", req.Action))
+}
+
+type InstantiateTemplateRequest struct {
+	Name string `json:"name"`
+	// ParentID is the task to create the tasks under, 0 for top level
+	ParentID int64 `json:"parentID"`
+	// Variables fill the placeholders, e.g. {"version": "1.2.0"}
+	Variables map[string]string `json:"variables"`
+	// Mode is the mode of the tasks without one in the template
+	Mode model.TaskMode `json:"mode"`
+}
+
+type InstantiateTemplateResponse struct {
+	// Tasks are the top level tasks created, with their subtasks
+	Tasks []*model.TaskItem `json:"tasks"`
+	// Results of the batch adding the tasks
+	Results []*model.BatchResult `json:"results"`
+}
+
+// InstantiateTemplate creates the tasks of a template under a parent,
+// all or none of them are added
+func InstantiateTemplate(ctx context.Context, req *InstantiateTemplateRequest) (*InstantiateTemplateResponse, error) {
+	if req.Name == "" {
+		return nil, handle.BadRequest(errors.New("requires name"))
+	}
+	t, err := templates.Get(req.Name)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tasks, err := template.Instantiate(t, req.Variables, model.ToSwiftTimestamp(time.Now()))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if req.Mode != "" {
+		model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+			if task.Mode == "" {
+				task.Mode = req.Mode
+			}
+			return true
+		})
+	}
+	results, err := addTasks(tasks, req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	all, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	// results are in pre-order, so the top level tasks are found by position
+	created := make([]*model.TaskItem, 0, len(tasks))
+	i := 0
+	for _, root := range tasks {
+		if found := model.FindTask(all, results[i].TaskID); found != nil {
+			created = append(created, found)
+		}
+		model.WalkTasks([]*model.TaskItem{root}, func(task *model.TaskItem, depth int) bool {
+			i++
+			return true
+		})
+	}
+	return &InstantiateTemplateResponse{Tasks: created, Results: results}, nil
+}
+
+type SaveAsTemplateRequest struct {
+	// TaskID is the root of the subtree to save, included in the template
+	TaskID      int64  `json:"taskID"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Placeholders turns text into variables, e.g. {"1.2.0": "version"}
+	// saves titles like "Release 1.2.0" as "Release {{version}}"
+	Placeholders map[string]string `json:"placeholders"`
+	Defaults     map[string]string `json:"defaults"`
+	// Overwrite replaces an existing template with the same name
+	Overwrite bool `json:"overwrite"`
+}
+
+// SaveAsTemplate captures an existing subtree as a template
+func SaveAsTemplate(ctx context.Context, req *SaveAsTemplateRequest) (*template.Template, error) {
+	if req.TaskID == 0 {
+		return nil, handle.BadRequest(errors.New("requires taskID"))
+	}
+	if req.Name == "" {
+		return nil, handle.BadRequest(errors.New("requires name"))
+	}
+	all, err := service.LoadTasks("")
+	if err != nil {
+		return nil, err
+	}
+	root := model.FindTask(all, req.TaskID)
+	if root == nil {
+		return nil, wrapError(fmt.Errorf("%w: %d", task.ErrTaskNotFound, req.TaskID))
+	}
+	saved, err := templates.Save(&template.Template{
+		Name:        req.Name,
+		Description: req.Description,
+		Defaults:    req.Defaults,
+		Tasks:       template.Capture([]*model.TaskItem{root}, req.Placeholders),
+	}, req.Overwrite)
+	if err != nil {
+		return nil, handle.BadRequest(err)
+	}
+	return saved, nil
+}
@@ -0,0 +1,172 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/handle"
+	handle_model "github.com/xhd2015/task-banner/server/handle/model"
+	"github.com/xhd2015/task-banner/server/service/task/webhook"
+)
+
+var (
+	webhooks          *webhook.Store
+	webhookDeliveries *webhook.DeliveryLog
+	webhookDispatcher *webhook.Dispatcher
+)
+
+// deliveries kept in the log
+const webhookLogEntries = 1000
+
+// newWebhooks keeps webhooks in TASK_WEBHOOK_FILE, defaults to
+// tasks.webhooks.json for tasks.json, deliveries are logged next to it
+func newWebhooks(tasksFile string) {
+	file := os.Getenv("TASK_WEBHOOK_FILE")
+	if file == "" {
+		file = strings.TrimSuffix(tasksFile, filepath.Ext(tasksFile)) + ".webhooks.json"
+	}
+	webhooks = webhook.NewStore(file)
+	webhookDeliveries = webhook.NewDeliveryLog(strings.TrimSuffix(file, filepath.Ext(file))+".log.jsonl", webhookLogEntries)
+	webhookDispatcher = webhook.NewDispatcher(webhooks, webhookDeliveries, webhook.Options{})
+}
+
+// StartWebhooks starts delivering task events to the webhooks
+func StartWebhooks() {
+	go func() {
+		if err := webhookDispatcher.Run(context.Background(), service); err != nil {
+			log.Printf("webhook dispatcher stopped: %v", err)
+		}
+	}()
+}
+
+const (
+	WebhookActionList   = "list"
+	WebhookActionCreate = "create"
+	WebhookActionUpdate = "update"
+	WebhookActionDelete = "delete"
+)
+
+type WebhooksRequest struct {
+	// Action is list, create, update or delete, list if empty
+	Action string `json:"action"`
+	// ID is the webhook to delete
+	ID string `json:"id"`
+	// Webhook is the webhook to create or update, an empty secret
+	// on update keeps the current one
+	Webhook *webhook.Webhook `json:"webhook"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []*webhook.Webhook `json:"webhooks,omitempty"`
+	Webhook  *webhook.Webhook   `json:"webhook,omitempty"`
+}
+
+// Webhooks lists, creates, updates and deletes webhooks, secrets
+// are only returned on create
+func Webhooks(ctx context.Context, req *WebhooksRequest) (*WebhooksResponse, error) {
+	switch req.Action {
+	case "", WebhookActionList:
+		list, err := webhooks.List()
+		if err != nil {
+			return nil, err
+		}
+		for i, w := range list {
+			list[i] = hideSecret(w)
+		}
+		return &WebhooksResponse{Webhooks: list}, nil
+	case WebhookActionCreate:
+		if req.Webhook == nil {
+			return nil, handle.BadRequest(errors.New("requires webhook"))
+		}
+		created, err := webhooks.Create(req.Webhook)
+		if err != nil {
+			return nil, handle.BadRequest(err)
+		}
+		return &WebhooksResponse{Webhook: created}, nil
+	case WebhookActionUpdate:
+		if req.Webhook == nil || req.Webhook.ID == "" {
+			return nil, handle.BadRequest(errors.New("requires webhook with id"))
+		}
+		w := *req.Webhook
+		if w.Secret == "" {
+			existing, err := webhooks.Get(w.ID)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			w.Secret = existing.Secret
+		}
+		updated, err := webhooks.Update(&w)
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			return nil, wrapError(err)
+		}
+		if err != nil {
+			return nil, handle.BadRequest(err)
+		}
+		return &WebhooksResponse{Webhook: hideSecret(updated)}, nil
+	case WebhookActionDelete:
+		if req.ID == "" {
+			return nil, handle.BadRequest(errors.New("requires id"))
+		}
+		if err := webhooks.Delete(req.ID); err != nil {
+			return nil, wrapError(err)
+		}
+		webhookDispatcher.Remove(req.ID)
+		return &WebhooksResponse{}, nil
+	}
+	return nil, handle.BadRequest(fmt.Errorf("unknown action: %s", req.Action))
+}
+
+func hideSecret(w *webhook.Webhook) *webhook.Webhook {
+	cl := *w
+	cl.Secret = ""
+	return &cl
+}
+
+type WebhookDeliveriesRequest struct {
+	// WebhookID lists the deliveries of one webhook, all if empty
+	WebhookID string `json:"webhookID"`
+	// Limit is 50 by default
+	Limit handle_model.OptionalNumber `json:"limit"`
+}
+
+type WebhookDeliveriesResponse struct {
+	// Deliveries are newest first
+	Deliveries []*webhook.Delivery `json:"deliveries"`
+}
+
+// WebhookDeliveries lists the logged deliveries
+func WebhookDeliveries(ctx context.Context, req *WebhookDeliveriesRequest) (*WebhookDeliveriesResponse, error) {
+	limit, err := req.Limit.Int64()
+	if err != nil {
+		return nil, handle.BadRequest(fmt.Errorf("invalid limit: %w", err))
+	}
+	if limit == 0 {
+		limit = 50
+	}
+	list, err := webhookDeliveries.List(req.WebhookID, int(limit))
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookDeliveriesResponse{Deliveries: list}, nil
+}
+
+type TestWebhookRequest struct {
+	ID string `json:"id"`
+}
+
+// TestWebhook sends a ping to a webhook once and waits for the result
+func TestWebhook(ctx context.Context, req *TestWebhookRequest) (*webhook.Delivery, error) {
+	if req.ID == "" {
+		return nil, handle.BadRequest(errors.New("requires id"))
+	}
+	d, err := webhookDispatcher.Test(ctx, req.ID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return d, nil
+}
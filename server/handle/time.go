@@ -0,0 +1,85 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+const (
+	// TimeFormatHeader selects the format of timestamps in responses,
+	// swift(default) or rfc3339, the timeFormat query parameter takes precedence
+	TimeFormatHeader = "X-Time-Format"
+	// TimeZoneHeader is the IANA time zone of RFC 3339 timestamps, UTC by
+	// default, the timeZone query parameter takes precedence
+	TimeZoneHeader = "X-Time-Zone"
+)
+
+// timeWriter carries the time format negotiated for a request
+// to the functions writing JSON
+type timeWriter struct {
+	http.ResponseWriter
+	format model.TimeFormat
+	loc    *time.Location
+}
+
+// timeZoneKey carries the time zone a request named in its context
+type timeZoneKey struct{}
+
+// TimeZone returns the time zone named by the request of ctx,
+// false if it named none
+func TimeZone(ctx context.Context) (*time.Location, bool) {
+	loc, ok := ctx.Value(timeZoneKey{}).(*time.Location)
+	return loc, ok
+}
+
+func (c *timeWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// NegotiateTime lets each request choose the format of timestamps in the
+// JSON responses of next. Requests accept both formats regardless. The
+// time zone, if named, is passed to next in the context, see TimeZone.
+func NegotiateTime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		formatValue := query.Get("timeFormat")
+		if formatValue == "" {
+			formatValue = r.Header.Get(TimeFormatHeader)
+		}
+		format, err := model.ParseTimeFormat(formatValue)
+		if err != nil {
+			AbortWithErrCode(w, http.StatusBadRequest, err)
+			return
+		}
+		zone := query.Get("timeZone")
+		if zone == "" {
+			zone = r.Header.Get(TimeZoneHeader)
+		}
+		loc := time.UTC
+		if zone != "" {
+			loc, err = time.LoadLocation(zone)
+			if err != nil {
+				AbortWithErrCode(w, http.StatusBadRequest, fmt.Errorf("invalid time zone: %s", zone))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), timeZoneKey{}, loc))
+		}
+		w.Header().Set(TimeFormatHeader, string(format))
+		next.ServeHTTP(&timeWriter{ResponseWriter: w, format: format, loc: loc}, r)
+	})
+}
+
+// MarshalJSON marshals v with the time format negotiated for w
+func MarshalJSON(w http.ResponseWriter, v interface{}) ([]byte, error) {
+	if tw, ok := w.(*timeWriter); ok {
+		return model.MarshalJSONTimes(v, tw.format, tw.loc)
+	}
+	return json.Marshal(v)
+}
@@ -196,7 +196,16 @@ func main() {
 			next(w, r)
 		}
 	}
+	if err := task.Init(); err != nil {
+		log.Fatalf("Failed to initialize tasks: %v", err)
+	}
+	if err := task.MigrateTimes(); err != nil {
+		log.Fatalf("Failed to migrate times: %v", err)
+	}
 	setupTaskAPIs()
+	task.StartMirrors()
+	task.StartWebhooks()
+	task.StartGitScanner()
 
 	http.HandleFunc("/tasks", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -256,16 +265,43 @@ func main() {
 	}).ServeHTTP)
 
 	fmt.Println("Server starting on http://localhost:7021")
-	log.Fatal(http.ListenAndServe(":7021", nil))
+	log.Fatal(http.ListenAndServe(":7021", handle.NegotiateTime(http.DefaultServeMux)))
 }
 
 func setupTaskAPIs() {
 	http.HandleFunc("/api/listTasks", handle.Wrap(task.ListTasks))
+	http.HandleFunc("/api/listChildren", handle.Wrap(task.ListChildren))
+	http.HandleFunc("/api/getTask", handle.Wrap(task.GetTask))
+	http.HandleFunc("/api/getTaskPath", handle.Wrap(task.GetTaskPath))
 	http.HandleFunc("/api/addTask", handle.Wrap(task.AddTask))
 	http.HandleFunc("/api/updateTask", handle.Wrap(task.UpdateTask))
 	http.HandleFunc("/api/removeTask", handle.Wrap(task.RemoveTask))
 	http.HandleFunc("/api/exchangeOrder", handle.Wrap(task.ExchangeOrder))
 	http.HandleFunc("/api/addTaskNote", handle.Wrap(task.AddTaskNote))
 	http.HandleFunc("/api/updateTaskNote", handle.Wrap(task.UpdateTaskNote))
+	http.HandleFunc("/api/cloneTask", handle.Wrap(task.CloneTask))
+	http.HandleFunc("/api/mergeTasks", handle.Wrap(task.MergeTasks))
+	http.HandleFunc("/api/splitTask", handle.Wrap(task.SplitTask))
 	http.HandleFunc("/api/saveTasks", handle.Wrap(task.SaveTasks))
+	http.HandleFunc("/api/getRevision", handle.Wrap(task.GetRevision))
+	http.HandleFunc("/api/events", task.Events)
+	http.HandleFunc("/api/batch", handle.Wrap(task.Batch))
+	http.HandleFunc("/api/sync", handle.Wrap(task.Sync))
+	http.HandleFunc("/api/export", task.Export)
+	http.HandleFunc("/api/import", task.Import)
+	http.HandleFunc("/api/importFile", handle.Wrap(task.ImportFile))
+	http.HandleFunc("/api/export.ics", task.ExportICS)
+	http.HandleFunc("/api/snapshots", handle.Wrap(task.Snapshots))
+	http.HandleFunc("/api/restoreSnapshot", handle.Wrap(task.RestoreSnapshot))
+	http.HandleFunc("/api/templates", handle.Wrap(task.Templates))
+	http.HandleFunc("/api/instantiateTemplate", handle.Wrap(task.InstantiateTemplate))
+	http.HandleFunc("/api/saveAsTemplate", handle.Wrap(task.SaveAsTemplate))
+	http.HandleFunc("/api/extractLinks", handle.Wrap(task.ExtractLinks))
+	http.HandleFunc("/api/findByLink", handle.Wrap(task.FindByLink))
+	http.HandleFunc("/api/webhooks", handle.Wrap(task.Webhooks))
+	http.HandleFunc("/api/webhookDeliveries", handle.Wrap(task.WebhookDeliveries))
+	http.HandleFunc("/api/testWebhook", handle.Wrap(task.TestWebhook))
+	http.HandleFunc("/api/scanCommits", handle.Wrap(task.ScanCommits))
+	http.HandleFunc("/api/report/standup", task.StandupReport)
+	http.HandleFunc("/api/stats", handle.Wrap(task.Stats))
 }
@@ -0,0 +1,53 @@
+package model
+
+type BatchOpType string
+
+const (
+	BatchOpAdd    BatchOpType = "add"
+	BatchOpUpdate BatchOpType = "update"
+	BatchOpRemove BatchOpType = "remove"
+	BatchOpMove   BatchOpType = "move"
+	BatchOpNote   BatchOpType = "note"
+)
+
+// BatchOperation is one step of a batch, the target task is given either
+// by TaskID or by TaskRef, which names a task added earlier in the same batch.
+type BatchOperation struct {
+	Op BatchOpType `json:"op"`
+
+	// Ref names the task created by an add operation
+	Ref string `json:"ref,omitempty"`
+
+	TaskID  int64  `json:"taskID,omitempty"`
+	TaskRef string `json:"taskRef,omitempty"`
+
+	// ParentID or ParentRef is the parent for add and move,
+	// 0 means top level. For add, Task.ParentID is used if both are empty.
+	ParentID  int64  `json:"parentID,omitempty"`
+	ParentRef string `json:"parentRef,omitempty"`
+	// Index is the position among the new siblings for add and move,
+	// negative means the end. Add defaults to the front, move to the end.
+	Index *int `json:"index,omitempty"`
+
+	// Task is the task to add without subtasks, add them by
+	// their own operations with ParentRef
+	Task *TaskItem `json:"task,omitempty"`
+	// Update is applied by update
+	Update *TaskUpdate `json:"update,omitempty"`
+
+	// Note is appended by note, or replaces the note at NoteIndex if given
+	Note      string `json:"note,omitempty"`
+	NoteIndex *int   `json:"noteIndex,omitempty"`
+
+	// ExpectedRevision fails the batch with a conflict if the target task
+	// has been modified since, not applicable to add
+	ExpectedRevision *int64 `json:"expectedRevision,omitempty"`
+}
+
+type BatchResult struct {
+	Op     BatchOpType `json:"op"`
+	TaskID int64       `json:"taskID"`
+	Ref    string      `json:"ref,omitempty"`
+	// Task is the task created by add
+	Task *TaskItem `json:"task,omitempty"`
+}
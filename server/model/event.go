@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+type TaskEventType string
+
+const (
+	TaskEventAdded     TaskEventType = "task.added"
+	TaskEventUpdated   TaskEventType = "task.updated"
+	TaskEventRemoved   TaskEventType = "task.removed"
+	TaskEventReordered TaskEventType = "task.reordered"
+	// TaskEventMoved is emitted when a task gets another parent,
+	// ParentID and Index tell its new place
+	TaskEventMoved TaskEventType = "task.moved"
+	TaskEventNote  TaskEventType = "note.changed"
+	// TaskEventReplaced is emitted when all tasks are saved at once,
+	// clients should reload
+	TaskEventReplaced TaskEventType = "tasks.replaced"
+)
+
+// TaskEvent describes a committed change of a task
+type TaskEvent struct {
+	ID       int64         `json:"id"`
+	Type     TaskEventType `json:"type"`
+	Time     time.Time     `json:"time"`
+	TaskID   int64         `json:"taskID,omitempty"`
+	ParentID int64         `json:"parentID,omitempty"`
+	Mode     TaskMode      `json:"mode,omitempty"`
+	// Task is the task after the change without subtasks, nil if removed
+	Task *TaskItem `json:"task,omitempty"`
+	// Index is the position among siblings of task.added, task.reordered and task.moved
+	Index *int `json:"index,omitempty"`
+	// NoteIndex is the changed note of note.changed
+	NoteIndex *int `json:"noteIndex,omitempty"`
+	// PreviousStatus is set on task.updated if the status changed
+	PreviousStatus *TaskStatus `json:"previousStatus,omitempty"`
+	// Revision is the store revision the change committed in
+	Revision int64 `json:"revision"`
+}
+
+// MatchMode reports whether the event is visible in mode,
+// following the same rule as loading tasks by mode
+func (c *TaskEvent) MatchMode(mode TaskMode) bool {
+	if mode == "" || mode == TaskModeShared {
+		return true
+	}
+	return c.Mode == mode || c.Mode == "" || c.Mode == TaskModeShared
+}
@@ -0,0 +1,52 @@
+package model
+
+// LinkKind tells what a link points to
+type LinkKind string
+
+const (
+	LinkKindPR        LinkKind = "pr"
+	LinkKindIssue     LinkKind = "issue"
+	LinkKindCommit    LinkKind = "commit"
+	LinkKindDashboard LinkKind = "dashboard"
+	LinkKindDoc       LinkKind = "doc"
+	LinkKindOther     LinkKind = "other"
+)
+
+// TaskLink is a reference from a task to something outside,
+// such as a pull request or a dashboard
+type TaskLink struct {
+	URL   string   `json:"url"`
+	Title string   `json:"title,omitempty"`
+	Kind  LinkKind `json:"kind,omitempty"`
+	// ExternalID names the target independent of its URL,
+	// e.g. github:owner/repo#12 or jira:PROJ-12
+	ExternalID string `json:"externalID,omitempty"`
+}
+
+// SameLinks compares two link lists, order matters
+func SameLinks(a []*TaskLink, b []*TaskLink) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if (a[i] == nil) != (b[i] == nil) || (a[i] != nil && *a[i] != *b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// CloneLinks copies the list together with its links
+func CloneLinks(links []*TaskLink) []*TaskLink {
+	if links == nil {
+		return nil
+	}
+	cl := make([]*TaskLink, len(links))
+	for i, link := range links {
+		if link != nil {
+			l := *link
+			cl[i] = &l
+		}
+	}
+	return cl
+}
@@ -0,0 +1,25 @@
+package model
+
+// CloneOptions tells where the copy of a subtree goes and how
+type CloneOptions struct {
+	// ParentID is the parent of the copy, the parent of the original if nil
+	ParentID *int64 `json:"parentID,omitempty"`
+	// Index is the position among the new siblings, negative means the end.
+	// Defaults to right after the original, or the end under another parent.
+	Index *int `json:"index,omitempty"`
+	// Title replaces the title of the copied root if not empty
+	Title string `json:"title,omitempty"`
+	// ResetStatus makes the copies fresh: created now, not done,
+	// with a new history
+	ResetStatus bool `json:"resetStatus,omitempty"`
+}
+
+// SplitOptions selects what of a task becomes new siblings placed right
+// after it, notes first, each in the given order
+type SplitOptions struct {
+	// NoteIndexes are the notes turned into tasks, the first line of a note
+	// is the title, the remaining lines its note
+	NoteIndexes []int `json:"noteIndexes,omitempty"`
+	// SubTaskIDs are direct subtasks moved up to be siblings
+	SubTaskIDs []int64 `json:"subTaskIDs,omitempty"`
+}
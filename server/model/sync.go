@@ -0,0 +1,34 @@
+package model
+
+type SyncOpStatus string
+
+const (
+	SyncOpApplied SyncOpStatus = "applied"
+	// SyncOpConflict means the task has been modified on the server since the
+	// client's expected revision, the server state is kept
+	SyncOpConflict SyncOpStatus = "conflict"
+	// SyncOpRejected means the operation cannot be applied, e.g. the task is removed
+	SyncOpRejected SyncOpStatus = "rejected"
+)
+
+type SyncOpResult struct {
+	BatchResult
+	Status SyncOpStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	// Current is the server state of a conflicting task
+	Current *TaskItem `json:"current,omitempty"`
+}
+
+type SyncResult struct {
+	// Cursor is the id of the last change the client has now seen
+	Cursor int64 `json:"cursor"`
+	// Reset is set if the client's cursor is too old to catch up with changes,
+	// Tasks then holds all tasks and the client should replace its copy
+	Reset bool        `json:"reset"`
+	Tasks []*TaskItem `json:"tasks,omitempty"`
+	// Changes are the changes after the client's cursor, including
+	// the ones resulted from the client's operations
+	Changes []*TaskEvent `json:"changes"`
+	// Results has one entry per client operation
+	Results []*SyncOpResult `json:"results"`
+}
@@ -7,6 +7,8 @@ type TaskMode string
 const (
 	TaskModeWork TaskMode = "work"
 	TaskModeLife TaskMode = "life"
+	// TaskModeShared shows the task in every mode, the same as no mode
+	TaskModeShared TaskMode = "shared"
 )
 
 type TaskStatus string
@@ -23,11 +25,40 @@ type TaskItem struct {
 	ID        int64          `json:"id"`
 	Title     string         `json:"title"`
 	StartTime SwiftTimestamp `json:"startTime"`
+	DueTime   SwiftTimestamp `json:"dueTime,omitempty"`
 	ParentID  int64          `json:"parentID"`
 	SubTasks  []*TaskItem    `json:"subTasks"`
 	Mode      TaskMode       `json:"mode"`
 	Status    TaskStatus     `json:"status"`
 	Notes     []string       `json:"notes"`
+	// DoneTime is when the task was last marked done, 0 if not done
+	DoneTime SwiftTimestamp `json:"doneTime,omitempty"`
+	// Priority is A(highest) to Z, empty means none
+	Priority string `json:"priority,omitempty"`
+	// ExternalID identifies the task in the tool it was imported from,
+	// e.g. jira:PROJ-12, so it is not imported twice
+	ExternalID string `json:"externalID,omitempty"`
+	// Links are references to pull requests, dashboards, docs and such
+	Links []*TaskLink `json:"links,omitempty"`
+	// StatusHistory lists the status changes oldest first,
+	// starting with the initial status
+	StatusHistory []*StatusChange `json:"statusHistory,omitempty"`
+	// NoteTimes[i] is when Notes[i] was added, 0 if unknown
+	NoteTimes []SwiftTimestamp `json:"noteTimes,omitempty"`
+	// Revision is bumped on every modification of the task
+	Revision int64 `json:"revision,omitempty"`
+
+	// ChildCount and DescendantCount are filled when listing,
+	// so clients can tell a node has children even if they are not loaded
+	ChildCount      int `json:"childCount,omitempty"`
+	DescendantCount int `json:"descendantCount,omitempty"`
+}
+
+// StatusChange is a status transition, From is empty for the initial status
+type StatusChange struct {
+	From TaskStatus     `json:"from,omitempty"`
+	To   TaskStatus     `json:"to"`
+	Time SwiftTimestamp `json:"time"`
 }
 
 type TaskUpdate struct {
@@ -35,6 +66,12 @@ type TaskUpdate struct {
 	Status *string `json:"status"`
 	Notes  *string `json:"notes"`
 	Mode   *string `json:"mode"`
+	// DueTime sets the deadline, 0 clears it
+	DueTime *SwiftTimestamp `json:"dueTime"`
+	// Priority sets A to Z, empty clears it
+	Priority *string `json:"priority"`
+	// Links replaces all links, empty clears them
+	Links *[]*TaskLink `json:"links"`
 }
 
 // ConvertSwiftTimestamp converts a Swift timestamp (seconds since January 1, 2001) to a Go time.Time
@@ -46,6 +83,12 @@ func ConvertSwiftTimestamp(swiftTimestamp SwiftTimestamp) time.Time {
 	return goTime
 }
 
+// ToSwiftTimestamp converts a Go time.Time to a Swift timestamp
+func ToSwiftTimestamp(t time.Time) SwiftTimestamp {
+	swiftReferenceDate := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	return SwiftTimestamp(t.Sub(swiftReferenceDate).Seconds())
+}
+
 func (c *TaskItem) ShallowClone() *TaskItem {
 	if c == nil {
 		return nil
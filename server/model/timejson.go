@@ -0,0 +1,243 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	swiftTimestampType = reflect.TypeOf(SwiftTimestamp(0))
+	marshalerType      = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// MarshalJSONTimes marshals v like json.Marshal, with every SwiftTimestamp
+// of v written in format. RFC 3339 times are in loc, nil for UTC.
+//
+// The output of json.Marshal is rewritten guided by the Go type of v, the
+// order of the fields is kept.
+func MarshalJSONTimes(v interface{}, format TimeFormat, loc *time.Location) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || format != TimeFormatRFC3339 {
+		return data, err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	node = rewriteTimes(node, reflect.ValueOf(v), loc)
+	var buf bytes.Buffer
+	if err := encodeNode(&buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonObject keeps the fields of a JSON object in order
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func decodeNode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key: %v", keyTok)
+			}
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{key: key, value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return tok, nil
+}
+
+func encodeNode(w io.Writer, node interface{}) error {
+	switch v := node.(type) {
+	case jsonObject:
+		io.WriteString(w, "{")
+		for i, f := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			key, _ := json.Marshal(f.key)
+			w.Write(key)
+			io.WriteString(w, ":")
+			if err := encodeNode(w, f.value); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "}")
+		return err
+	case []interface{}:
+		io.WriteString(w, "[")
+		for i, item := range v {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			if err := encodeNode(w, item); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]")
+		return err
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// rewriteTimes replaces the numbers of node standing for a SwiftTimestamp
+// in v, walking both together
+func rewriteTimes(node interface{}, v reflect.Value, loc *time.Location) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return node
+		}
+		v = v.Elem()
+	}
+	t := v.Type()
+	if t == swiftTimestampType {
+		if _, ok := node.(json.Number); !ok {
+			return node
+		}
+		if s := SwiftTimestamp(v.Float()).Format(loc); s != "" {
+			return s
+		}
+		return nil
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return node
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := node.(jsonObject)
+		if !ok {
+			return node
+		}
+		fields := jsonFieldsOf(t)
+		for i, f := range obj {
+			index, ok := fields[f.key]
+			if !ok {
+				continue
+			}
+			fv, err := v.FieldByIndexErr(index)
+			if err != nil {
+				continue
+			}
+			obj[i].value = rewriteTimes(f.value, fv, loc)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := node.([]interface{})
+		if !ok {
+			return node
+		}
+		for i := range arr {
+			if i < v.Len() {
+				arr[i] = rewriteTimes(arr[i], v.Index(i), loc)
+			}
+		}
+	case reflect.Map:
+		obj, ok := node.(jsonObject)
+		if !ok || t.Key().Kind() != reflect.String {
+			return node
+		}
+		for i, f := range obj {
+			mv := v.MapIndex(reflect.ValueOf(f.key).Convert(t.Key()))
+			if mv.IsValid() {
+				obj[i].value = rewriteTimes(f.value, mv, loc)
+			}
+		}
+	}
+	return node
+}
+
+var jsonFieldsCache sync.Map
+
+// jsonFieldsOf maps the JSON names of the fields of a struct type,
+// including those of embedded structs, to their index
+func jsonFieldsOf(t reflect.Type) map[string][]int {
+	if cached, ok := jsonFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	var collect func(t reflect.Type, prefix []int)
+	collect = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			index := append(prefix[:len(prefix):len(prefix)], i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				collect(ft, index)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			// a shallower field hides a deeper one, like encoding/json
+			if existing, ok := fields[name]; !ok || len(index) < len(existing) {
+				fields[name] = index
+			}
+		}
+	}
+	collect(t, nil)
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
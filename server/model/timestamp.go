@@ -0,0 +1,85 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat is how timestamps are written in JSON
+type TimeFormat string
+
+const (
+	// TimeFormatSwift writes seconds since 2001-01-01 UTC as numbers, the
+	// default of the API as expected by the Swift app
+	TimeFormatSwift TimeFormat = "swift"
+	// TimeFormatRFC3339 writes strings like 2024-05-01T09:30:00+08:00,
+	// zero timestamps as null
+	TimeFormatRFC3339 TimeFormat = "rfc3339"
+)
+
+func ParseTimeFormat(s string) (TimeFormat, error) {
+	switch format := TimeFormat(strings.ToLower(s)); format {
+	case "":
+		return TimeFormatSwift, nil
+	case TimeFormatSwift, TimeFormatRFC3339:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown time format: %s, expect swift or rfc3339", s)
+}
+
+// UnmarshalJSON reads both formats: a number of seconds since 2001, or an
+// RFC 3339 string. null and "" are zero.
+func (c *SwiftTimestamp) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || string(data) == "null" {
+		*c = 0
+		return nil
+	}
+	if data[0] != '"' {
+		v, err := strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %s", data)
+		}
+		*c = SwiftTimestamp(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	ts, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	*c = ts
+	return nil
+}
+
+// ParseTimestamp parses an RFC 3339 time, or a number of seconds since 2001
+// as sent in query strings, empty is zero
+func ParseTimestamp(s string) (SwiftTimestamp, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return SwiftTimestamp(v), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %s, expect RFC 3339 like 2006-01-02T15:04:05Z07:00", s)
+	}
+	return ToSwiftTimestamp(t), nil
+}
+
+// Format formats the timestamp as RFC 3339 in loc, empty if zero
+func (c SwiftTimestamp) Format(loc *time.Location) string {
+	if c == 0 {
+		return ""
+	}
+	return ConvertSwiftTimestamp(c).In(loc).Format(time.RFC3339Nano)
+}
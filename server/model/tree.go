@@ -0,0 +1,88 @@
+package model
+
+// WalkTasks visits tasks in depth-first pre-order, depth starts at 0.
+// Returning false from fn skips the subtasks of that task.
+func WalkTasks(tasks []*TaskItem, fn func(task *TaskItem, depth int) bool) {
+	var walk func(tasks []*TaskItem, depth int)
+	walk = func(tasks []*TaskItem, depth int) {
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			if !fn(task, depth) {
+				continue
+			}
+			walk(task.SubTasks, depth+1)
+		}
+	}
+	walk(tasks, 0)
+}
+
+// FindTask finds the task with the given id in the tree
+func FindTask(tasks []*TaskItem, id int64) *TaskItem {
+	var found *TaskItem
+	WalkTasks(tasks, func(task *TaskItem, depth int) bool {
+		if found != nil {
+			return false
+		}
+		if task.ID == id {
+			found = task
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// FindTaskPath returns the tasks from the root down to the task with the given id,
+// or nil if not found
+func FindTaskPath(tasks []*TaskItem, id int64) []*TaskItem {
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		if task.ID == id {
+			return []*TaskItem{task}
+		}
+		if path := FindTaskPath(task.SubTasks, id); path != nil {
+			return append([]*TaskItem{task}, path...)
+		}
+	}
+	return nil
+}
+
+// DeepClone copies the task together with all its subtasks and notes
+func (c *TaskItem) DeepClone() *TaskItem {
+	if c == nil {
+		return nil
+	}
+	cl := *c
+	if c.Notes != nil {
+		cl.Notes = make([]string, len(c.Notes))
+		copy(cl.Notes, c.Notes)
+	}
+	if c.NoteTimes != nil {
+		cl.NoteTimes = make([]SwiftTimestamp, len(c.NoteTimes))
+		copy(cl.NoteTimes, c.NoteTimes)
+	}
+	cl.Links = CloneLinks(c.Links)
+	if c.StatusHistory != nil {
+		cl.StatusHistory = make([]*StatusChange, len(c.StatusHistory))
+		for i, change := range c.StatusHistory {
+			if change != nil {
+				ch := *change
+				cl.StatusHistory[i] = &ch
+			}
+		}
+	}
+	if c.SubTasks != nil {
+		cl.SubTasks = make([]*TaskItem, 0, len(c.SubTasks))
+		for _, sub := range c.SubTasks {
+			if sub == nil {
+				continue
+			}
+			cl.SubTasks = append(cl.SubTasks, sub.DeepClone())
+		}
+	}
+	return &cl
+}
@@ -0,0 +1,49 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// ErrInvalidOperation is wrapped by operations rejected for their
+// arguments, such as merging a task into its own subtree
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// BatchOpError reports the operation that failed a batch
+type BatchOpError struct {
+	Index int
+	Op    model.BatchOpType
+	Err   error
+}
+
+func (c *BatchOpError) Error() string {
+	return fmt.Sprintf("op[%d] %s: %v", c.Index, c.Op, c.Err)
+}
+
+func (c *BatchOpError) Unwrap() error {
+	return c.Err
+}
+
+// ConflictError is returned when the client's expected revision
+// does not match, it carries the current state on the server
+type ConflictError struct {
+	// TaskID is 0 if the revision of the whole store mismatches
+	TaskID           int64 `json:"taskID"`
+	ExpectedRevision int64 `json:"expectedRevision"`
+	ActualRevision   int64 `json:"actualRevision"`
+	// Task is the current task for a task conflict
+	Task *model.TaskItem `json:"task,omitempty"`
+	// Tasks is the current store for a store conflict
+	Tasks []*model.TaskItem `json:"tasks,omitempty"`
+}
+
+func (c *ConflictError) Error() string {
+	if c.TaskID == 0 {
+		return fmt.Sprintf("conflict: store is at revision %d, expected %d", c.ActualRevision, c.ExpectedRevision)
+	}
+	return fmt.Sprintf("conflict: task %d is at revision %d, expected %d", c.TaskID, c.ActualRevision, c.ExpectedRevision)
+}
@@ -0,0 +1,115 @@
+// Package event fans out committed task changes to subscribers
+package event
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// subscriberBuffer is the number of events a subscriber may lag behind,
+// a subscriber falling further behind is dropped and has to resume
+const subscriberBuffer = 256
+
+type Bus struct {
+	mu       sync.Mutex
+	lastID   int64
+	capacity int
+	// history keeps the most recent events for resuming
+	history []*model.TaskEvent
+	subs    map[*Subscription]bool
+}
+
+type Subscription struct {
+	// Replay holds the events after the requested id that were already published
+	Replay []*model.TaskEvent
+	// Missed is set if some events after the requested id are no longer kept,
+	// the subscriber should reload everything
+	Missed bool
+	// C delivers new events, it is closed if the subscriber lags behind
+	C <-chan *model.TaskEvent
+
+	bus *Bus
+	ch  chan *model.TaskEvent
+}
+
+// NewBus creates a bus keeping at most capacity events for resuming
+func NewBus(capacity int) *Bus {
+	return &Bus{
+		capacity: capacity,
+		subs:     make(map[*Subscription]bool),
+	}
+}
+
+// Publish delivers events to all subscribers, events without id are
+// assigned ones following the last id
+func (c *Bus) Publish(events ...*model.TaskEvent) {
+	if len(events) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, ev := range events {
+		if ev.ID == 0 {
+			ev.ID = c.lastID + 1
+		}
+		c.lastID = ev.ID
+		if ev.Time.IsZero() {
+			ev.Time = now
+		}
+		c.history = append(c.history, ev)
+		for sub := range c.subs {
+			select {
+			case sub.ch <- ev:
+			default:
+				// lagging behind, drop it
+				delete(c.subs, sub)
+				close(sub.ch)
+			}
+		}
+	}
+	if len(c.history) > c.capacity {
+		c.history = append([]*model.TaskEvent(nil), c.history[len(c.history)-c.capacity:]...)
+	}
+}
+
+// Subscribe subscribes to events after lastEventID, 0 means only new events
+func (c *Bus) Subscribe(lastEventID int64) *Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan *model.TaskEvent, subscriberBuffer)
+	sub := &Subscription{
+		C:   ch,
+		bus: c,
+		ch:  ch,
+	}
+	if lastEventID > 0 {
+		if lastEventID > c.lastID {
+			// the id comes from before a restart
+			sub.Missed = true
+		} else if len(c.history) > 0 && c.history[0].ID > lastEventID+1 {
+			sub.Missed = true
+		}
+		if !sub.Missed {
+			for _, ev := range c.history {
+				if ev.ID > lastEventID {
+					sub.Replay = append(sub.Replay, ev)
+				}
+			}
+		}
+	}
+	c.subs[sub] = true
+	return sub
+}
+
+// Close stops receiving events
+func (c *Subscription) Close() {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+	if c.bus.subs[c] {
+		delete(c.bus.subs, c)
+		close(c.ch)
+	}
+}
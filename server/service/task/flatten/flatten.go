@@ -0,0 +1,204 @@
+// Package flatten turns task trees into table rows, one row per task,
+// for spreadsheets and the command line.
+package flatten
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/query"
+)
+
+type Column string
+
+const (
+	ColumnID        Column = "id"
+	ColumnParentID  Column = "parentID"
+	ColumnPath      Column = "path"
+	ColumnDepth     Column = "depth"
+	ColumnTitle     Column = "title"
+	ColumnMode      Column = "mode"
+	ColumnStatus    Column = "status"
+	ColumnPriority  Column = "priority"
+	ColumnStartTime Column = "startTime"
+	ColumnDueTime   Column = "dueTime"
+	ColumnDoneTime  Column = "doneTime"
+	ColumnNoteCount Column = "noteCount"
+	ColumnNotes     Column = "notes"
+)
+
+// DefaultColumns are used when no column is selected
+var DefaultColumns = []Column{
+	ColumnID,
+	ColumnParentID,
+	ColumnPath,
+	ColumnDepth,
+	ColumnTitle,
+	ColumnMode,
+	ColumnStatus,
+	ColumnStartTime,
+	ColumnNoteCount,
+	ColumnNotes,
+}
+
+var allColumns = append(DefaultColumns[:len(DefaultColumns):len(DefaultColumns)],
+	ColumnPriority,
+	ColumnDueTime,
+	ColumnDoneTime,
+)
+
+// PathSeparator joins the titles of the ancestors
+const PathSeparator = " / "
+
+// NoteSeparator joins the notes of a task
+const NoteSeparator = "\n---\n"
+
+// Row is a task together with its position in the tree
+type Row struct {
+	Task  *model.TaskItem
+	Depth int
+	// Path is the titles of the ancestors from the top level, excluding the task itself
+	Path []string
+}
+
+// Flatten lists all tasks in tree order, tasks not matching q are
+// left out, but still count as ancestors of their subtasks
+func Flatten(tasks []*model.TaskItem, q *query.Query) []*Row {
+	rows := make([]*Row, 0)
+	var walk func(tasks []*model.TaskItem, depth int, path []string)
+	walk = func(tasks []*model.TaskItem, depth int, path []string) {
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			if q.Match(task) {
+				rows = append(rows, &Row{Task: task, Depth: depth, Path: path})
+			}
+			walk(task.SubTasks, depth+1, append(path[:len(path):len(path)], task.Title))
+		}
+	}
+	walk(tasks, 0, nil)
+	return rows
+}
+
+// ParseColumns parses a comma separated list of columns, case insensitive.
+// An empty string yields DefaultColumns, `all` every column.
+func ParseColumns(s string) ([]Column, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultColumns, nil
+	}
+	if strings.EqualFold(s, "all") {
+		return allColumns, nil
+	}
+	var columns []Column
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		column, ok := findColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func findColumn(name string) (Column, bool) {
+	for _, column := range allColumns {
+		if strings.EqualFold(string(column), name) {
+			return column, true
+		}
+	}
+	return "", false
+}
+
+// Value formats the column of a row, times are RFC 3339 in local time
+func (c Column) Value(row *Row) string {
+	task := row.Task
+	switch c {
+	case ColumnID:
+		return strconv.FormatInt(task.ID, 10)
+	case ColumnParentID:
+		if task.ParentID == 0 {
+			return ""
+		}
+		return strconv.FormatInt(task.ParentID, 10)
+	case ColumnPath:
+		return strings.Join(row.Path, PathSeparator)
+	case ColumnDepth:
+		return strconv.Itoa(row.Depth)
+	case ColumnTitle:
+		return task.Title
+	case ColumnMode:
+		return string(task.Mode)
+	case ColumnStatus:
+		return string(task.Status)
+	case ColumnPriority:
+		return task.Priority
+	case ColumnStartTime:
+		return formatTime(task.StartTime)
+	case ColumnDueTime:
+		return formatTime(task.DueTime)
+	case ColumnDoneTime:
+		return formatTime(task.DoneTime)
+	case ColumnNoteCount:
+		return strconv.Itoa(len(task.Notes))
+	case ColumnNotes:
+		return strings.Join(task.Notes, NoteSeparator)
+	}
+	return ""
+}
+
+// Numeric reports whether the column holds numbers
+func (c Column) Numeric() bool {
+	switch c {
+	case ColumnID, ColumnParentID, ColumnDepth, ColumnNoteCount:
+		return true
+	}
+	return false
+}
+
+func formatTime(ts model.SwiftTimestamp) string {
+	if ts == 0 {
+		return ""
+	}
+	return model.ConvertSwiftTimestamp(ts).Local().Format(time.RFC3339)
+}
+
+// Table returns the header followed by one line per row.
+// Text starting like a formula is escaped, see EscapeFormula.
+func Table(rows []*Row, columns []Column) [][]string {
+	table := make([][]string, 0, len(rows)+1)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = string(column)
+	}
+	table = append(table, header)
+	for _, row := range rows {
+		line := make([]string, len(columns))
+		for i, column := range columns {
+			value := column.Value(row)
+			if !column.Numeric() {
+				value = EscapeFormula(value)
+			}
+			line[i] = value
+		}
+		table = append(table, line)
+	}
+	return table
+}
+
+// EscapeFormula prefixes text starting with =, +, -, @, tab or carriage
+// return with ', so spreadsheets do not evaluate a title as a formula
+func EscapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package flatten
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"Deploy":               "Deploy",
+		"=HYPERLINK(\"x\")":    "'=HYPERLINK(\"x\")",
+		"+1":                   "'+1",
+		"-2 days":              "'-2 days",
+		"@SUM(A1)":             "'@SUM(A1)",
+		"\tindented":           "'\tindented",
+		"\rcarriage":           "'\rcarriage",
+		"a = b":                "a = b",
+		"2026-09-01T10:00:00Z": "2026-09-01T10:00:00Z",
+	}
+	for s, expect := range tests {
+		if actual := EscapeFormula(s); actual != expect {
+			t.Errorf("EscapeFormula(%q): expect %q, actual: %q", s, expect, actual)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{ID: 1, Title: "=cmd|' /C calc'!A0", SubTasks: []*model.TaskItem{
+			{ID: 2, ParentID: 1, Title: "-child", Notes: []string{"+note"}},
+		}},
+	}
+	columns := []Column{ColumnID, ColumnParentID, ColumnPath, ColumnTitle, ColumnNotes}
+	table := Table(Flatten(tasks, nil), columns)
+	expect := [][]string{
+		{"id", "parentID", "path", "title", "notes"},
+		{"1", "", "", "'=cmd|' /C calc'!A0", ""},
+		{"2", "1", "'=cmd|' /C calc'!A0", "'-child", "'+note"},
+	}
+	if !reflect.DeepEqual(table, expect) {
+		t.Fatalf("expect %q, actual: %q", expect, table)
+	}
+}
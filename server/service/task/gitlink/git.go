@@ -0,0 +1,156 @@
+package gitlink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is a commit read from a repository
+type Commit struct {
+	Hash    string
+	Author  string
+	Time    time.Time
+	Subject string
+	// Message is the full message, including the subject
+	Message string
+}
+
+// ShortHash is the first 8 characters of the hash
+func (c *Commit) ShortHash() string {
+	if len(c.Hash) > 8 {
+		return c.Hash[:8]
+	}
+	return c.Hash
+}
+
+const (
+	fieldSep  = "\x1f"
+	recordSep = "\x1e"
+	logFormat = "%H%x1f%an%x1f%at%x1f%B%x1e"
+)
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// head returns the hash of HEAD
+func head(ctx context.Context, dir string) (string, error) {
+	out, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// readLog reads the commits after since up to head oldest first. If since
+// is empty or no longer an ancestor of head, e.g. after a rebase, the last
+// maxCommits commits are read instead.
+func readLog(ctx context.Context, dir string, since string, head string, maxCommits int) ([]*Commit, error) {
+	args := []string{"log", "--format=" + logFormat, "--reverse"}
+	if since != "" && isAncestor(ctx, dir, since, head) {
+		args = append(args, since+".."+head)
+	} else {
+		args = append(args, "-n", strconv.Itoa(maxCommits), head)
+	}
+	out, err := git(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []*Commit
+	for _, record := range strings.Split(out, recordSep) {
+		record = strings.Trim(record, "\n")
+		if record == "" {
+			continue
+		}
+		fields := strings.SplitN(record, fieldSep, 4)
+		if len(fields) != 4 {
+			continue
+		}
+		c := &Commit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Message: strings.TrimSpace(fields[3]),
+		}
+		if sec, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			c.Time = time.Unix(sec, 0).UTC()
+		}
+		c.Subject, _, _ = strings.Cut(c.Message, "\n")
+		c.Subject = strings.TrimSpace(c.Subject)
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+func isAncestor(ctx context.Context, dir string, ancestor string, head string) bool {
+	_, err := git(ctx, dir, "merge-base", "--is-ancestor", ancestor, head)
+	return err == nil
+}
+
+// remoteURL returns the URL of the origin remote, empty if none
+func remoteURL(ctx context.Context, dir string) string {
+	out, err := git(ctx, dir, "remote", "get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// webURL turns a remote like git@github.com:owner/repo.git or
+// https://github.com/owner/repo.git into https://github.com/owner/repo,
+// empty if the remote is not recognized
+func webURL(remote string) string {
+	var host, path string
+	if !strings.Contains(remote, "://") {
+		// scp-like syntax: [user@]host:path
+		at := strings.LastIndex(remote, "@")
+		hostPath := remote[at+1:]
+		var ok bool
+		host, path, ok = strings.Cut(hostPath, ":")
+		if !ok {
+			return ""
+		}
+	} else {
+		u, err := url.Parse(remote)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		switch u.Scheme {
+		case "http", "https", "ssh", "git":
+		default:
+			return ""
+		}
+		host = u.Hostname()
+		path = u.Path
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || path == "" {
+		return ""
+	}
+	return "https://" + host + "/" + path
+}
+
+// commitURL returns the web page of a commit, empty if the remote
+// is not recognized
+func commitURL(remote string, hash string) string {
+	web := webURL(remote)
+	if web == "" {
+		return ""
+	}
+	if strings.Contains(web, "gitlab") {
+		return web + "/-/commit/" + hash
+	}
+	return web + "/commit/" + hash
+}
@@ -0,0 +1,75 @@
+// Package gitlink links git commits to the tasks their messages refer
+// to, like "task #12" or "fixes task #12", by scanning local repositories.
+// A bare "#12" is left alone, it usually names an issue. So is "fixes #12",
+// unless fixes are enabled to mark tasks done.
+package gitlink
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const (
+	fixKeyword = `fix(?:es|ed)?|close[sd]?|resolve[sd]?`
+	idList     = `#\d+(?:(?:\s*,\s*|\s+and\s+|\s+)#\d+)*`
+)
+
+var (
+	// refRegex matches the task keyword, optionally after a fix keyword,
+	// followed by one or more task IDs, e.g. "task #12", "tasks #1, #2",
+	// "fixes task #3", "closes tasks #3 and #4"
+	refRegex = regexp.MustCompile(`(?i)\b(?:(` + fixKeyword + `)\s+)?tasks?\b:?\s*(` + idList + `)`)
+	// fixRegex matches a fix keyword directly followed by task IDs,
+	// e.g. "fixes #12", "closes #3 and #4"
+	fixRegex = regexp.MustCompile(`(?i)\b(?:` + fixKeyword + `)\b:?\s*(` + idList + `)`)
+	idRegex  = regexp.MustCompile(`#(\d+)`)
+)
+
+// Ref is a task referred to by a commit message
+type Ref struct {
+	TaskID int64
+	// Fixes is set if a keyword like fixes, closes or resolves
+	// precedes the task keyword
+	Fixes bool
+}
+
+// ParseRefs finds the tasks referred to in a commit message, in order
+// of appearance without duplicates. With fixes, a fix keyword directly
+// before IDs like "fixes #12" also refers to the tasks.
+func ParseRefs(message string, fixes bool) []*Ref {
+	type match struct {
+		pos   int
+		ids   string
+		fixes bool
+	}
+	var matches []match
+	for _, m := range refRegex.FindAllStringSubmatchIndex(message, -1) {
+		matches = append(matches, match{pos: m[0], ids: message[m[4]:m[5]], fixes: m[2] >= 0})
+	}
+	if fixes {
+		for _, m := range fixRegex.FindAllStringSubmatchIndex(message, -1) {
+			matches = append(matches, match{pos: m[0], ids: message[m[2]:m[3]], fixes: true})
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].pos < matches[j].pos })
+	}
+
+	var refs []*Ref
+	byID := make(map[int64]*Ref)
+	for _, m := range matches {
+		for _, id := range idRegex.FindAllStringSubmatch(m.ids, -1) {
+			taskID, err := strconv.ParseInt(id[1], 10, 64)
+			if err != nil || taskID <= 0 {
+				continue
+			}
+			if ref := byID[taskID]; ref != nil {
+				ref.Fixes = ref.Fixes || m.fixes
+				continue
+			}
+			ref := &Ref{TaskID: taskID, Fixes: m.fixes}
+			byID[taskID] = ref
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
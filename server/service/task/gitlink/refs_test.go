@@ -0,0 +1,52 @@
+package gitlink
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRefs(t *testing.T) {
+	tests := []struct {
+		message string
+		// fixes enables fix keywords without the task keyword
+		fixes bool
+		// expect lists the refs as id, with a trailing ! if fixed
+		expect string
+	}{
+		{message: "Add login page, task #12", expect: "12"},
+		{message: "Task: #3", expect: "3"},
+		{message: "tasks #1, #2 and #4", expect: "1,2,4"},
+		{message: "Fixes task #7", expect: "7!"},
+		{message: "closes tasks #3 #5", expect: "3!,5!"},
+		{message: "resolved task #9\n\ntask #9 again", expect: "9!"},
+		{message: "task #4, then fixes task #4", expect: "4!"},
+		{message: "fixes #12", expect: ""},
+		{message: "Merge pull request #34 from feature", expect: ""},
+		{message: "refs #1, see subtask #2", expect: ""},
+		{message: "task #0", expect: ""},
+		{message: "fixes #12", fixes: true, expect: "12!"},
+		{message: "Closes #3 and #4", fixes: true, expect: "3!,4!"},
+		{message: "Resolved: #9", fixes: true, expect: "9!"},
+		{message: "fixes task #7", fixes: true, expect: "7!"},
+		{message: "fixes #2, part of task #1", fixes: true, expect: "2!,1"},
+		{message: "task #5, later fixed #5", fixes: true, expect: "5!"},
+		{message: "Merge pull request #34, see #5", fixes: true, expect: ""},
+		{message: "prefixes #3", fixes: true, expect: ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/fixes=%v", tt.message, tt.fixes), func(t *testing.T) {
+			var actual []string
+			for _, ref := range ParseRefs(tt.message, tt.fixes) {
+				s := fmt.Sprint(ref.TaskID)
+				if ref.Fixes {
+					s += "!"
+				}
+				actual = append(actual, s)
+			}
+			if strings.Join(actual, ",") != tt.expect {
+				t.Fatalf("expect %q, actual: %q", tt.expect, strings.Join(actual, ","))
+			}
+		})
+	}
+}
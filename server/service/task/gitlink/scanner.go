@@ -0,0 +1,355 @@
+package gitlink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/links"
+)
+
+var ErrRepoNotConfigured = errors.New("repository not configured")
+
+// conflictRetries is the number of times linking a task is retried
+// when the task is modified meanwhile
+const conflictRetries = 3
+
+type Options struct {
+	// FixesDone marks the tasks referred to by fixes task #N,
+	// closes task #N or resolves task #N done, and also takes
+	// fixes #N without the task keyword as referring to task N
+	FixesDone bool
+	// MaxCommits is the number of commits read the first time a
+	// repository is scanned, or when the last commit seen is gone, 100 if 0
+	MaxCommits int
+}
+
+// RepoResult is the outcome of scanning a repository
+type RepoResult struct {
+	Repo string `json:"repo"`
+	// Commits is the number of new commits read
+	Commits int `json:"commits"`
+	// Linked lists the references newly applied to tasks
+	Linked []*LinkedCommit `json:"linked"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type LinkedCommit struct {
+	TaskID  int64  `json:"taskID"`
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+	// Done is set if the commit marked the task done
+	Done bool `json:"done,omitempty"`
+	// Error tells why the commit is not linked, e.g. the task does not exist
+	Error string `json:"error,omitempty"`
+}
+
+// Scanner reads new commits of local repositories and adds a commit
+// link to the tasks their messages refer to. The last commit seen of
+// each repository is kept in a state file, a commit already linked to
+// a task is not linked again.
+type Scanner struct {
+	storage   task.ITaskStorage
+	repos     []string
+	stateFile string
+	opts      Options
+
+	// mu serializes scans
+	mu sync.Mutex
+}
+
+// state is the content of the state file
+type state struct {
+	// Heads maps a repository to the last commit seen
+	Heads map[string]string `json:"heads"`
+}
+
+// NewScanner scans the git work trees of repos, paths are made absolute
+func NewScanner(storage task.ITaskStorage, repos []string, stateFile string, opts Options) *Scanner {
+	if opts.MaxCommits <= 0 {
+		opts.MaxCommits = 100
+	}
+	abs := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if p, err := filepath.Abs(repo); err == nil {
+			repo = p
+		}
+		abs = append(abs, filepath.Clean(repo))
+	}
+	return &Scanner{storage: storage, repos: abs, stateFile: stateFile, opts: opts}
+}
+
+// Repos lists the repositories scanned
+func (c *Scanner) Repos() []string {
+	return c.repos
+}
+
+// Run scans all repositories now and then every interval until ctx is done
+func (c *Scanner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		results, err := c.Scan(ctx, "")
+		if err != nil {
+			log.Printf("gitlink: %v", err)
+		}
+		for _, r := range results {
+			if r.Error != "" {
+				log.Printf("gitlink: scan %s: %s", r.Repo, r.Error)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan scans one repository, or all if repo is empty. A repository that
+// fails is reported in its result, the others are still scanned.
+func (c *Scanner) Scan(ctx context.Context, repo string) ([]*RepoResult, error) {
+	repos := c.repos
+	if repo != "" {
+		found, err := c.findRepo(repo)
+		if err != nil {
+			return nil, err
+		}
+		repos = []string{found}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, err := c.readState()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*RepoResult, 0, len(repos))
+	for _, r := range repos {
+		result, newHead, err := c.scanRepo(ctx, r, st.Heads[r])
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			st.Heads[r] = newHead
+		}
+		results = append(results, result)
+	}
+	if err := c.writeState(st); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// findRepo returns the configured repository path contains,
+// so a post-commit hook may pass any directory of the work tree
+func (c *Scanner) findRepo(path string) (string, error) {
+	if p, err := filepath.Abs(path); err == nil {
+		path = p
+	}
+	path = filepath.Clean(path)
+	for _, r := range c.repos {
+		if rel, err := filepath.Rel(r, path); err == nil && filepath.IsLocal(rel) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrRepoNotConfigured, path)
+}
+
+// pendingTask collects the commits referring to a task
+type pendingTask struct {
+	taskID  int64
+	commits []*Commit
+	links   []*model.TaskLink
+	// fixes[i] tells whether commits[i] marks the task done
+	fixes []bool
+}
+
+func (c *pendingTask) fixed() bool {
+	for _, fix := range c.fixes {
+		if fix {
+			return true
+		}
+	}
+	return false
+}
+
+// failed reports all commits as not linked for err
+func (c *pendingTask) failed(err error) []*LinkedCommit {
+	linked := make([]*LinkedCommit, 0, len(c.commits))
+	for _, commit := range c.commits {
+		linked = append(linked, &LinkedCommit{
+			TaskID:  c.taskID,
+			Hash:    commit.Hash,
+			Subject: commit.Subject,
+			Error:   err.Error(),
+		})
+	}
+	return linked
+}
+
+func (c *Scanner) scanRepo(ctx context.Context, repo string, lastHead string) (*RepoResult, string, error) {
+	result := &RepoResult{Repo: repo, Linked: []*LinkedCommit{}}
+	newHead, err := head(ctx, repo)
+	if err != nil {
+		return result, "", err
+	}
+	if newHead == lastHead {
+		return result, newHead, nil
+	}
+	commits, err := readLog(ctx, repo, lastHead, newHead, c.opts.MaxCommits)
+	if err != nil {
+		return result, "", err
+	}
+	result.Commits = len(commits)
+
+	remote := remoteURL(ctx, repo)
+	var pending []*pendingTask
+	byID := make(map[int64]*pendingTask)
+	for _, commit := range commits {
+		for _, ref := range ParseRefs(commit.Message, c.opts.FixesDone) {
+			p := byID[ref.TaskID]
+			if p == nil {
+				p = &pendingTask{taskID: ref.TaskID}
+				byID[ref.TaskID] = p
+				pending = append(pending, p)
+			}
+			p.commits = append(p.commits, commit)
+			p.links = append(p.links, commitLink(repo, remote, commit))
+			p.fixes = append(p.fixes, ref.Fixes && c.opts.FixesDone)
+		}
+	}
+	for _, p := range pending {
+		linked, err := c.apply(p)
+		if err != nil {
+			return result, "", err
+		}
+		result.Linked = append(result.Linked, linked...)
+	}
+	return result, newHead, nil
+}
+
+// apply adds the commit links to the task, and marks it done if fixed.
+// A missing task or a rejected update is reported in the result, other
+// errors fail the scan.
+func (c *Scanner) apply(p *pendingTask) ([]*LinkedCommit, error) {
+	for i := 0; ; i++ {
+		tasks, err := c.storage.LoadTasks("")
+		if err != nil {
+			return nil, err
+		}
+		t := model.FindTask(tasks, p.taskID)
+		if t == nil {
+			return p.failed(fmt.Errorf("%w: %d", task.ErrTaskNotFound, p.taskID)), nil
+		}
+		merged, added := links.Merge(t.Links, p.links)
+		done := p.fixed() && t.Status != model.TaskStatusDone
+		if len(added) == 0 && !done {
+			return nil, nil
+		}
+		update := &model.TaskUpdate{}
+		if len(added) > 0 {
+			update.Links = &merged
+		}
+		if done {
+			status := string(model.TaskStatusDone)
+			update.Status = &status
+		}
+		revision := t.Revision
+		_, err = c.storage.Batch([]*model.BatchOperation{{
+			Op:               model.BatchOpUpdate,
+			TaskID:           t.ID,
+			Update:           update,
+			ExpectedRevision: &revision,
+		}})
+		var conflict *task.ConflictError
+		if errors.As(err, &conflict) && i < conflictRetries {
+			continue
+		}
+		var opErr *task.BatchOpError
+		if errors.As(err, &opErr) {
+			// e.g. rejected by a hook
+			return p.failed(opErr.Err), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		addedURLs := make(map[string]bool, len(added))
+		for _, link := range added {
+			addedURLs[link.URL] = true
+		}
+		var linked []*LinkedCommit
+		for j, commit := range p.commits {
+			fixed := done && p.fixes[j]
+			if !addedURLs[p.links[j].URL] && !fixed {
+				continue
+			}
+			linked = append(linked, &LinkedCommit{
+				TaskID:  t.ID,
+				Hash:    commit.Hash,
+				Subject: commit.Subject,
+				Done:    fixed,
+			})
+		}
+		return linked, nil
+	}
+}
+
+// commitLink links to the commit page of the origin remote, or to the
+// commit in the local repository if the remote is not recognized
+func commitLink(repo string, remote string, commit *Commit) *model.TaskLink {
+	link := &model.TaskLink{
+		Title: commit.Subject,
+		Kind:  model.LinkKindCommit,
+	}
+	if u := commitURL(remote, commit.Hash); u != "" {
+		link.URL = u
+		link.ExternalID = links.Classify(u).ExternalID
+	}
+	if link.URL == "" {
+		link.URL = "file://" + filepath.ToSlash(repo) + "#" + commit.Hash
+	}
+	if link.ExternalID == "" {
+		link.ExternalID = "git:" + filepath.Base(repo) + "@" + commit.Hash
+	}
+	return link
+}
+
+func (c *Scanner) readState() (*state, error) {
+	st := &state{Heads: map[string]string{}}
+	data, err := os.ReadFile(c.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("read git scan state %s: %w", c.stateFile, err)
+	}
+	if st.Heads == nil {
+		st.Heads = map[string]string{}
+	}
+	return st, nil
+}
+
+func (c *Scanner) writeState(st *state) error {
+	if err := os.MkdirAll(filepath.Dir(c.stateFile), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.stateFile)
+}
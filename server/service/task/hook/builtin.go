@@ -0,0 +1,92 @@
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// builtins are the hooks enabled by name, see EnableBuiltins
+var builtins = map[string]func() Hook{
+	"normalize-title": NormalizeTitle,
+	"require-mode":    RequireMode,
+}
+
+// EnableBuiltins registers the built-in hooks named in a comma
+// separated list to DefaultRegistry, such as TASK_HOOKS
+func EnableBuiltins(names string) error {
+	var hooks []string
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if builtins[name] == nil {
+			return fmt.Errorf("unknown hook: %s, available: %s", name, strings.Join(BuiltinNames(), ", "))
+		}
+		hooks = append(hooks, name)
+	}
+	for _, name := range hooks {
+		Register(name, builtins[name]())
+	}
+	return nil
+}
+
+// BuiltinNames lists the names of the built-in hooks
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NormalizeTitle trims titles and collapses runs of whitespace
+// in tasks added, updated or saved
+func NormalizeTitle() Hook {
+	return Funcs{BeforeFunc: func(call *Call) error {
+		switch call.Op {
+		case OpAddTask:
+			normalizeTitles([]*model.TaskItem{call.Task})
+		case OpUpdateTask:
+			if call.Update != nil && call.Update.Title != nil {
+				update := *call.Update
+				title := normalizeTitle(*update.Title)
+				update.Title = &title
+				call.Update = &update
+			}
+		case OpSaveTasks:
+			normalizeTitles(call.Tasks)
+		}
+		return nil
+	}}
+}
+
+func normalizeTitles(tasks []*model.TaskItem) {
+	model.WalkTasks(tasks, func(t *model.TaskItem, depth int) bool {
+		t.Title = normalizeTitle(t.Title)
+		return true
+	})
+}
+
+func normalizeTitle(title string) string {
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// RequireMode rejects adding top level tasks without a mode,
+// subtasks are shown in the mode of their parent
+func RequireMode() Hook {
+	return Funcs{BeforeFunc: func(call *Call) error {
+		if call.Op != OpAddTask || call.Task == nil || call.Task.Mode != "" {
+			return nil
+		}
+		if call.ParentID != 0 || (call.BatchOp != nil && call.BatchOp.ParentRef != "") {
+			return nil
+		}
+		return errors.New("task requires a mode")
+	}}
+}
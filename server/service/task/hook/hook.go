@@ -0,0 +1,164 @@
+// Package hook runs in-process hooks around the operations of a task
+// storage, so behavior such as normalizing titles or rejecting tasks
+// without a mode is added without changing the storage.
+//
+// Hooks are registered at startup, then every call to the storage
+// returned by Wrap runs the Before of all hooks in registration order,
+// the operation itself, then the After of the same hooks.
+package hook
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// ErrVetoed is wrapped by the errors of operations a hook rejected
+var ErrVetoed = errors.New("rejected by hook")
+
+// Op names a method of task.ITaskStorage
+type Op string
+
+const (
+	OpSaveTasks      Op = "SaveTasks"
+	OpRevision       Op = "Revision"
+	OpLoadTasks      Op = "LoadTasks"
+	OpAddTask        Op = "AddTask"
+	OpRemoveTask     Op = "RemoveTask"
+	OpUpdateTask     Op = "UpdateTask"
+	OpExchangeOrder  Op = "ExchangeOrder"
+	OpMoveTask       Op = "MoveTask"
+	OpAddTaskNote    Op = "AddTaskNote"
+	OpUpdateTaskNote Op = "UpdateTaskNote"
+	OpCloneTask      Op = "CloneTask"
+	OpMergeTasks     Op = "MergeTasks"
+	OpSplitTask      Op = "SplitTask"
+	OpBatch          Op = "Batch"
+	OpSync           Op = "Sync"
+)
+
+// Call holds the arguments of an operation, only those of Op are set.
+// Before may change them to alter the operation.
+//
+// The operations of Batch and Sync are also run as calls of the single
+// task methods, with BatchOp set, so a hook of AddTask sees every task
+// added. Their TaskID or ParentID is 0 if the op refers to a task added
+// in the same batch by ref.
+type Call struct {
+	Op Op
+
+	// Mode of LoadTasks
+	Mode model.TaskMode
+	// TaskID is the task operated on, the source of MergeTasks
+	TaskID int64
+	// Task is the task to add of AddTask
+	Task *model.TaskItem
+	// Tasks are all the tasks of SaveTasks
+	Tasks []*model.TaskItem
+	// ExpectedRevision is that of the store for SaveTasks, and of
+	// TaskID for ExchangeOrder and batch operations
+	ExpectedRevision *int64
+	Update           *model.TaskUpdate
+	ExchangeTaskID   int64
+	// ParentID of AddTask and MoveTask, Index of MoveTask and
+	// of AddTask in a batch, negative for the end
+	ParentID int64
+	Index    int
+	// Note of AddTaskNote and UpdateTaskNote
+	Note      string
+	NoteIndex int
+	// TargetID of MergeTasks
+	TargetID     int64
+	CloneOptions *model.CloneOptions
+	SplitOptions *model.SplitOptions
+	// Ops of Batch and Sync, Cursor of Sync
+	Ops    []*model.BatchOperation
+	Cursor int64
+	// BatchOp is the batch operation a single task call is part of
+	BatchOp *model.BatchOperation
+}
+
+// Result is the outcome of an operation, only those of the Op are set
+type Result struct {
+	// Task is the task added, cloned or merged into
+	Task *model.TaskItem
+	// Tasks are the tasks loaded, or created by SplitTask
+	Tasks        []*model.TaskItem
+	Revision     int64
+	BatchResults []*model.BatchResult
+	SyncResult   *model.SyncResult
+	// Err is the error of the operation, nil if it succeeded
+	Err error
+}
+
+// Hook is called around the operations of the storage
+type Hook interface {
+	// Before is called before the operation, an error rejects it
+	Before(call *Call) error
+	// After is called once the operation returned, also if it failed
+	After(call *Call, result *Result)
+}
+
+// Funcs adapts functions to a Hook, nil functions are skipped
+type Funcs struct {
+	BeforeFunc func(call *Call) error
+	AfterFunc  func(call *Call, result *Result)
+}
+
+func (c Funcs) Before(call *Call) error {
+	if c.BeforeFunc == nil {
+		return nil
+	}
+	return c.BeforeFunc(call)
+}
+
+func (c Funcs) After(call *Call, result *Result) {
+	if c.AfterFunc != nil {
+		c.AfterFunc(call, result)
+	}
+}
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+// Registry holds the hooks run by a wrapped storage
+type Registry struct {
+	mu    sync.RWMutex
+	hooks []namedHook
+}
+
+// DefaultRegistry is used by Register
+var DefaultRegistry = &Registry{}
+
+// Register adds a hook to DefaultRegistry
+func Register(name string, h Hook) {
+	DefaultRegistry.Register(name, h)
+}
+
+// Register adds a hook run after those registered before,
+// name identifies it in errors
+func (c *Registry) Register(name string, h Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, namedHook{name: name, hook: h})
+}
+
+// Names lists the registered hooks in order
+func (c *Registry) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.hooks))
+	for _, h := range c.hooks {
+		names = append(names, h.name)
+	}
+	return names
+}
+
+func (c *Registry) list() []namedHook {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hooks
+}
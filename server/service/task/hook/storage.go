@@ -0,0 +1,355 @@
+package hook
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/event"
+)
+
+// Storage runs the hooks of a registry around the operations of
+// another storage
+type Storage struct {
+	inner    task.ITaskStorage
+	registry *Registry
+}
+
+var _ task.ITaskStorage = (*Storage)(nil)
+
+// Wrap returns inner with the hooks of registry run around its
+// operations, hooks registered later also apply
+func Wrap(inner task.ITaskStorage, registry *Registry) *Storage {
+	return &Storage{inner: inner, registry: registry}
+}
+
+// before runs Before of the hooks in order until one rejects the call,
+// returns the hooks to run After of
+func (s *Storage) before(call *Call) ([]namedHook, error) {
+	hooks := s.registry.list()
+	for i, h := range hooks {
+		if err := h.hook.Before(call); err != nil {
+			return hooks[:i+1], fmt.Errorf("%w: %s: %w", ErrVetoed, h.name, err)
+		}
+	}
+	return hooks, nil
+}
+
+func after(hooks []namedHook, call *Call, result *Result) {
+	for _, h := range hooks {
+		h.hook.After(call, result)
+	}
+}
+
+// run runs the hooks around fn, which fills the result of the call
+func (s *Storage) run(call *Call, fn func(result *Result)) *Result {
+	result := &Result{}
+	hooks, err := s.before(call)
+	if err != nil {
+		result.Err = err
+	} else {
+		fn(result)
+	}
+	after(hooks, call, result)
+	return result
+}
+
+func (s *Storage) SaveTasks(tasks []*model.TaskItem, expectedRevision *int64) error {
+	call := &Call{Op: OpSaveTasks, Tasks: tasks, ExpectedRevision: expectedRevision}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.SaveTasks(call.Tasks, call.ExpectedRevision)
+	}).Err
+}
+
+func (s *Storage) Revision() (int64, error) {
+	result := s.run(&Call{Op: OpRevision}, func(result *Result) {
+		result.Revision, result.Err = s.inner.Revision()
+	})
+	return result.Revision, result.Err
+}
+
+func (s *Storage) LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error) {
+	call := &Call{Op: OpLoadTasks, Mode: mode}
+	result := s.run(call, func(result *Result) {
+		result.Tasks, result.Err = s.inner.LoadTasks(call.Mode)
+	})
+	return result.Tasks, result.Err
+}
+
+func (s *Storage) AddTask(t *model.TaskItem) (*model.TaskItem, error) {
+	call := &Call{Op: OpAddTask, Task: t}
+	if t != nil {
+		call.ParentID = t.ParentID
+	}
+	parentID := call.ParentID
+	result := s.run(call, func(result *Result) {
+		if call.Task != nil && call.ParentID != parentID {
+			call.Task.ParentID = call.ParentID
+		}
+		result.Task, result.Err = s.inner.AddTask(call.Task)
+	})
+	return result.Task, result.Err
+}
+
+func (s *Storage) RemoveTask(taskID int64) error {
+	call := &Call{Op: OpRemoveTask, TaskID: taskID}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.RemoveTask(call.TaskID)
+	}).Err
+}
+
+func (s *Storage) UpdateTask(taskID int64, update *model.TaskUpdate) error {
+	call := &Call{Op: OpUpdateTask, TaskID: taskID, Update: update}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.UpdateTask(call.TaskID, call.Update)
+	}).Err
+}
+
+func (s *Storage) ExchangeOrder(taskID int64, exchangeTaskID int64, expectedRevision *int64) error {
+	call := &Call{Op: OpExchangeOrder, TaskID: taskID, ExchangeTaskID: exchangeTaskID, ExpectedRevision: expectedRevision}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.ExchangeOrder(call.TaskID, call.ExchangeTaskID, call.ExpectedRevision)
+	}).Err
+}
+
+func (s *Storage) MoveTask(taskID int64, parentID int64, index int) error {
+	call := &Call{Op: OpMoveTask, TaskID: taskID, ParentID: parentID, Index: index}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.MoveTask(call.TaskID, call.ParentID, call.Index)
+	}).Err
+}
+
+func (s *Storage) AddTaskNote(taskID int64, note string) error {
+	call := &Call{Op: OpAddTaskNote, TaskID: taskID, Note: note}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.AddTaskNote(call.TaskID, call.Note)
+	}).Err
+}
+
+func (s *Storage) UpdateTaskNote(taskID int64, noteIndex int, newText string) error {
+	call := &Call{Op: OpUpdateTaskNote, TaskID: taskID, NoteIndex: noteIndex, Note: newText}
+	return s.run(call, func(result *Result) {
+		result.Err = s.inner.UpdateTaskNote(call.TaskID, call.NoteIndex, call.Note)
+	}).Err
+}
+
+func (s *Storage) CloneTask(taskID int64, opts *model.CloneOptions) (*model.TaskItem, error) {
+	call := &Call{Op: OpCloneTask, TaskID: taskID, CloneOptions: opts}
+	result := s.run(call, func(result *Result) {
+		result.Task, result.Err = s.inner.CloneTask(call.TaskID, call.CloneOptions)
+	})
+	return result.Task, result.Err
+}
+
+func (s *Storage) MergeTasks(sourceID int64, targetID int64) (*model.TaskItem, error) {
+	call := &Call{Op: OpMergeTasks, TaskID: sourceID, TargetID: targetID}
+	result := s.run(call, func(result *Result) {
+		result.Task, result.Err = s.inner.MergeTasks(call.TaskID, call.TargetID)
+	})
+	return result.Task, result.Err
+}
+
+func (s *Storage) SplitTask(taskID int64, opts *model.SplitOptions) ([]*model.TaskItem, error) {
+	call := &Call{Op: OpSplitTask, TaskID: taskID, SplitOptions: opts}
+	result := s.run(call, func(result *Result) {
+		result.Tasks, result.Err = s.inner.SplitTask(call.TaskID, call.SplitOptions)
+	})
+	return result.Tasks, result.Err
+}
+
+// Batch runs the hooks of Batch, then those of each operation, a rejected
+// operation fails the whole batch with a *task.BatchOpError
+func (s *Storage) Batch(ops []*model.BatchOperation) ([]*model.BatchResult, error) {
+	call := &Call{Op: OpBatch, Ops: ops}
+	result := s.run(call, func(result *Result) {
+		ops := cloneOps(call.Ops)
+		opCalls := make([]*Call, len(ops))
+		opHooks := make([][]namedHook, len(ops))
+		defer func() {
+			for i, opCall := range opCalls {
+				if opCall == nil {
+					continue
+				}
+				opResult := &Result{Err: result.Err}
+				if result.Err == nil && i < len(result.BatchResults) {
+					opResult.Task = result.BatchResults[i].Task
+				}
+				after(opHooks[i], opCall, opResult)
+			}
+		}()
+		for i, op := range ops {
+			opCall := opCallOf(op)
+			if opCall == nil {
+				continue
+			}
+			opCalls[i] = opCall
+			hooks, err := s.before(opCall)
+			opHooks[i] = hooks
+			if err != nil {
+				result.Err = &task.BatchOpError{Index: i, Op: op.Op, Err: err}
+				opCalls = opCalls[:i+1]
+				return
+			}
+			applyOpCall(op, opCall)
+		}
+		result.BatchResults, result.Err = s.inner.Batch(ops)
+	})
+	return result.BatchResults, result.Err
+}
+
+// Sync runs the hooks of Sync, then those of each operation, a rejected
+// operation is reported as rejected while the others still apply
+func (s *Storage) Sync(cursor int64, ops []*model.BatchOperation) (*model.SyncResult, error) {
+	call := &Call{Op: OpSync, Cursor: cursor, Ops: ops}
+	result := s.run(call, func(result *Result) {
+		ops := cloneOps(call.Ops)
+		opCalls := make([]*Call, len(ops))
+		opHooks := make([][]namedHook, len(ops))
+		rejected := make([]error, len(ops))
+		applied := make([]*model.BatchOperation, 0, len(ops))
+		for i, op := range ops {
+			opCall := opCallOf(op)
+			if opCall == nil {
+				applied = append(applied, op)
+				continue
+			}
+			opCalls[i] = opCall
+			hooks, err := s.before(opCall)
+			opHooks[i] = hooks
+			if err != nil {
+				rejected[i] = err
+				continue
+			}
+			applyOpCall(op, opCall)
+			applied = append(applied, op)
+		}
+		result.SyncResult, result.Err = s.inner.Sync(call.Cursor, applied)
+		if result.Err == nil {
+			result.SyncResult.Results = spliceRejected(ops, rejected, result.SyncResult.Results)
+		}
+		for i, opCall := range opCalls {
+			if opCall == nil {
+				continue
+			}
+			opResult := &Result{Err: result.Err}
+			if rejected[i] != nil {
+				opResult.Err = rejected[i]
+			} else if result.Err == nil && i < len(result.SyncResult.Results) {
+				res := result.SyncResult.Results[i]
+				opResult.Task = res.Task
+				if res.Status != model.SyncOpApplied {
+					opResult.Err = errors.New(res.Error)
+				}
+			}
+			after(opHooks[i], opCall, opResult)
+		}
+	})
+	return result.SyncResult, result.Err
+}
+
+func (s *Storage) Subscribe(lastEventID int64) *event.Subscription {
+	return s.inner.Subscribe(lastEventID)
+}
+
+// spliceRejected inserts the results of rejected operations back at
+// their positions among the results of the applied ones
+func spliceRejected(ops []*model.BatchOperation, rejected []error, results []*model.SyncOpResult) []*model.SyncOpResult {
+	merged := make([]*model.SyncOpResult, 0, len(ops))
+	j := 0
+	for i, op := range ops {
+		if rejected[i] == nil {
+			if j < len(results) {
+				merged = append(merged, results[j])
+				j++
+			}
+			continue
+		}
+		merged = append(merged, &model.SyncOpResult{
+			BatchResult: model.BatchResult{Op: op.Op, TaskID: op.TaskID, Ref: op.Ref},
+			Status:      model.SyncOpRejected,
+			Error:       rejected[i].Error(),
+		})
+	}
+	return merged
+}
+
+// cloneOps copies the operations so hooks do not modify the caller's
+func cloneOps(ops []*model.BatchOperation) []*model.BatchOperation {
+	cloned := make([]*model.BatchOperation, len(ops))
+	for i, op := range ops {
+		if op != nil {
+			cl := *op
+			op = &cl
+		}
+		cloned[i] = op
+	}
+	return cloned
+}
+
+// opCallOf returns the call of the single task method equivalent
+// to a batch operation, nil if the operation is invalid
+func opCallOf(op *model.BatchOperation) *Call {
+	if op == nil {
+		return nil
+	}
+	call := &Call{TaskID: op.TaskID, ParentID: op.ParentID, ExpectedRevision: op.ExpectedRevision, BatchOp: op}
+	if op.Index != nil {
+		call.Index = *op.Index
+	}
+	switch op.Op {
+	case model.BatchOpAdd:
+		call.Op = OpAddTask
+		call.Task = op.Task
+		if op.ParentID == 0 && op.ParentRef == "" && op.Task != nil {
+			call.ParentID = op.Task.ParentID
+		}
+	case model.BatchOpUpdate:
+		call.Op = OpUpdateTask
+		call.Update = op.Update
+	case model.BatchOpRemove:
+		call.Op = OpRemoveTask
+	case model.BatchOpMove:
+		call.Op = OpMoveTask
+		if op.Index == nil {
+			// a move appends by default, as MoveTask with a negative index
+			call.Index = -1
+		}
+	case model.BatchOpNote:
+		call.Op = OpAddTaskNote
+		call.Note = op.Note
+		if op.NoteIndex != nil {
+			call.Op = OpUpdateTaskNote
+			call.NoteIndex = *op.NoteIndex
+		}
+	default:
+		return nil
+	}
+	return call
+}
+
+// applyOpCall writes the changes hooks made to the call back to the operation
+func applyOpCall(op *model.BatchOperation, call *Call) {
+	if op.TaskRef == "" {
+		op.TaskID = call.TaskID
+	}
+	if op.ParentRef == "" {
+		op.ParentID = call.ParentID
+	}
+	op.ExpectedRevision = call.ExpectedRevision
+	switch call.Op {
+	case OpAddTask:
+		op.Task = call.Task
+	case OpUpdateTask:
+		op.Update = call.Update
+	case OpMoveTask:
+		index := call.Index
+		op.Index = &index
+	case OpAddTaskNote:
+		op.Note = call.Note
+	case OpUpdateTaskNote:
+		op.Note = call.Note
+		noteIndex := call.NoteIndex
+		op.NoteIndex = &noteIndex
+	}
+}
@@ -0,0 +1,273 @@
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/local_impl"
+)
+
+// newTestStorage wraps a local storage holding task 1 with a registry
+// whose hook rejects adding a task titled veto or the note veto,
+// and records the ops After is called with
+func newTestStorage(t *testing.T) (*Storage, *[]string) {
+	inner := local_impl.New(filepath.Join(t.TempDir(), "tasks.json"))
+	if _, err := inner.AddTask(&model.TaskItem{Title: "Release", Status: model.TaskStatusCreated}); err != nil {
+		t.Fatal(err)
+	}
+	var after []string
+	registry := &Registry{}
+	registry.Register("veto", Funcs{
+		BeforeFunc: func(call *Call) error {
+			if (call.Task != nil && call.Task.Title == "veto") || call.Note == "veto" {
+				return errors.New("vetoed")
+			}
+			return nil
+		},
+		AfterFunc: func(call *Call, result *Result) {
+			entry := string(call.Op)
+			if result.Err != nil {
+				entry += "!"
+			}
+			after = append(after, entry)
+		},
+	})
+	return Wrap(inner, registry), &after
+}
+
+// testOps adds a task, notes task 1 and adds another, the op at veto
+// is made to be rejected
+func testOps(veto int) []*model.BatchOperation {
+	ops := []*model.BatchOperation{
+		{Op: model.BatchOpAdd, Task: &model.TaskItem{Title: "Plan"}},
+		{Op: model.BatchOpNote, TaskID: 1, Note: "kickoff"},
+		{Op: model.BatchOpAdd, Task: &model.TaskItem{Title: "Ship"}},
+	}
+	switch {
+	case veto < 0:
+	case ops[veto].Op == model.BatchOpAdd:
+		ops[veto].Task.Title = "veto"
+	default:
+		ops[veto].Note = "veto"
+	}
+	return ops
+}
+
+func loadTitles(t *testing.T, s *Storage) string {
+	tasks, err := s.LoadTasks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, task := range tasks {
+		titles = append(titles, fmt.Sprintf("%s(%d)", task.Title, len(task.Notes)))
+	}
+	return strings.Join(titles, " ")
+}
+
+func TestBatchVeto(t *testing.T) {
+	tests := []struct {
+		name  string
+		veto  int
+		after string
+	}{
+		{name: "none", veto: -1, after: "AddTask AddTaskNote AddTask Batch"},
+		{name: "first", veto: 0, after: "AddTask! Batch!"},
+		{name: "middle", veto: 1, after: "AddTask! AddTaskNote! Batch!"},
+		{name: "last", veto: 2, after: "AddTask! AddTaskNote! AddTask! Batch!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, after := newTestStorage(t)
+			results, err := s.Batch(testOps(tt.veto))
+			if actual := strings.Join(*after, " "); actual != tt.after {
+				t.Fatalf("expect After %q, actual: %q", tt.after, actual)
+			}
+			if tt.veto < 0 {
+				if err != nil || len(results) != 3 {
+					t.Fatalf("expect 3 results, actual: %v %v", results, err)
+				}
+				if titles := loadTitles(t, s); titles != "Ship(0) Plan(0) Release(1)" {
+					t.Fatalf("unexpected tasks: %s", titles)
+				}
+				return
+			}
+			var opErr *task.BatchOpError
+			if !errors.As(err, &opErr) || opErr.Index != tt.veto || !errors.Is(err, ErrVetoed) {
+				t.Fatalf("expect op[%d] vetoed, actual: %v", tt.veto, err)
+			}
+			if titles := loadTitles(t, s); titles != "Release(0)" {
+				t.Fatalf("expect nothing applied, actual: %s", titles)
+			}
+		})
+	}
+}
+
+func TestSyncRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		veto     int
+		statuses string
+	}{
+		{name: "none", veto: -1, statuses: "applied applied applied"},
+		{name: "first", veto: 0, statuses: "rejected applied applied"},
+		{name: "middle", veto: 1, statuses: "applied rejected applied"},
+		{name: "last", veto: 2, statuses: "applied applied rejected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, after := newTestStorage(t)
+			ops := testOps(tt.veto)
+			result, err := s.Sync(0, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var statuses []string
+			for i, res := range result.Results {
+				statuses = append(statuses, string(res.Status))
+				if res.Op != ops[i].Op {
+					t.Errorf("result %d: expect op %s, actual: %s", i, ops[i].Op, res.Op)
+				}
+				if res.Status == model.SyncOpRejected && !strings.Contains(res.Error, "vetoed") {
+					t.Errorf("result %d: unexpected error %q", i, res.Error)
+				}
+			}
+			if actual := strings.Join(statuses, " "); actual != tt.statuses {
+				t.Fatalf("expect %q, actual: %q", tt.statuses, actual)
+			}
+			// the task added by the second add op is at the front
+			if res := result.Results[2]; res.Status == model.SyncOpApplied && (res.Task == nil || res.Task.Title != "Ship") {
+				t.Fatalf("expect the result of Ship, actual: %+v", res)
+			}
+			if failed, rejected := strings.Count(strings.Join(*after, " "), "!"), strings.Count(tt.statuses, "rejected"); failed != rejected {
+				t.Fatalf("expect a failed After per rejected op, actual: %v", *after)
+			}
+		})
+	}
+}
+
+func TestHookEdits(t *testing.T) {
+	s, _ := newTestStorage(t)
+	s.registry.Register("edit", Funcs{BeforeFunc: func(call *Call) error {
+		switch call.Op {
+		case OpAddTask:
+			// file new tasks under task 1
+			call.Task.Title = strings.ToUpper(call.Task.Title)
+			call.ParentID = 1
+		case OpMoveTask:
+			call.ParentID = 0
+			call.Index = 0
+		case OpAddTaskNote:
+			call.Note = "[hook] " + call.Note
+		}
+		return nil
+	}})
+
+	ops := []*model.BatchOperation{
+		{Op: model.BatchOpAdd, Ref: "plan", Task: &model.TaskItem{Title: "plan"}},
+		{Op: model.BatchOpNote, TaskRef: "plan", Note: "kickoff"},
+		{Op: model.BatchOpAdd, Ref: "ship", Task: &model.TaskItem{Title: "ship"}},
+		{Op: model.BatchOpMove, TaskRef: "ship", ParentRef: "plan"},
+	}
+	if _, err := s.Batch(ops); err != nil {
+		t.Fatal(err)
+	}
+	if ops[3].ParentRef != "plan" || ops[3].Index != nil {
+		t.Fatalf("expect the caller's ops unchanged, actual: %+v", ops[3])
+	}
+	tasks, err := s.LoadTasks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ParentRef is kept over the hook's ParentID, the index is applied
+	if len(tasks) != 1 || len(tasks[0].SubTasks) != 1 {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+	plan := tasks[0].SubTasks[0]
+	if plan.Title != "PLAN" || len(plan.Notes) != 1 || plan.Notes[0] != "[hook] kickoff" {
+		t.Fatalf("expect the edits applied, actual: %+v", plan)
+	}
+	if len(plan.SubTasks) != 1 || plan.SubTasks[0].Title != "SHIP" {
+		t.Fatalf("expect SHIP moved under PLAN, actual: %+v", plan.SubTasks)
+	}
+
+	result, err := s.Sync(0, []*model.BatchOperation{
+		{Op: model.BatchOpAdd, Task: &model.TaskItem{Title: "offline"}},
+		{Op: model.BatchOpMove, TaskID: plan.ID, ParentID: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := result.Results[0].Task.Title; title != "OFFLINE" || result.Results[0].Task.ParentID != 1 {
+		t.Fatalf("expect the edits applied, actual: %+v", result.Results[0].Task)
+	}
+	tasks, err = s.LoadTasks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != plan.ID {
+		t.Fatalf("expect PLAN moved to the top, actual: %s", loadTitles(t, s))
+	}
+}
+
+func TestUnmappedOp(t *testing.T) {
+	tests := []struct {
+		op     *model.BatchOperation
+		expect Op
+	}{
+		{op: &model.BatchOperation{Op: model.BatchOpAdd}, expect: OpAddTask},
+		{op: &model.BatchOperation{Op: model.BatchOpUpdate}, expect: OpUpdateTask},
+		{op: &model.BatchOperation{Op: model.BatchOpRemove}, expect: OpRemoveTask},
+		{op: &model.BatchOperation{Op: model.BatchOpMove}, expect: OpMoveTask},
+		{op: &model.BatchOperation{Op: model.BatchOpNote}, expect: OpAddTaskNote},
+		{op: &model.BatchOperation{Op: model.BatchOpNote, NoteIndex: new(int)}, expect: OpUpdateTaskNote},
+		{op: &model.BatchOperation{Op: "archive"}},
+		{op: nil},
+	}
+	for _, tt := range tests {
+		name := "nil"
+		if tt.op != nil {
+			name = string(tt.op.Op)
+		}
+		t.Run(name, func(t *testing.T) {
+			call := opCallOf(tt.op)
+			if tt.expect == "" {
+				if call != nil {
+					t.Fatalf("expect no call, actual: %+v", call)
+				}
+				return
+			}
+			if call == nil || call.Op != tt.expect || call.BatchOp != tt.op {
+				t.Fatalf("expect %s, actual: %+v", tt.expect, call)
+			}
+		})
+	}
+
+	// the storage still rejects it, without running the hooks of single tasks
+	s, after := newTestStorage(t)
+	ops := []*model.BatchOperation{
+		{Op: model.BatchOpNote, TaskID: 1, Note: "kickoff"},
+		{Op: "archive", TaskID: 1},
+	}
+	_, err := s.Batch(ops)
+	var opErr *task.BatchOpError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || errors.Is(err, ErrVetoed) {
+		t.Fatalf("expect op[1] to fail, actual: %v", err)
+	}
+	if actual := strings.Join(*after, " "); actual != "AddTaskNote! Batch!" {
+		t.Fatalf("unexpected After calls: %q", actual)
+	}
+
+	result, err := s.Sync(0, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 2 || result.Results[0].Status != model.SyncOpApplied || result.Results[1].Status != model.SyncOpRejected {
+		t.Fatalf("unexpected results: %+v", result.Results)
+	}
+}
@@ -0,0 +1,218 @@
+// Package ical converts task trees to and from iCalendar (RFC 5545) VTODO components.
+//
+// A task maps to a VTODO as follows:
+//
+//	title        SUMMARY
+//	start time   DTSTART
+//	due time     DUE
+//	status       STATUS: NEEDS-ACTION, COMPLETED or CANCELLED(archived)
+//	done time    COMPLETED
+//	priority     PRIORITY: A to H map to 1 to 8, lower ones to 9
+//	parent       RELATED-TO;RELTYPE=PARENT, the UID of the parent task
+//	mode         CATEGORIES
+//	notes        DESCRIPTION, notes are separated by a blank line,
+//	             and X-TASK-BANNER-NOTE, one per note
+//
+// The UID of a task is derived from its ID, so calendar clients subscribing
+// to the export see updates of the same task rather than new ones, and
+// parsing the export gives back the IDs.
+//
+// A note may contain blank lines itself, so notes are also written one per
+// X-TASK-BANNER-NOTE property. They are parsed back unless a client edited
+// DESCRIPTION, which is then split at blank lines.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+const (
+	prodID    = "-//task-banner//tasks//EN"
+	uidSuffix = "@task-banner"
+
+	dateTimeFormat    = "20060102T150405Z"
+	localDateTimeForm = "20060102T150405"
+	dateFormat        = "20060102"
+
+	// lineLimit is the maximum octets of a content line before folding
+	lineLimit = 75
+)
+
+const (
+	statusNeedsAction = "NEEDS-ACTION"
+	statusCompleted   = "COMPLETED"
+	statusCancelled   = "CANCELLED"
+)
+
+// noteSeparator joins notes in DESCRIPTION
+const noteSeparator = "\n\n"
+
+// noteProperty holds a single note
+const noteProperty = "X-TASK-BANNER-NOTE"
+
+const uidPrefix = "task-"
+
+func UID(taskID int64) string {
+	return uidPrefix + strconv.FormatInt(taskID, 10) + uidSuffix
+}
+
+// TaskIDOf returns the ID of a task from its UID, false if the
+// UID is not one of ours
+func TaskIDOf(uid string) (int64, bool) {
+	s, ok := strings.CutPrefix(uid, uidPrefix)
+	if !ok {
+		return 0, false
+	}
+	s, ok = strings.CutSuffix(s, uidSuffix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// ExternalID of a task parsed from a calendar, to not import it twice
+func ExternalID(uid string) string {
+	return "ical:" + uid
+}
+
+// Render writes tasks and all their subtasks as a VCALENDAR of VTODOs
+func Render(w io.Writer, tasks []*model.TaskItem, name string) error {
+	bw := bufio.NewWriter(w)
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+prodID)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	if name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(name))
+	}
+	stamp := time.Now().UTC().Format(dateTimeFormat)
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		renderTodo(bw, task, stamp)
+		return true
+	})
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+func renderTodo(w *bufio.Writer, task *model.TaskItem, stamp string) {
+	writeLine(w, "BEGIN:VTODO")
+	writeLine(w, "UID:"+UID(task.ID))
+	writeLine(w, "DTSTAMP:"+stamp)
+	writeLine(w, "SUMMARY:"+escapeText(task.Title))
+	if task.StartTime != 0 {
+		writeLine(w, "DTSTART:"+formatTime(task.StartTime))
+	}
+	if task.DueTime != 0 {
+		writeLine(w, "DUE:"+formatTime(task.DueTime))
+	}
+	switch task.Status {
+	case model.TaskStatusDone:
+		writeLine(w, "STATUS:"+statusCompleted)
+	case model.TaskStatusArchived:
+		writeLine(w, "STATUS:"+statusCancelled)
+	default:
+		writeLine(w, "STATUS:"+statusNeedsAction)
+	}
+	if task.DoneTime != 0 {
+		writeLine(w, "COMPLETED:"+formatTime(task.DoneTime))
+	}
+	if p := priorityNumber(task.Priority); p != 0 {
+		writeLine(w, "PRIORITY:"+strconv.Itoa(p))
+	}
+	if task.ParentID != 0 {
+		writeLine(w, "RELATED-TO;RELTYPE=PARENT:"+UID(task.ParentID))
+	}
+	if task.Mode != "" {
+		writeLine(w, "CATEGORIES:"+escapeText(string(task.Mode)))
+	}
+	if len(task.Notes) > 0 {
+		writeLine(w, "DESCRIPTION:"+escapeText(strings.Join(task.Notes, noteSeparator)))
+		for _, note := range task.Notes {
+			writeLine(w, noteProperty+":"+escapeText(note))
+		}
+	}
+	writeLine(w, "END:VTODO")
+}
+
+// priorityNumber maps A-Z to the 1(highest) to 9 scale, 0 means undefined
+func priorityNumber(priority string) int {
+	if len(priority) != 1 || priority[0] < 'A' || priority[0] > 'Z' {
+		return 0
+	}
+	p := int(priority[0]-'A') + 1
+	if p > 9 {
+		p = 9
+	}
+	return p
+}
+
+func formatTime(ts model.SwiftTimestamp) string {
+	return model.ConvertSwiftTimestamp(ts).UTC().Format(dateTimeFormat)
+}
+
+// writeLine folds lines longer than 75 octets without splitting characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := lineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space counts
+		limit = lineLimit - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\':
+			b.WriteString(`\\`)
+		case ';':
+			b.WriteString(`\;`)
+		case ',':
+			b.WriteString(`\,`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package ical
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func swiftTime(s string) model.SwiftTimestamp {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return model.ToSwiftTimestamp(t)
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{
+			ID:         1,
+			Title:      "Release v2; tag, publish",
+			StartTime:  swiftTime("2026-09-01T10:00:00Z"),
+			DueTime:    swiftTime("2026-09-05T18:00:00Z"),
+			Mode:       model.TaskModeWork,
+			Status:     model.TaskStatusCreated,
+			Priority:   "B",
+			ExternalID: ExternalID(UID(1)),
+			Notes:      []string{"check the changelog", "first paragraph\n\nsecond paragraph"},
+			SubTasks: []*model.TaskItem{
+				{
+					ID:         2,
+					ParentID:   1,
+					Title:      "Tag the commit with a rather long title so the content line gets folded",
+					StartTime:  swiftTime("2026-09-01T10:05:00Z"),
+					DoneTime:   swiftTime("2026-09-02T09:00:00Z"),
+					Mode:       model.TaskModeWork,
+					Status:     model.TaskStatusDone,
+					ExternalID: ExternalID(UID(2)),
+					Notes:      []string{},
+					SubTasks:   []*model.TaskItem{},
+				},
+			},
+		},
+		{
+			ID:         3,
+			Title:      "Old errand",
+			StartTime:  swiftTime("2026-09-03T08:00:00Z"),
+			Status:     model.TaskStatusArchived,
+			ExternalID: ExternalID(UID(3)),
+			Notes:      []string{},
+			SubTasks:   []*model.TaskItem{},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tasks, "Tasks"); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// parents are recovered from the nesting
+	parsed[0].SubTasks[0].ParentID = 1
+	if actual, expect := toJSON(parsed), toJSON(tasks); actual != expect {
+		t.Fatalf("round trip changed the tasks, expect: %s\nactual: %s", expect, actual)
+	}
+}
+
+func TestParseEditedDescription(t *testing.T) {
+	cal := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VTODO",
+		"UID:abc@example.com",
+		"SUMMARY:Edited elsewhere",
+		`DESCRIPTION:one\n\ntwo\n\nthree`,
+		"X-TASK-BANNER-NOTE:one",
+		`X-TASK-BANNER-NOTE:two\n\nthree before the edit`,
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n")
+	tasks, err := Parse(strings.NewReader(cal), model.TaskModeLife)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expect 1 task, actual: %d", len(tasks))
+	}
+	task := tasks[0]
+	if task.ID != 0 || task.ExternalID != "ical:abc@example.com" || task.Mode != model.TaskModeLife {
+		t.Fatalf("unexpected task: %s", toJSON(task))
+	}
+	if strings.Join(task.Notes, "|") != "one|two|three" {
+		t.Fatalf("expect notes split from the edited description, actual: %q", task.Notes)
+	}
+}
+
+func TestTaskIDOf(t *testing.T) {
+	tests := []struct {
+		uid string
+		id  int64
+		ok  bool
+	}{
+		{UID(12), 12, true},
+		{"task-12@example.com", 0, false},
+		{"task-x@task-banner", 0, false},
+		{"task-0@task-banner", 0, false},
+		{"12@task-banner", 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := TaskIDOf(tt.uid)
+		if id != tt.id || ok != tt.ok {
+			t.Errorf("TaskIDOf(%q): expect %d %v, actual: %d %v", tt.uid, tt.id, tt.ok, id, ok)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// property is a content line: NAME;PARAM=VALUE:value
+type property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+type todo struct {
+	uid       string
+	parentUID string
+	task      *model.TaskItem
+
+	description string
+	notes       []string
+	hasNotes    bool
+}
+
+// Parse reads the VTODOs of a calendar as a task tree, other components
+// are ignored. A task whose parent is not in the calendar is top level.
+// Tasks without category get mode, and without DTSTART start now.
+//
+// Tasks get the external ID of their UID, and tasks exported by Render
+// get their ID back, other IDs are left zero.
+func Parse(r io.Reader, mode model.TaskMode) ([]*model.TaskItem, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	now := model.ToSwiftTimestamp(time.Now())
+
+	var todos []*todo
+	var current *todo
+	// nested components inside a VTODO, like VALARM
+	var nested int
+	for i, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VTODO"):
+			current = &todo{task: &model.TaskItem{
+				StartTime: now,
+				SubTasks:  []*model.TaskItem{},
+				Mode:      mode,
+				Status:    model.TaskStatusCreated,
+				Notes:     []string{},
+			}}
+			continue
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VTODO"):
+			if current != nil {
+				current.finish()
+				todos = append(todos, current)
+			}
+			current = nil
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if prop.Name == "BEGIN" {
+			nested++
+			continue
+		}
+		if prop.Name == "END" {
+			nested--
+			continue
+		}
+		if nested > 0 {
+			continue
+		}
+		if err := current.set(prop); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	return buildTree(todos), nil
+}
+
+func (c *todo) set(prop *property) error {
+	task := c.task
+	switch prop.Name {
+	case "UID":
+		c.uid = prop.Value
+		task.ExternalID = ExternalID(prop.Value)
+		task.ID, _ = TaskIDOf(prop.Value)
+	case "SUMMARY":
+		task.Title = unescapeText(prop.Value)
+	case "DTSTART", "DUE", "COMPLETED":
+		t, err := parseTime(prop)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", prop.Name, err)
+		}
+		switch prop.Name {
+		case "DTSTART":
+			task.StartTime = model.ToSwiftTimestamp(t)
+		case "DUE":
+			task.DueTime = model.ToSwiftTimestamp(t)
+		default:
+			task.DoneTime = model.ToSwiftTimestamp(t)
+		}
+	case "PRIORITY":
+		p, err := strconv.Atoi(strings.TrimSpace(prop.Value))
+		if err != nil {
+			return fmt.Errorf("invalid PRIORITY: %s", prop.Value)
+		}
+		task.Priority = ""
+		if p >= 1 && p <= 9 {
+			task.Priority = string(rune('A' + p - 1))
+		}
+	case "STATUS":
+		switch strings.ToUpper(prop.Value) {
+		case statusCompleted:
+			task.Status = model.TaskStatusDone
+		case statusCancelled:
+			task.Status = model.TaskStatusArchived
+		default:
+			task.Status = model.TaskStatusCreated
+		}
+	case "RELATED-TO":
+		relType := strings.ToUpper(prop.Params["RELTYPE"])
+		if relType == "" || relType == "PARENT" {
+			c.parentUID = prop.Value
+		}
+	case "CATEGORIES":
+		for _, category := range splitList(prop.Value) {
+			switch mode := model.TaskMode(strings.ToLower(category)); mode {
+			case model.TaskModeWork, model.TaskModeLife:
+				task.Mode = mode
+			case model.TaskModeShared:
+				task.Mode = ""
+			}
+		}
+	case "DESCRIPTION":
+		c.description = strings.TrimSpace(unescapeText(prop.Value))
+	case noteProperty:
+		c.notes = append(c.notes, unescapeText(prop.Value))
+		c.hasNotes = true
+	}
+	return nil
+}
+
+// finish sets the notes, those of the note properties
+// unless DESCRIPTION no longer matches them
+func (c *todo) finish() {
+	if c.hasNotes && strings.TrimSpace(strings.Join(c.notes, noteSeparator)) == c.description {
+		c.task.Notes = c.notes
+		return
+	}
+	if c.description != "" {
+		c.task.Notes = strings.Split(c.description, noteSeparator)
+	}
+}
+
+// buildTree attaches tasks to their parents in file order,
+// links to unknown tasks or forming a cycle are dropped
+func buildTree(todos []*todo) []*model.TaskItem {
+	byUID := make(map[string]*todo, len(todos))
+	for _, t := range todos {
+		if t.uid != "" {
+			byUID[t.uid] = t
+		}
+	}
+	parentOf := func(t *todo) *todo {
+		if t.parentUID == "" {
+			return nil
+		}
+		return byUID[t.parentUID]
+	}
+	tasks := []*model.TaskItem{}
+	for _, t := range todos {
+		parent := parentOf(t)
+		for p, n := parent, 0; p != nil && n <= len(todos); p, n = parentOf(p), n+1 {
+			if p == t {
+				parent = nil
+				break
+			}
+		}
+		if parent == nil {
+			tasks = append(tasks, t.task)
+			continue
+		}
+		parent.task.SubTasks = append(parent.task.SubTasks, t.task)
+	}
+	return tasks
+}
+
+// unfold joins folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func parseProperty(line string) (*property, error) {
+	// the value starts at the first colon outside of quoted parameters
+	inQuote := false
+	colon := -1
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' {
+			inQuote = !inQuote
+		} else if line[i] == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return nil, fmt.Errorf("invalid content line: %q", line)
+	}
+	prop := &property{Value: line[colon+1:]}
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		if prop.Params == nil {
+			prop.Params = make(map[string]string)
+		}
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func parseTime(prop *property) (time.Time, error) {
+	value := prop.Value
+	if strings.EqualFold(prop.Params["VALUE"], "DATE") || len(value) == len(dateFormat) {
+		return time.ParseInLocation(dateFormat, value, time.Local)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeFormat, value)
+	}
+	loc := time.Local
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation(localDateTimeForm, value, loc)
+}
+
+// splitList splits a comma separated text list, escaped commas are kept
+func splitList(value string) []string {
+	var items []string
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			b.WriteByte(value[i])
+			b.WriteByte(value[i+1])
+			i++
+			continue
+		}
+		if value[i] == ',' {
+			items = append(items, unescapeText(b.String()))
+			b.Reset()
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+	items = append(items, unescapeText(b.String()))
+	return items
+}
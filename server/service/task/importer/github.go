@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// githubIssue covers both `gh issue list --json ...` and the REST API,
+// which differ in the case of their keys
+type githubIssue struct {
+	Number      int64           `json:"number"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	State       string          `json:"state"`
+	URL         string          `json:"url"`
+	HTMLURL     string          `json:"html_url"`
+	RepoURL     string          `json:"repository_url"`
+	CreatedAt   string          `json:"createdAt"`
+	CreatedAtV3 string          `json:"created_at"`
+	ClosedAt    string          `json:"closedAt"`
+	ClosedAtV3  string          `json:"closed_at"`
+	Labels      []githubLabel   `json:"labels"`
+	Comments    json.RawMessage `json:"comments"`
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+type githubComment struct {
+	Body string `json:"body"`
+}
+
+var (
+	githubRepoRegex      = regexp.MustCompile(`github\.com/([^/]+/[^/]+)/(?:issues|pull)/(\d+)`)
+	githubAPIRepoRegex   = regexp.MustCompile(`/repos/([^/]+/[^/]+?)/?$`)
+	githubChecklistRegex = regexp.MustCompile(`^\s*[-*] \[([ xX])\] (.*)$`)
+	githubRefRegex       = regexp.MustCompile(`^(?:([\w.-]+/[\w.-]+))?#(\d+)$`)
+)
+
+// ParseGitHub reads a JSON array of issues, as written by
+// `gh issue list --json number,title,body,state,url,createdAt,closedAt,labels,comments`
+// or returned by the REST API.
+//
+// The body and the comments become notes, closed issues are done, labels
+// naming a mode set it. Checklist items of the body become subtasks, an
+// item referring to another issue of the export, like `- [ ] #12`, puts
+// that issue there instead.
+func ParseGitHub(data []byte, mode model.TaskMode) ([]*model.TaskItem, error) {
+	var issues []*githubIssue
+	if err := json.Unmarshal(data, &issues); err != nil {
+		return nil, fmt.Errorf("invalid github export: %w", err)
+	}
+	var tasks []*model.TaskItem
+	byRef := make(map[string]*model.TaskItem)
+	repoOf := make(map[*model.TaskItem]string)
+	bodyOf := make(map[*model.TaskItem]string)
+	for _, issue := range issues {
+		if issue == nil {
+			continue
+		}
+		var labels []string
+		for _, label := range issue.Labels {
+			labels = append(labels, label.Name)
+		}
+		task := newTask(issue.Title, modeOf(labels, mode))
+		repo, number := issue.ref()
+		if repo == "" {
+			return nil, fmt.Errorf("issue #%d has no url, cannot tell its repository, export with the url field", number)
+		}
+		task.ExternalID = githubExternalID(repo, number)
+		var err error
+		if created := firstNonEmpty(issue.CreatedAt, issue.CreatedAtV3); created != "" {
+			if task.StartTime, err = parseTime(created, time.RFC3339); err != nil {
+				return nil, err
+			}
+		}
+		if strings.EqualFold(issue.State, "closed") {
+			task.Status = model.TaskStatusDone
+			if task.DoneTime, err = parseTime(firstNonEmpty(issue.ClosedAt, issue.ClosedAtV3), time.RFC3339); err != nil {
+				return nil, err
+			}
+		}
+		if body := strings.TrimSpace(issue.Body); body != "" {
+			task.Notes = append(task.Notes, body)
+		}
+		comments, err := parseGitHubComments(issue.Comments)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			if body := strings.TrimSpace(comment.Body); body != "" {
+				task.Notes = append(task.Notes, body)
+			}
+		}
+		tasks = append(tasks, task)
+		byRef[task.ExternalID] = task
+		repoOf[task] = repo
+		bodyOf[task] = issue.Body
+	}
+
+	parents := make(map[*model.TaskItem]*model.TaskItem)
+	for _, task := range tasks {
+		n := 0
+		for _, line := range strings.Split(bodyOf[task], "\n") {
+			m := githubChecklistRegex.FindStringSubmatch(strings.TrimRight(line, "\r"))
+			if m == nil {
+				continue
+			}
+			text := strings.TrimSpace(m[2])
+			if ref := githubRefRegex.FindStringSubmatch(text); ref != nil {
+				repo := ref[1]
+				if repo == "" {
+					repo = repoOf[task]
+				}
+				number, _ := strconv.ParseInt(ref[2], 10, 64)
+				if issue, ok := byRef[githubExternalID(repo, number)]; ok && issue != task {
+					if _, ok := parents[issue]; !ok {
+						parents[issue] = task
+					}
+					continue
+				}
+			}
+			n++
+			item := newTask(text, task.Mode)
+			item.ExternalID = fmt.Sprintf("%s/item/%d", task.ExternalID, n)
+			item.StartTime = task.StartTime
+			if m[1] != " " {
+				item.Status = model.TaskStatusDone
+				item.DoneTime = task.DoneTime
+			}
+			task.SubTasks = append(task.SubTasks, item)
+		}
+	}
+	return attach(tasks, func(task *model.TaskItem) *model.TaskItem {
+		return parents[task]
+	}), nil
+}
+
+// ref returns the repository, empty if unknown, and the number of the issue
+func (c *githubIssue) ref() (string, int64) {
+	if m := githubRepoRegex.FindStringSubmatch(firstNonEmpty(c.URL, c.HTMLURL)); m != nil {
+		number, _ := strconv.ParseInt(m[2], 10, 64)
+		return m[1], number
+	}
+	if m := githubAPIRepoRegex.FindStringSubmatch(c.RepoURL); m != nil {
+		return m[1], c.Number
+	}
+	return "", c.Number
+}
+
+func githubExternalID(repo string, number int64) string {
+	return fmt.Sprintf("github:%s#%d", repo, number)
+}
+
+// parseGitHubComments accepts the comment list of gh, the REST API
+// only gives a count
+func parseGitHubComments(raw json.RawMessage) ([]*githubComment, error) {
+	if len(raw) == 0 || raw[0] != '[' {
+		return nil, nil
+	}
+	var comments []*githubComment
+	if err := json.Unmarshal(raw, &comments); err != nil {
+		return nil, fmt.Errorf("invalid comments: %w", err)
+	}
+	return comments, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+// Package importer reads the exports of other task tools as task trees.
+//
+// Every imported task carries an ExternalID naming its origin, e.g.
+// `taskwarrior:<uuid>`, `github:owner/repo#12` or `jira:PROJ-12`, which
+// Dedupe uses to skip tasks imported before.
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+type Source string
+
+const (
+	SourceTaskwarrior Source = "taskwarrior"
+	SourceGitHub      Source = "github"
+	SourceJira        Source = "jira"
+)
+
+func ParseSource(s string) (Source, error) {
+	switch source := Source(strings.ToLower(s)); source {
+	case SourceTaskwarrior, SourceGitHub, SourceJira:
+		return source, nil
+	}
+	return "", fmt.Errorf("unknown source: %s, expect taskwarrior, github or jira", s)
+}
+
+// Parse reads an export of source, tasks without a mode of their own get mode
+func Parse(source Source, data []byte, mode model.TaskMode) ([]*model.TaskItem, error) {
+	switch source {
+	case SourceTaskwarrior:
+		return ParseTaskwarrior(data, mode)
+	case SourceGitHub:
+		return ParseGitHub(data, mode)
+	case SourceJira:
+		return ParseJira(data, mode)
+	}
+	return nil, fmt.Errorf("unknown source: %s", source)
+}
+
+type Skipped struct {
+	ExternalID string `json:"externalID"`
+	Title      string `json:"title"`
+	// TaskID is the existing task with the same external ID or ID,
+	// 0 if the task is repeated in the import itself
+	TaskID int64 `json:"taskID,omitempty"`
+}
+
+type Plan struct {
+	// Tasks are the trees to add, a top level task with ParentID goes
+	// under that existing task
+	Tasks   []*model.TaskItem `json:"tasks"`
+	Skipped []*Skipped        `json:"skipped"`
+}
+
+// Dedupe leaves out the imported tasks whose external ID is already in
+// existing, or whose ID is that of an existing task as parsed back from
+// our own exports, their new subtasks go under the existing task instead.
+// A task repeated in the import is kept once, the subtasks of the
+// repetitions go under the first one.
+func Dedupe(existing []*model.TaskItem, tasks []*model.TaskItem) *Plan {
+	known := make(map[string]int64)
+	ids := make(map[int64]bool)
+	model.WalkTasks(existing, func(task *model.TaskItem, depth int) bool {
+		if task.ExternalID != "" {
+			known[task.ExternalID] = task.ID
+		}
+		ids[task.ID] = true
+		return true
+	})
+	plan := &Plan{
+		Tasks:   []*model.TaskItem{},
+		Skipped: []*Skipped{},
+	}
+	// seen maps external IDs to the first task having them, pending are
+	// the subtasks of repetitions found while the first is being walked
+	seen := make(map[string]*model.TaskItem)
+	pending := make(map[*model.TaskItem][]*model.TaskItem)
+	finished := make(map[*model.TaskItem]bool)
+	var walk func(tasks []*model.TaskItem, parent *model.TaskItem, existingParentID int64) []*model.TaskItem
+	walk = func(tasks []*model.TaskItem, parent *model.TaskItem, existingParentID int64) []*model.TaskItem {
+		kept := []*model.TaskItem{}
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			if task.ID != 0 && ids[task.ID] {
+				plan.Skipped = append(plan.Skipped, &Skipped{ExternalID: task.ExternalID, Title: task.Title, TaskID: task.ID})
+				walk(task.SubTasks, nil, task.ID)
+				continue
+			}
+			if task.ExternalID != "" {
+				if id, ok := known[task.ExternalID]; ok {
+					plan.Skipped = append(plan.Skipped, &Skipped{ExternalID: task.ExternalID, Title: task.Title, TaskID: id})
+					walk(task.SubTasks, nil, id)
+					continue
+				}
+				if first, ok := seen[task.ExternalID]; ok {
+					plan.Skipped = append(plan.Skipped, &Skipped{ExternalID: task.ExternalID, Title: task.Title})
+					subTasks := walk(task.SubTasks, first, 0)
+					if finished[first] {
+						first.SubTasks = append(first.SubTasks, subTasks...)
+					} else {
+						pending[first] = append(pending[first], subTasks...)
+					}
+					continue
+				}
+				seen[task.ExternalID] = task
+			}
+			task.SubTasks = append(walk(task.SubTasks, task, 0), pending[task]...)
+			delete(pending, task)
+			finished[task] = true
+			if parent == nil {
+				task.ParentID = existingParentID
+				plan.Tasks = append(plan.Tasks, task)
+				continue
+			}
+			kept = append(kept, task)
+		}
+		return kept
+	}
+	walk(tasks, nil, 0)
+	return plan
+}
+
+// newTask creates a task with the defaults of AddTask
+func newTask(title string, mode model.TaskMode) *model.TaskItem {
+	return &model.TaskItem{
+		Title:     title,
+		StartTime: model.ToSwiftTimestamp(time.Now()),
+		SubTasks:  []*model.TaskItem{},
+		Mode:      mode,
+		Status:    model.TaskStatusCreated,
+		Notes:     []string{},
+	}
+}
+
+// modeOf returns the first label naming a mode
+func modeOf(labels []string, mode model.TaskMode) model.TaskMode {
+	for _, label := range labels {
+		switch m := model.TaskMode(strings.ToLower(label)); m {
+		case model.TaskModeWork, model.TaskModeLife:
+			return m
+		}
+	}
+	return mode
+}
+
+// parseTime parses the first layout matching s, zero if s is empty
+func parseTime(s string, layouts ...string) (model.SwiftTimestamp, error) {
+	if s == "" {
+		return 0, nil
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return model.ToSwiftTimestamp(t), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time: %s", s)
+}
+
+// attach nests tasks under the parent named by parentOf, following
+// the input order, links to unknown tasks or forming a cycle are dropped
+func attach(tasks []*model.TaskItem, parentOf func(task *model.TaskItem) *model.TaskItem) []*model.TaskItem {
+	roots := []*model.TaskItem{}
+	for _, task := range tasks {
+		parent := parentOf(task)
+		for p, n := parent, 0; p != nil && n <= len(tasks); p, n = parentOf(p), n+1 {
+			if p == task {
+				parent = nil
+				break
+			}
+		}
+		if parent == nil {
+			roots = append(roots, task)
+			continue
+		}
+		parent.SubTasks = append(parent.SubTasks, task)
+	}
+	return roots
+}
@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func titles(tasks []*model.TaskItem) string {
+	var parts []string
+	for _, task := range tasks {
+		s := task.Title
+		if len(task.SubTasks) > 0 {
+			s += "(" + titles(task.SubTasks) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDedupe(t *testing.T) {
+	existing := []*model.TaskItem{
+		{ID: 1, Title: "Known", ExternalID: "jira:P-1"},
+	}
+	tasks := []*model.TaskItem{
+		{Title: "Known again", ExternalID: "jira:P-1", SubTasks: []*model.TaskItem{
+			{Title: "New under known", ExternalID: "jira:P-2"},
+		}},
+		{Title: "Epic", ExternalID: "jira:P-3", SubTasks: []*model.TaskItem{
+			{Title: "Story", ExternalID: "jira:P-4"},
+		}},
+		{Title: "Epic repeated", ExternalID: "jira:P-3", SubTasks: []*model.TaskItem{
+			{Title: "Other story", ExternalID: "jira:P-5"},
+			{Title: "Story repeated", ExternalID: "jira:P-4", SubTasks: []*model.TaskItem{
+				{Title: "Subtask", ExternalID: "jira:P-6"},
+			}},
+		}},
+		{Title: "Exported by us", ID: 1},
+	}
+	plan := Dedupe(existing, tasks)
+	if actual, expect := titles(plan.Tasks), "New under known Epic(Story(Subtask) Other story)"; actual != expect {
+		t.Fatalf("expect %q, actual: %q", expect, actual)
+	}
+	if plan.Tasks[0].ParentID != 1 {
+		t.Fatalf("expect the new subtask of a known task under it, actual parent: %d", plan.Tasks[0].ParentID)
+	}
+	var skipped []string
+	for _, s := range plan.Skipped {
+		skipped = append(skipped, s.Title)
+	}
+	if actual, expect := strings.Join(skipped, ","), "Known again,Epic repeated,Story repeated,Exported by us"; actual != expect {
+		t.Fatalf("expect skipped %q, actual: %q", expect, actual)
+	}
+}
+
+func TestParseGitHubRepo(t *testing.T) {
+	data := `[
+		{"number": 12, "title": "From gh", "state": "open", "url": "https://github.com/a/one/issues/12"},
+		{"number": 12, "title": "From the API", "state": "open", "repository_url": "https://api.github.com/repos/b/two"}
+	]`
+	tasks, err := ParseGitHub([]byte(data), model.TaskModeWork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].ExternalID != "github:a/one#12" || tasks[1].ExternalID != "github:b/two#12" {
+		t.Fatalf("unexpected external ids: %s", titles(tasks))
+	}
+
+	_, err = ParseGitHub([]byte(`[{"number": 12, "title": "No url"}]`), model.TaskModeWork)
+	if err == nil || !strings.Contains(err.Error(), "no url") {
+		t.Fatalf("expect error for an issue without url, actual: %v", err)
+	}
+}
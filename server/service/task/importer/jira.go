@@ -0,0 +1,175 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+const (
+	jiraTime = "2006-01-02T15:04:05.000-0700"
+	jiraDate = "2006-01-02"
+)
+
+type jiraExport struct {
+	Issues []*jiraIssue `json:"issues"`
+}
+
+type jiraIssue struct {
+	Key    string      `json:"key"`
+	Fields *jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Summary        string          `json:"summary"`
+	Description    json.RawMessage `json:"description"`
+	Created        string          `json:"created"`
+	DueDate        string          `json:"duedate"`
+	ResolutionDate string          `json:"resolutiondate"`
+	Labels         []string        `json:"labels"`
+	Status         *struct {
+		StatusCategory *struct {
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	} `json:"status"`
+	Priority *struct {
+		Name string `json:"name"`
+	} `json:"priority"`
+	Parent *struct {
+		Key string `json:"key"`
+	} `json:"parent"`
+	Comment *struct {
+		Comments []*struct {
+			Body json.RawMessage `json:"body"`
+		} `json:"comments"`
+	} `json:"comment"`
+}
+
+var jiraPriorities = map[string]string{
+	"highest": "A",
+	"high":    "B",
+	"medium":  "C",
+	"low":     "D",
+	"lowest":  "E",
+}
+
+// ParseJira reads the issues of a Jira search, either the response
+// `{"issues":[...]}` or the bare list.
+//
+// Issues whose status category is done are done, subtasks and the issues
+// of an epic go under their parent. The description and comments, plain
+// text or Atlassian Document Format, become notes, labels naming a mode set it.
+func ParseJira(data []byte, mode model.TaskMode) ([]*model.TaskItem, error) {
+	var issues []*jiraIssue
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(data, &issues); err != nil {
+			return nil, fmt.Errorf("invalid jira export: %w", err)
+		}
+	} else {
+		var export jiraExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, fmt.Errorf("invalid jira export: %w", err)
+		}
+		issues = export.Issues
+	}
+	var tasks []*model.TaskItem
+	byKey := make(map[string]*model.TaskItem)
+	parentKeys := make(map[*model.TaskItem]string)
+	for _, issue := range issues {
+		if issue == nil || issue.Fields == nil {
+			continue
+		}
+		fields := issue.Fields
+		task := newTask(fields.Summary, modeOf(fields.Labels, mode))
+		task.ExternalID = "jira:" + issue.Key
+		var err error
+		if fields.Created != "" {
+			if task.StartTime, err = parseTime(fields.Created, jiraTime, jiraDate); err != nil {
+				return nil, err
+			}
+		}
+		if task.DueTime, err = parseTime(fields.DueDate, jiraDate); err != nil {
+			return nil, err
+		}
+		if fields.Status != nil && fields.Status.StatusCategory != nil && fields.Status.StatusCategory.Key == "done" {
+			task.Status = model.TaskStatusDone
+			if task.DoneTime, err = parseTime(fields.ResolutionDate, jiraTime, jiraDate); err != nil {
+				return nil, err
+			}
+		}
+		if fields.Priority != nil {
+			task.Priority = jiraPriorities[strings.ToLower(fields.Priority.Name)]
+		}
+		if text := jiraText(fields.Description); text != "" {
+			task.Notes = append(task.Notes, text)
+		}
+		if fields.Comment != nil {
+			for _, comment := range fields.Comment.Comments {
+				if comment == nil {
+					continue
+				}
+				if text := jiraText(comment.Body); text != "" {
+					task.Notes = append(task.Notes, text)
+				}
+			}
+		}
+		if fields.Parent != nil {
+			parentKeys[task] = fields.Parent.Key
+		}
+		tasks = append(tasks, task)
+		byKey[issue.Key] = task
+	}
+	return attach(tasks, func(task *model.TaskItem) *model.TaskItem {
+		return byKey[parentKeys[task]]
+	}), nil
+}
+
+// adfNode is a node of the Atlassian Document Format used by the v3 API
+type adfNode struct {
+	Type    string     `json:"type"`
+	Text    string     `json:"text"`
+	Content []*adfNode `json:"content"`
+}
+
+// jiraText returns the plain text of a v2 string or a v3 document
+func jiraText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var doc adfNode
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	doc.writeText(&b)
+	return strings.TrimSpace(b.String())
+}
+
+func (c *adfNode) writeText(b *strings.Builder) {
+	switch c.Type {
+	case "text":
+		b.WriteString(c.Text)
+		return
+	case "hardBreak":
+		b.WriteString("\n")
+		return
+	}
+	for _, child := range c.Content {
+		if child != nil {
+			child.writeText(b)
+		}
+	}
+	switch c.Type {
+	case "paragraph", "heading", "listItem", "codeBlock", "blockquote":
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+}
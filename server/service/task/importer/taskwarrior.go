@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// taskwarriorTime is the format of dates in `task export`
+const taskwarriorTime = "20060102T150405Z"
+
+type taskwarriorTask struct {
+	UUID        string                  `json:"uuid"`
+	Description string                  `json:"description"`
+	Status      string                  `json:"status"`
+	Entry       string                  `json:"entry"`
+	End         string                  `json:"end"`
+	Due         string                  `json:"due"`
+	Project     string                  `json:"project"`
+	Priority    string                  `json:"priority"`
+	Tags        []string                `json:"tags"`
+	Depends     json.RawMessage         `json:"depends"`
+	Annotations []taskwarriorAnnotation `json:"annotations"`
+}
+
+type taskwarriorAnnotation struct {
+	Entry       string `json:"entry"`
+	Description string `json:"description"`
+}
+
+var taskwarriorPriorities = map[string]string{
+	"H": "A",
+	"M": "B",
+	"L": "C",
+}
+
+// ParseTaskwarrior reads the JSON array written by `task export`.
+//
+// Deleted tasks are left out, completed ones are done. A task depending on
+// others is their parent, tasks with a project go under a task per project
+// level, e.g. Home.Garden. Annotations become notes, tags naming a mode set it.
+func ParseTaskwarrior(data []byte, mode model.TaskMode) ([]*model.TaskItem, error) {
+	var items []*taskwarriorTask
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid taskwarrior export: %w", err)
+	}
+	var tasks []*model.TaskItem
+	byUUID := make(map[string]*model.TaskItem)
+	projectOf := make(map[*model.TaskItem]string)
+	// parents maps a dependency to the first task depending on it
+	parents := make(map[string]*model.TaskItem)
+	var depends [][]string
+	for _, item := range items {
+		if item == nil || item.Status == "deleted" {
+			continue
+		}
+		task := newTask(item.Description, modeOf(item.Tags, mode))
+		task.ExternalID = "taskwarrior:" + item.UUID
+		var err error
+		if item.Entry != "" {
+			if task.StartTime, err = parseTime(item.Entry, taskwarriorTime); err != nil {
+				return nil, err
+			}
+		}
+		if task.DueTime, err = parseTime(item.Due, taskwarriorTime); err != nil {
+			return nil, err
+		}
+		if item.Status == "completed" {
+			task.Status = model.TaskStatusDone
+			if task.DoneTime, err = parseTime(item.End, taskwarriorTime); err != nil {
+				return nil, err
+			}
+		}
+		task.Priority = taskwarriorPriorities[item.Priority]
+		for _, annotation := range item.Annotations {
+			task.Notes = append(task.Notes, annotation.Description)
+		}
+		deps, err := parseDepends(item.Depends)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+		byUUID[item.UUID] = task
+		projectOf[task] = item.Project
+		depends = append(depends, deps)
+	}
+	for i, task := range tasks {
+		for _, dep := range depends[i] {
+			if _, ok := parents[dep]; !ok {
+				parents[dep] = task
+			}
+		}
+	}
+	uuidOf := make(map[*model.TaskItem]string, len(byUUID))
+	for uuid, task := range byUUID {
+		uuidOf[task] = uuid
+	}
+	roots := attach(tasks, func(task *model.TaskItem) *model.TaskItem {
+		return parents[uuidOf[task]]
+	})
+
+	// group top level tasks by project
+	result := []*model.TaskItem{}
+	projects := make(map[string]*model.TaskItem)
+	var projectTask func(name string, mode model.TaskMode) *model.TaskItem
+	projectTask = func(name string, mode model.TaskMode) *model.TaskItem {
+		if t, ok := projects[name]; ok {
+			return t
+		}
+		title := name
+		var parent *model.TaskItem
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			parent = projectTask(name[:i], mode)
+			title = name[i+1:]
+		}
+		t := newTask(title, mode)
+		t.ExternalID = "taskwarrior:project:" + name
+		if parent != nil {
+			parent.SubTasks = append(parent.SubTasks, t)
+		} else {
+			result = append(result, t)
+		}
+		projects[name] = t
+		return t
+	}
+	for _, task := range roots {
+		if project := projectOf[task]; project != "" {
+			p := projectTask(project, task.Mode)
+			p.SubTasks = append(p.SubTasks, task)
+			continue
+		}
+		result = append(result, task)
+	}
+	return result, nil
+}
+
+// parseDepends accepts both the array of newer versions and
+// the comma separated string of older ones
+func parseDepends(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("invalid depends: %s", raw)
+	}
+	if s == "" {
+		return nil, nil
+	}
+	return strings.Split(s, ","), nil
+}
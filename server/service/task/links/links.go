@@ -0,0 +1,148 @@
+// Package links finds references to pull requests, issues, dashboards
+// and docs in text, and matches them against URLs or short references
+// like #12, owner/repo#12 or PROJ-12.
+package links
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var (
+	markdownLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\((https?://[^\s)]+)\)`)
+	urlRegex          = regexp.MustCompile(`https?://[^\s<>()"'\[\]]+`)
+
+	githubRegex = regexp.MustCompile(`^/([^/]+)/([^/]+)/(pull|issues|commit)/([0-9A-Za-z]+)`)
+	gitlabRegex = regexp.MustCompile(`^/(.+?)/-/(merge_requests|issues|commit)/([0-9A-Za-z]+)`)
+	jiraRegex   = regexp.MustCompile(`^/browse/([A-Z][A-Z0-9]+-[0-9]+)`)
+)
+
+// Extract finds the links in text, in order of appearance without duplicates.
+// The text of a markdown link [title](url) is its title.
+func Extract(text string) []*model.TaskLink {
+	titles := make(map[int]string)
+	for _, m := range markdownLinkRegex.FindAllStringSubmatchIndex(text, -1) {
+		titles[m[4]] = strings.TrimSpace(text[m[2]:m[3]])
+	}
+	var found []*model.TaskLink
+	seen := make(map[string]bool)
+	for _, m := range urlRegex.FindAllStringIndex(text, -1) {
+		rawURL := strings.TrimRight(text[m[0]:m[1]], ".,;:!?")
+		if seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+		link := Classify(rawURL)
+		link.Title = titles[m[0]]
+		found = append(found, link)
+	}
+	return found
+}
+
+// Classify guesses the kind and external ID of a URL
+func Classify(rawURL string) *model.TaskLink {
+	link := &model.TaskLink{URL: rawURL, Kind: model.LinkKindOther}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return link
+	}
+	host := strings.ToLower(u.Hostname())
+	path := u.Path
+	switch {
+	case host == "github.com":
+		if m := githubRegex.FindStringSubmatch(path); m != nil {
+			repo := m[1] + "/" + m[2]
+			switch m[3] {
+			case "pull":
+				link.Kind = model.LinkKindPR
+				link.ExternalID = "github:" + repo + "#" + m[4]
+			case "issues":
+				link.Kind = model.LinkKindIssue
+				link.ExternalID = "github:" + repo + "#" + m[4]
+			case "commit":
+				link.Kind = model.LinkKindCommit
+				link.ExternalID = "github:" + repo + "@" + m[4]
+			}
+		}
+	case strings.Contains(host, "gitlab"):
+		if m := gitlabRegex.FindStringSubmatch(path); m != nil {
+			switch m[2] {
+			case "merge_requests":
+				link.Kind = model.LinkKindPR
+				link.ExternalID = "gitlab:" + m[1] + "!" + m[3]
+			case "issues":
+				link.Kind = model.LinkKindIssue
+				link.ExternalID = "gitlab:" + m[1] + "#" + m[3]
+			case "commit":
+				link.Kind = model.LinkKindCommit
+				link.ExternalID = "gitlab:" + m[1] + "@" + m[3]
+			}
+		}
+	case jiraRegex.MatchString(path):
+		link.Kind = model.LinkKindIssue
+		link.ExternalID = "jira:" + jiraRegex.FindStringSubmatch(path)[1]
+	case strings.Contains(host, "grafana") || strings.HasPrefix(path, "/d/"):
+		link.Kind = model.LinkKindDashboard
+	case host == "docs.google.com" || strings.Contains(host, "notion.") ||
+		strings.Contains(host, "confluence") || strings.Contains(host, "wiki") ||
+		strings.HasSuffix(path, ".md") || strings.HasSuffix(path, ".pdf"):
+		link.Kind = model.LinkKindDoc
+	}
+	return link
+}
+
+// Complete returns the link with the kind and external ID guessed
+// from the URL if not given
+func Complete(link *model.TaskLink) *model.TaskLink {
+	if link.Kind != "" && (link.ExternalID != "" || link.Kind == model.LinkKindOther) {
+		return link
+	}
+	guess := Classify(link.URL)
+	l := *link
+	if l.Kind == "" {
+		l.Kind = guess.Kind
+	}
+	if l.ExternalID == "" {
+		l.ExternalID = guess.ExternalID
+	}
+	return &l
+}
+
+// Merge appends the links of found whose URL is not in links yet
+func Merge(links []*model.TaskLink, found []*model.TaskLink) (merged []*model.TaskLink, added []*model.TaskLink) {
+	merged = model.CloneLinks(links)
+	seen := make(map[string]bool, len(links))
+	for _, link := range links {
+		if link != nil {
+			seen[NormalizeURL(link.URL)] = true
+		}
+	}
+	for _, link := range found {
+		key := NormalizeURL(link.URL)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		l := *link
+		merged = append(merged, &l)
+		added = append(added, &l)
+	}
+	return merged, added
+}
+
+// NormalizeURL makes URLs differing only in scheme, host case,
+// a trailing slash or the fragment equal
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+	u.Scheme = "https"
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
@@ -0,0 +1,72 @@
+package links
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var (
+	numberRefRegex = regexp.MustCompile(`^#?([0-9]+)$`)
+	repoRefRegex   = regexp.MustCompile(`^([^\s#!:]+/[^\s#!:]+)([#!])([0-9]+)$`)
+	jiraKeyRegex   = regexp.MustCompile(`^[A-Z][A-Z0-9]+-[0-9]+$`)
+)
+
+// Matcher returns a function telling whether a link matches ref, which is
+// one of:
+//   - a URL, matching links to the same URL or the same PR, issue or commit
+//   - an external ID like github:owner/repo#12 or jira:PROJ-12
+//   - owner/repo#12, a GitHub or GitLab issue or PR, ! for a merge request
+//   - #12 or 12, a PR or issue number in any repository
+//   - PROJ-12, a Jira issue
+func Matcher(ref string) (func(link *model.TaskLink) bool, error) {
+	match, err := matcher(ref)
+	if err != nil {
+		return nil, err
+	}
+	return func(link *model.TaskLink) bool {
+		return link != nil && match(Complete(link))
+	}, nil
+}
+
+func matcher(ref string) (func(link *model.TaskLink) bool, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("empty reference")
+	}
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		normalized := NormalizeURL(ref)
+		externalID := Classify(ref).ExternalID
+		return func(link *model.TaskLink) bool {
+			if externalID != "" && strings.EqualFold(link.ExternalID, externalID) {
+				return true
+			}
+			return NormalizeURL(link.URL) == normalized
+		}, nil
+	}
+	if m := numberRefRegex.FindStringSubmatch(ref); m != nil {
+		return func(link *model.TaskLink) bool {
+			if link.Kind != model.LinkKindPR && link.Kind != model.LinkKindIssue {
+				return false
+			}
+			return strings.HasSuffix(link.ExternalID, "#"+m[1]) || strings.HasSuffix(link.ExternalID, "!"+m[1])
+		}, nil
+	}
+	if m := repoRefRegex.FindStringSubmatch(ref); m != nil {
+		suffix := strings.ToLower(":" + ref)
+		return func(link *model.TaskLink) bool {
+			return strings.HasSuffix(strings.ToLower(link.ExternalID), suffix)
+		}, nil
+	}
+	if jiraKeyRegex.MatchString(ref) {
+		ref = "jira:" + ref
+	}
+	if strings.Contains(ref, ":") {
+		return func(link *model.TaskLink) bool {
+			return strings.EqualFold(link.ExternalID, ref)
+		}, nil
+	}
+	return nil, fmt.Errorf("unrecognized reference: %s, expect a URL, #12, owner/repo#12 or PROJ-12", ref)
+}
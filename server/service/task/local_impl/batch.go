@@ -0,0 +1,150 @@
+package local_impl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+// Batch applies all operations in order within one write,
+// if any of them fails nothing is written.
+func (s *LocalStorage) Batch(ops []*model.BatchOperation) ([]*model.BatchResult, error) {
+	var results []*model.BatchResult
+	err := s.update(func(tree *taskTree) error {
+		var err error
+		results, err = tree.batch(ops)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// refTable maps refs to the ids of tasks added earlier in a batch
+type refTable map[string]int64
+
+func (c refTable) resolve(id int64, ref string) (int64, error) {
+	if ref == "" {
+		return id, nil
+	}
+	refID, ok := c[ref]
+	if !ok {
+		return 0, fmt.Errorf("unknown ref: %s", ref)
+	}
+	return refID, nil
+}
+
+func (t *taskTree) batch(ops []*model.BatchOperation) ([]*model.BatchResult, error) {
+	refs := make(refTable)
+	results := make([]*model.BatchResult, 0, len(ops))
+	for i, op := range ops {
+		result, err := t.apply(op, refs)
+		if err != nil {
+			var opType model.BatchOpType
+			if op != nil {
+				opType = op.Op
+			}
+			return nil, &task.BatchOpError{Index: i, Op: opType, Err: err}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// apply applies a single operation, the tree is left unchanged if it fails
+func (t *taskTree) apply(op *model.BatchOperation, refs refTable) (*model.BatchResult, error) {
+	if op == nil {
+		return nil, errors.New("empty operation")
+	}
+	if op.Ref != "" {
+		if _, ok := refs[op.Ref]; ok {
+			return nil, fmt.Errorf("duplicate ref: %s", op.Ref)
+		}
+	}
+	result, err := t.applyOp(op, refs.resolve)
+	if err != nil {
+		return nil, err
+	}
+	if op.Ref != "" {
+		refs[op.Ref] = result.TaskID
+		result.Ref = op.Ref
+	}
+	return result, nil
+}
+
+func (t *taskTree) applyOp(op *model.BatchOperation, resolve func(id int64, ref string) (int64, error)) (*model.BatchResult, error) {
+	result := &model.BatchResult{Op: op.Op}
+	if op.Op == model.BatchOpAdd {
+		if op.Task == nil {
+			return nil, errors.New("requires task")
+		}
+		if len(op.Task.SubTasks) > 0 {
+			return nil, errors.New("subtasks must be added by their own add ops with parentRef")
+		}
+		parentID, err := resolve(op.ParentID, op.ParentRef)
+		if err != nil {
+			return nil, err
+		}
+		input := op.Task.ShallowClone()
+		input.SubTasks = nil
+		if parentID != 0 {
+			input.ParentID = parentID
+		}
+		index := 0
+		if op.Index != nil {
+			index = *op.Index
+		}
+		added, err := t.add(input, index)
+		if err != nil {
+			return nil, err
+		}
+		result.TaskID = added.ID
+		result.Task = added.ShallowClone()
+		return result, nil
+	}
+
+	taskID, err := resolve(op.TaskID, op.TaskRef)
+	if err != nil {
+		return nil, err
+	}
+	if taskID == 0 {
+		return nil, errors.New("requires taskID or taskRef")
+	}
+	result.TaskID = taskID
+	if err := t.checkRevision(taskID, op.ExpectedRevision); err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case model.BatchOpUpdate:
+		err = t.update(taskID, op.Update)
+	case model.BatchOpRemove:
+		err = t.remove(taskID)
+	case model.BatchOpMove:
+		var parentID int64
+		parentID, err = resolve(op.ParentID, op.ParentRef)
+		if err != nil {
+			return nil, err
+		}
+		index := -1
+		if op.Index != nil {
+			index = *op.Index
+		}
+		err = t.move(taskID, parentID, index)
+	case model.BatchOpNote:
+		if op.NoteIndex != nil {
+			err = t.updateNote(taskID, *op.NoteIndex, op.Note)
+		} else {
+			err = t.addNote(taskID, op.Note)
+		}
+	default:
+		return nil, fmt.Errorf("unknown op: %q", op.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
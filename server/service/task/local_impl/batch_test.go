@@ -0,0 +1,151 @@
+package local_impl
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newBatchStorage(t *testing.T) *LocalStorage {
+	s := New(filepath.Join(t.TempDir(), "tasks.json"))
+	if _, err := s.AddTask(&model.TaskItem{Title: "Release", Status: model.TaskStatusCreated}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestBatchRefs(t *testing.T) {
+	s := newBatchStorage(t)
+	results, err := s.Batch([]*model.BatchOperation{
+		{Op: model.BatchOpAdd, Ref: "plan", Task: &model.TaskItem{Title: "Plan"}},
+		{Op: model.BatchOpAdd, Ref: "draft", ParentRef: "plan", Task: &model.TaskItem{Title: "Draft"}},
+		{Op: model.BatchOpUpdate, TaskRef: "draft", Update: &model.TaskUpdate{Title: ptr("Draft v1")}},
+		{Op: model.BatchOpMove, TaskID: 1, ParentRef: "plan"},
+		{Op: model.BatchOpNote, TaskRef: "plan", Note: "kickoff"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 || results[0].Ref != "plan" || results[1].Ref != "draft" {
+		t.Fatalf("unexpected results: %s", toJSON(results))
+	}
+	planID, draftID := results[0].TaskID, results[1].TaskID
+	if results[2].TaskID != draftID || results[4].TaskID != planID {
+		t.Fatalf("expect refs resolved to the added tasks, actual: %s", toJSON(results))
+	}
+
+	tasks, err := s.readTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != planID || len(tasks[0].Notes) != 1 {
+		t.Fatalf("expect plan as the only root, actual: %s", toJSON(tasks))
+	}
+	sub := tasks[0].SubTasks
+	if len(sub) != 2 || sub[0].ID != draftID || sub[0].Title != "Draft v1" || sub[1].ID != 1 {
+		t.Fatalf("expect draft and release under plan, actual: %s", toJSON(sub))
+	}
+}
+
+func TestBatchFailureLeavesTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    *model.BatchOperation
+		index int
+		check func(err error) bool
+	}{
+		{
+			name:  "unknown ref",
+			op:    &model.BatchOperation{Op: model.BatchOpRemove, TaskRef: "missing"},
+			index: 2,
+		},
+		{
+			name:  "duplicate ref",
+			op:    &model.BatchOperation{Op: model.BatchOpAdd, Ref: "plan", Task: &model.TaskItem{Title: "Again"}},
+			index: 2,
+		},
+		{
+			name:  "subtasks",
+			op:    &model.BatchOperation{Op: model.BatchOpAdd, Task: &model.TaskItem{Title: "Tree", SubTasks: []*model.TaskItem{{Title: "Leaf"}}}},
+			index: 2,
+		},
+		{
+			name:  "stale revision",
+			op:    &model.BatchOperation{Op: model.BatchOpUpdate, TaskID: 1, ExpectedRevision: ptr(int64(0)), Update: &model.TaskUpdate{Title: ptr("Stale")}},
+			index: 2,
+			check: func(err error) bool {
+				var conflict *task.ConflictError
+				return errors.As(err, &conflict) && conflict.TaskID == 1 && conflict.ActualRevision == 2
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBatchStorage(t)
+			before := readFile(t, s.filename)
+			revision, err := s.Revision()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.Batch([]*model.BatchOperation{
+				{Op: model.BatchOpAdd, Ref: "plan", Task: &model.TaskItem{Title: "Plan"}},
+				{Op: model.BatchOpUpdate, TaskID: 1, Update: &model.TaskUpdate{Title: ptr("Release v2")}},
+				tt.op,
+				{Op: model.BatchOpRemove, TaskID: 1},
+			})
+			var opErr *task.BatchOpError
+			if !errors.As(err, &opErr) || opErr.Index != tt.index || opErr.Op != tt.op.Op {
+				t.Fatalf("expect op[%d] to fail, actual: %v", tt.index, err)
+			}
+			if tt.check != nil && !tt.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if after := readFile(t, s.filename); after != before {
+				t.Fatalf("expect nothing written, actual: %s", after)
+			}
+			if actual, _ := s.Revision(); actual != revision {
+				t.Fatalf("expect store revision %d, actual: %d", revision, actual)
+			}
+		})
+	}
+}
+
+func TestBatchRevision(t *testing.T) {
+	s := newBatchStorage(t)
+	revision, err := s.Revision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Batch([]*model.BatchOperation{
+		{Op: model.BatchOpUpdate, TaskID: 1, ExpectedRevision: ptr(int64(1)), Update: &model.TaskUpdate{Title: ptr("Release v2")}},
+		{Op: model.BatchOpAdd, Task: &model.TaskItem{Title: "Plan"}},
+		{Op: model.BatchOpNote, TaskID: 1, Note: "shipped"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the whole batch is one write
+	if actual, _ := s.Revision(); actual != revision+1 {
+		t.Fatalf("expect store revision %d, actual: %d", revision+1, actual)
+	}
+
+	// the update and the note each bumped the task
+	_, err = s.Batch([]*model.BatchOperation{
+		{Op: model.BatchOpRemove, TaskID: 1, ExpectedRevision: ptr(int64(1))},
+	})
+	var conflict *task.ConflictError
+	if !errors.As(err, &conflict) || conflict.ExpectedRevision != 1 || conflict.ActualRevision != 3 {
+		t.Fatalf("expect conflict with revision 3, actual: %v", err)
+	}
+	if actual, _ := s.Revision(); actual != revision+1 {
+		t.Fatalf("expect store revision %d, actual: %d", revision+1, actual)
+	}
+}
@@ -0,0 +1,169 @@
+package local_impl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// changeLogLimit is the number of changes kept for clients to catch up,
+// the log is compacted to this size once it doubles
+const changeLogLimit = 10000
+
+// changeLog persists committed events as JSON lines next to the tasks file,
+// event ids continue across restarts
+type changeLog struct {
+	filename string
+
+	loaded bool
+	lastID int64
+	count  int
+}
+
+func changeLogFile(tasksFile string) string {
+	ext := filepath.Ext(tasksFile)
+	return strings.TrimSuffix(tasksFile, ext) + ".changes.jsonl"
+}
+
+func (c *changeLog) load() error {
+	if c.loaded {
+		return nil
+	}
+	events, err := c.readAll()
+	if err != nil {
+		return err
+	}
+	c.count = len(events)
+	if len(events) > 0 {
+		c.lastID = events[len(events)-1].ID
+	}
+	c.loaded = true
+	return nil
+}
+
+func (c *changeLog) readAll() ([]*model.TaskEvent, error) {
+	data, err := os.ReadFile(c.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var events []*model.TaskEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var ev model.TaskEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			// a partially written line
+			continue
+		}
+		events = append(events, &ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// append assigns ids to the events and persists them
+func (c *changeLog) append(events []*model.TaskEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := c.load(); err != nil {
+		return err
+	}
+	now := time.Now()
+	var buf bytes.Buffer
+	for _, ev := range events {
+		c.lastID++
+		ev.ID = c.lastID
+		if ev.Time.IsZero() {
+			ev.Time = now
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	f, err := os.OpenFile(c.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	c.count += len(events)
+	if c.count > 2*changeLogLimit {
+		return c.compact()
+	}
+	return nil
+}
+
+func (c *changeLog) compact() error {
+	events, err := c.readAll()
+	if err != nil {
+		return err
+	}
+	if len(events) > changeLogLimit {
+		events = events[len(events)-changeLogLimit:]
+	}
+	var buf bytes.Buffer
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmpFile := c.filename + ".tmp"
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, c.filename); err != nil {
+		return err
+	}
+	c.count = len(events)
+	return nil
+}
+
+// readAfter returns the events after id, ok is false if some of them
+// have been compacted away or the id is unknown to the log
+func (c *changeLog) readAfter(id int64) (events []*model.TaskEvent, lastID int64, ok bool, err error) {
+	all, err := c.readAll()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if len(all) == 0 {
+		return nil, 0, id == 0, nil
+	}
+	lastID = all[len(all)-1].ID
+	if id > lastID || id < all[0].ID-1 {
+		return nil, lastID, false, nil
+	}
+	for _, ev := range all {
+		if ev.ID > id {
+			events = append(events, ev)
+		}
+	}
+	return events, lastID, true, nil
+}
@@ -0,0 +1,84 @@
+package local_impl
+
+import (
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// recordStatus appends a transition to the status history, copying
+// the history as it may be shared with a snapshot
+func recordStatus(task *model.TaskItem, from model.TaskStatus, at model.SwiftTimestamp) {
+	history := make([]*model.StatusChange, len(task.StatusHistory), len(task.StatusHistory)+1)
+	copy(history, task.StatusHistory)
+	task.StatusHistory = append(history, &model.StatusChange{From: from, To: task.Status, Time: at})
+}
+
+// initHistory starts the history of a new task from its own times, so
+// imported tasks are not taken as changed now. A given history is kept.
+func initHistory(task *model.TaskItem) {
+	if len(task.StatusHistory) > 0 {
+		return
+	}
+	start := task.StartTime
+	if start == 0 {
+		start = model.ToSwiftTimestamp(time.Now())
+	}
+	task.StatusHistory = nil
+	if task.Status == model.TaskStatusDone && task.DoneTime != 0 {
+		status := task.Status
+		task.Status = model.TaskStatusCreated
+		recordStatus(task, "", start)
+		task.Status = status
+		recordStatus(task, model.TaskStatusCreated, task.DoneTime)
+		return
+	}
+	recordStatus(task, "", start)
+}
+
+// fillNoteTimes gives every note a time: the one posted, the time of
+// the same note in old, or now for a new note. Notes of old without
+// a time stay unknown.
+func fillNoteTimes(task *model.TaskItem, old *model.TaskItem) {
+	if len(task.Notes) == 0 {
+		task.NoteTimes = nil
+		return
+	}
+	known := make(map[string][]model.SwiftTimestamp)
+	if old != nil {
+		for i, note := range old.Notes {
+			var ts model.SwiftTimestamp
+			if i < len(old.NoteTimes) {
+				ts = old.NoteTimes[i]
+			}
+			known[note] = append(known[note], ts)
+		}
+	}
+	now := model.ToSwiftTimestamp(time.Now())
+	times := make([]model.SwiftTimestamp, len(task.Notes))
+	for i, note := range task.Notes {
+		if i < len(task.NoteTimes) && task.NoteTimes[i] != 0 {
+			times[i] = task.NoteTimes[i]
+		} else if ts := known[note]; len(ts) > 0 {
+			times[i] = ts[0]
+			known[note] = ts[1:]
+		} else {
+			times[i] = now
+		}
+	}
+	task.NoteTimes = nil
+	for _, ts := range times {
+		if ts != 0 {
+			task.NoteTimes = times
+			break
+		}
+	}
+}
+
+// addNoteTime records now for a note just appended
+func addNoteTime(task *model.TaskItem) {
+	times := make([]model.SwiftTimestamp, len(task.Notes))
+	copy(times, task.NoteTimes)
+	times[len(times)-1] = model.ToSwiftTimestamp(time.Now())
+	task.NoteTimes = times
+}
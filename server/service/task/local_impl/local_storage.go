@@ -1,354 +1,376 @@
 package local_impl
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/xhd2015/task-banner/server/model"
 	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/event"
 )
 
 type LocalStorage struct {
 	filename string
 	mu       sync.RWMutex
+	events   *event.Bus
+	changes  *changeLog
 }
 
 var _ task.ITaskStorage = (*LocalStorage)(nil)
 
+// eventHistorySize is the number of recent events kept for subscribers to resume
+const eventHistorySize = 1024
+
+var errParentNotFound = fmt.Errorf("parent %w", task.ErrTaskNotFound)
+
 func New(filename string) *LocalStorage {
 	return &LocalStorage{
 		filename: filename,
+		events:   event.NewBus(eventHistorySize),
+		changes:  &changeLog{filename: changeLogFile(filename)},
 	}
 }
 
+// storeFile is the content of the JSON file,
+// legacy files hold only the task array
+type storeFile struct {
+	Revision int64 `json:"revision"`
+	// TimeFormat is how the times are written, legacy files
+	// without it hold Swift timestamps
+	TimeFormat model.TimeFormat  `json:"timeFormat,omitempty"`
+	Tasks      []*model.TaskItem `json:"tasks"`
+}
+
 // readTasks reads all tasks from the JSON file
 func (s *LocalStorage) readTasks() ([]*model.TaskItem, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	store, err := s.readStoreLocked()
+	if err != nil {
+		return nil, err
+	}
+	return store.Tasks, nil
+}
 
+func (s *LocalStorage) readStoreLocked() (*storeFile, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(s.filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
+	return readStoreFile(s.filename)
+}
 
-	data, err := os.ReadFile(s.filename)
+func readStoreFile(filename string) (*storeFile, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []*model.TaskItem{}, nil
+			return &storeFile{Tasks: []*model.TaskItem{}}, nil
 		}
 		return nil, err
 	}
 
-	var tasks []*model.TaskItem
-	if err := json.Unmarshal(data, &tasks); err != nil {
-		return nil, err
+	store := &storeFile{}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &store.Tasks); err != nil {
+			return nil, err
+		}
+	} else if len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, store); err != nil {
+			return nil, err
+		}
 	}
-
-	return tasks, nil
+	if store.Tasks == nil {
+		store.Tasks = []*model.TaskItem{}
+	}
+	return store, nil
 }
 
-// writeTasks writes all tasks to the JSON file
-func (s *LocalStorage) writeTasks(tasks []*model.TaskItem) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// writeStoreLocked writes all tasks to the JSON file
+func (s *LocalStorage) writeStoreLocked(store *storeFile) error {
+	return writeStoreFile(s.filename, store)
+}
 
-	data, err := json.MarshalIndent(tasks, "", "  ")
+func writeStoreFile(filename string, store *storeFile) error {
+	data, err := marshalStore(store)
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(s.filename, data, 0644)
-}
-
-// SaveTasks saves all tasks to storage
-func (s *LocalStorage) SaveTasks(tasks []*model.TaskItem) error {
-	return s.writeTasks(tasks)
+	return os.WriteFile(filename, data, 0644)
 }
 
-// LoadTasks loads tasks from storage, filtered by mode if specified
-func (s *LocalStorage) LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error) {
-	allTasks, err := s.readTasks()
+// marshalStore writes the times in the format of the store, Swift
+// timestamps unless it was migrated
+func marshalStore(store *storeFile) ([]byte, error) {
+	data, err := model.MarshalJSONTimes(store, store.TimeFormat, time.UTC)
 	if err != nil {
 		return nil, err
 	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	if mode == "" || mode == "shared" {
-		return allTasks, nil
+// TimeFormat returns the format of the times in the file,
+// swift for files not migrated yet
+func (s *LocalStorage) TimeFormat() (model.TimeFormat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	store, err := s.readStoreLocked()
+	if err != nil {
+		return "", err
+	}
+	if store.TimeFormat == "" {
+		return model.TimeFormatSwift, nil
 	}
+	return store.TimeFormat, nil
+}
 
-	// Filter tasks by mode recursively, including shared tasks
-	var filterByMode func([]*model.TaskItem) []*model.TaskItem
-	filterByMode = func(tasks []*model.TaskItem) []*model.TaskItem {
-		filtered := make([]*model.TaskItem, 0)
-		for _, task := range tasks {
-			if task.Mode == mode || task.Mode == "" || task.Mode == "shared" {
-				taskCopy := *task
-				taskCopy.SubTasks = filterByMode(task.SubTasks)
-				filtered = append(filtered, &taskCopy)
-			}
+// MigrateTimes rewrites a file holding Swift timestamps with RFC 3339
+// times, reporting whether it was rewritten. The revision is kept as
+// the tasks do not change, later writes keep the format.
+func (s *LocalStorage) MigrateTimes() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.filename); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
 		}
-		return filtered
+		return false, err
 	}
-
-	return filterByMode(allTasks), nil
+	store, err := s.readStoreLocked()
+	if err != nil {
+		return false, err
+	}
+	if store.TimeFormat == model.TimeFormatRFC3339 {
+		return false, nil
+	}
+	store.TimeFormat = model.TimeFormatRFC3339
+	if err := s.writeStoreLocked(store); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// findHighestTaskID finds the highest task ID in the tree
-func (s *LocalStorage) findHighestTaskID() (int64, error) {
-	tasks, err := s.readTasks()
+// ReadTasksFile reads a tasks file without opening a storage,
+// a missing file has no tasks
+func ReadTasksFile(filename string) ([]*model.TaskItem, int64, error) {
+	store, err := readStoreFile(filename)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
+	return store.Tasks, store.Revision, nil
+}
 
-	var maxID int64
-	var checkTask func(*model.TaskItem)
-	checkTask = func(task *model.TaskItem) {
-		if task.ID > maxID {
-			maxID = task.ID
-		}
-		for _, subtask := range task.SubTasks {
-			checkTask(subtask)
-		}
+// ReadTasksFileTimeFormat returns the format of the times in a tasks
+// file, empty for Swift timestamps
+func ReadTasksFileTimeFormat(filename string) (model.TimeFormat, error) {
+	store, err := readStoreFile(filename)
+	if err != nil {
+		return "", err
 	}
+	return store.TimeFormat, nil
+}
 
-	for _, task := range tasks {
-		checkTask(task)
-	}
+// WriteTasksFile writes a tasks file in the format read by New,
+// with times in format, empty for Swift timestamps
+func WriteTasksFile(filename string, tasks []*model.TaskItem, revision int64, format model.TimeFormat) error {
+	return writeStoreFile(filename, newStoreFile(tasks, revision, format))
+}
 
-	return maxID, nil
+// MarshalTasksFile returns the content WriteTasksFile writes
+func MarshalTasksFile(tasks []*model.TaskItem, revision int64, format model.TimeFormat) ([]byte, error) {
+	return marshalStore(newStoreFile(tasks, revision, format))
 }
 
-// AddTask adds a new task to storage
-func (s *LocalStorage) AddTask(inputTask *model.TaskItem) (*model.TaskItem, error) {
-	tasks, err := s.readTasks()
-	if err != nil {
-		return nil, err
+func newStoreFile(tasks []*model.TaskItem, revision int64, format model.TimeFormat) *storeFile {
+	if format == model.TimeFormatSwift {
+		format = ""
 	}
+	return &storeFile{Revision: revision, TimeFormat: format, Tasks: tasks}
+}
 
-	task := inputTask.ShallowClone()
+// update reads the tasks, applies fn and writes them back with
+// the store revision bumped, nothing is written if fn fails or
+// changes nothing. Changes are logged and published after written.
+func (s *LocalStorage) update(fn func(tree *taskTree) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Generate new ID
-	highestID, err := s.findHighestTaskID()
+	store, err := s.readStoreLocked()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	task.ID = highestID + 1
-
-	if task.ParentID != 0 {
-		// Add as subtask
-		found := false
-		var addSubTask func([]*model.TaskItem) []*model.TaskItem
-		addSubTask = func(tasks []*model.TaskItem) []*model.TaskItem {
-			for i, t := range tasks {
-				if t.ID == task.ParentID {
-					tasks[i].SubTasks = append([]*model.TaskItem{task}, tasks[i].SubTasks...)
-					found = true
-					return tasks
-				}
-				tasks[i].SubTasks = addSubTask(t.SubTasks)
-			}
-			return tasks
-		}
-		tasks = addSubTask(tasks)
-		if !found {
-			return nil, errors.New("parent task not found")
+	tree := &taskTree{revision: store.Revision, tasks: store.Tasks}
+	if err := fn(tree); err != nil {
+		return err
+	}
+	if len(tree.events) == 0 {
+		return nil
+	}
+	revision := tree.revision + 1
+	err = s.writeStoreLocked(&storeFile{
+		Revision:   revision,
+		TimeFormat: store.TimeFormat,
+		Tasks:      tree.tasks,
+	})
+	if err != nil {
+		return err
+	}
+	for _, ev := range tree.events {
+		ev.Revision = revision
+	}
+	if err := s.changes.append(tree.events); err != nil {
+		return err
+	}
+	s.events.Publish(tree.events...)
+	return nil
+}
+
+// Subscribe subscribes to committed changes after lastEventID,
+// changes before the last restart are replayed from the change log
+func (s *LocalStorage) Subscribe(lastEventID int64) *event.Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub := s.events.Subscribe(lastEventID)
+	if sub.Missed {
+		replay, _, ok, err := s.changes.readAfter(lastEventID)
+		if err == nil && ok {
+			sub.Replay = replay
+			sub.Missed = false
 		}
-	} else {
-		tasks = append([]*model.TaskItem{task}, tasks...)
 	}
+	return sub
+}
 
-	err = s.writeTasks(tasks)
+// Revision returns the revision of the whole store
+func (s *LocalStorage) Revision() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	store, err := s.readStoreLocked()
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	return store.Revision, nil
+}
 
-	return task, nil
+// SaveTasks saves all tasks to storage
+func (s *LocalStorage) SaveTasks(tasks []*model.TaskItem, expectedRevision *int64) error {
+	// counts are computed on listing, don't persist them
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		task.ChildCount = 0
+		task.DescendantCount = 0
+		return true
+	})
+	return s.update(func(tree *taskTree) error {
+		if expectedRevision != nil && *expectedRevision != tree.revision {
+			return &task.ConflictError{
+				ExpectedRevision: *expectedRevision,
+				ActualRevision:   tree.revision,
+				Tasks:            tree.tasks,
+			}
+		}
+		return tree.replace(tasks)
+	})
 }
 
-// RemoveTask removes a task from storage
-func (s *LocalStorage) RemoveTask(taskID int64) error {
-	tasks, err := s.readTasks()
+// LoadTasks loads tasks from storage, filtered by mode if specified
+func (s *LocalStorage) LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error) {
+	allTasks, err := s.readTasks()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	found := false
-	var removeTask func([]*model.TaskItem) []*model.TaskItem
-	removeTask = func(tasks []*model.TaskItem) []*model.TaskItem {
+	if mode == "" || mode == model.TaskModeShared {
+		return allTasks, nil
+	}
+
+	// Filter tasks by mode recursively, including shared tasks
+	var filterByMode func([]*model.TaskItem) []*model.TaskItem
+	filterByMode = func(tasks []*model.TaskItem) []*model.TaskItem {
 		filtered := make([]*model.TaskItem, 0)
 		for _, task := range tasks {
-			if task.ID == taskID {
-				found = true
-				continue
+			if task.Mode == mode || task.Mode == "" || task.Mode == model.TaskModeShared {
+				taskCopy := *task
+				taskCopy.SubTasks = filterByMode(task.SubTasks)
+				filtered = append(filtered, &taskCopy)
 			}
-			task.SubTasks = removeTask(task.SubTasks)
-			filtered = append(filtered, task)
 		}
 		return filtered
 	}
 
-	tasks = removeTask(tasks)
-	if !found {
-		return errors.New("task not found")
-	}
-
-	return s.writeTasks(tasks)
+	return filterByMode(allTasks), nil
 }
 
-// UpdateTask updates an existing task in storage
-func (s *LocalStorage) UpdateTask(taskID int64, update *model.TaskUpdate) error {
-	tasks, err := s.readTasks()
-	if err != nil {
+// AddTask adds a new task to storage, in front of its siblings
+func (s *LocalStorage) AddTask(inputTask *model.TaskItem) (*model.TaskItem, error) {
+	var added *model.TaskItem
+	err := s.update(func(tree *taskTree) error {
+		var err error
+		added, err = tree.add(inputTask, 0)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return added, nil
+}
 
-	found := false
-	var updateTaskRecursive func([]*model.TaskItem) []*model.TaskItem
-	updateTaskRecursive = func(tasks []*model.TaskItem) []*model.TaskItem {
-		for i, task := range tasks {
-			if task.ID == taskID {
-				if update.Title != nil {
-					tasks[i].Title = *update.Title
-				}
-				if update.Status != nil {
-					tasks[i].Status = model.TaskStatus(*update.Status)
-				}
-				if update.Notes != nil {
-					tasks[i].Notes = append(tasks[i].Notes, *update.Notes)
-				}
-				if update.Mode != nil {
-					tasks[i].Mode = model.TaskMode(*update.Mode)
-				}
-				found = true
-				return tasks
-			}
-			tasks[i].SubTasks = updateTaskRecursive(task.SubTasks)
-		}
-		return tasks
-	}
-
-	tasks = updateTaskRecursive(tasks)
-	if !found {
-		return errors.New("task not found")
-	}
+// RemoveTask removes a task from storage
+func (s *LocalStorage) RemoveTask(taskID int64) error {
+	return s.update(func(tree *taskTree) error {
+		return tree.remove(taskID)
+	})
+}
 
-	return s.writeTasks(tasks)
+// UpdateTask updates an existing task in storage
+func (s *LocalStorage) UpdateTask(taskID int64, update *model.TaskUpdate) error {
+	return s.update(func(tree *taskTree) error {
+		return tree.update(taskID, update)
+	})
 }
 
 // ExchangeOrder swaps the order of two tasks at the same level
-func (s *LocalStorage) ExchangeOrder(taskID int64, exchangeTaskID int64) error {
-	if taskID == 0 {
-		return errors.New("requires taskID")
-	}
-	if exchangeTaskID == 0 {
-		return errors.New("requires exchangeTaskID")
-	}
-	if taskID == exchangeTaskID {
+func (s *LocalStorage) ExchangeOrder(taskID int64, exchangeTaskID int64, expectedRevision *int64) error {
+	if taskID != 0 && taskID == exchangeTaskID && expectedRevision == nil {
 		return nil
 	}
-
-	tasks, err := s.readTasks()
-	if err != nil {
-		return err
-	}
-
-	found := false
-	var exchangeTasksRecursive func([]*model.TaskItem) []*model.TaskItem
-	exchangeTasksRecursive = func(tasks []*model.TaskItem) []*model.TaskItem {
-		// Find both tasks at current level
-		var aIndex, bIndex = -1, -1
-		for i, task := range tasks {
-			if task.ID == taskID {
-				aIndex = i
-			}
-			if task.ID == exchangeTaskID {
-				bIndex = i
-			}
-		}
-
-		// If both found at this level, swap them
-		if aIndex != -1 && bIndex != -1 {
-			tasks[aIndex], tasks[bIndex] = tasks[bIndex], tasks[aIndex]
-			found = true
-			return tasks
+	return s.update(func(tree *taskTree) error {
+		if err := tree.checkRevision(taskID, expectedRevision); err != nil {
+			return err
 		}
-
-		// Otherwise, search in subtasks
-		for i := range tasks {
-			tasks[i].SubTasks = exchangeTasksRecursive(tasks[i].SubTasks)
+		if taskID == exchangeTaskID {
+			return nil
 		}
-		return tasks
-	}
-
-	tasks = exchangeTasksRecursive(tasks)
-	if !found {
-		return errors.New("tasks not found or not at same level")
-	}
+		return tree.exchange(taskID, exchangeTaskID)
+	})
+}
 
-	return s.writeTasks(tasks)
+// MoveTask moves a task under another parent at index, negative index appends
+func (s *LocalStorage) MoveTask(taskID int64, parentID int64, index int) error {
+	return s.update(func(tree *taskTree) error {
+		return tree.move(taskID, parentID, index)
+	})
 }
 
 // AddTaskNote adds a note to a task
 func (s *LocalStorage) AddTaskNote(taskID int64, note string) error {
-	tasks, err := s.readTasks()
-	if err != nil {
-		return err
-	}
-
-	found := false
-	var addNoteRecursive func([]*model.TaskItem) []*model.TaskItem
-	addNoteRecursive = func(tasks []*model.TaskItem) []*model.TaskItem {
-		for i, task := range tasks {
-			if task.ID == taskID {
-				tasks[i].Notes = append(tasks[i].Notes, note)
-				found = true
-				return tasks
-			}
-			tasks[i].SubTasks = addNoteRecursive(task.SubTasks)
-		}
-		return tasks
-	}
-
-	tasks = addNoteRecursive(tasks)
-	if !found {
-		return errors.New("task not found")
-	}
-
-	return s.writeTasks(tasks)
+	return s.update(func(tree *taskTree) error {
+		return tree.addNote(taskID, note)
+	})
 }
 
 // UpdateTaskNote updates a specific note in a task
 func (s *LocalStorage) UpdateTaskNote(taskID int64, noteIndex int, newText string) error {
-	tasks, err := s.readTasks()
-	if err != nil {
-		return err
-	}
-
-	found := false
-	var updateNoteRecursive func([]*model.TaskItem) []*model.TaskItem
-	updateNoteRecursive = func(tasks []*model.TaskItem) []*model.TaskItem {
-		for i, task := range tasks {
-			if task.ID == taskID {
-				if noteIndex >= len(tasks[i].Notes) {
-					return tasks
-				}
-				tasks[i].Notes[noteIndex] = newText
-				found = true
-				return tasks
-			}
-			tasks[i].SubTasks = updateNoteRecursive(task.SubTasks)
-		}
-		return tasks
-	}
-
-	tasks = updateNoteRecursive(tasks)
-	if !found {
-		return errors.New("task not found")
-	}
-
-	return s.writeTasks(tasks)
+	return s.update(func(tree *taskTree) error {
+		return tree.updateNote(taskID, noteIndex, newText)
+	})
 }
@@ -0,0 +1,69 @@
+package local_impl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func readFile(t *testing.T, filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+func TestTimeFormatKept(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tasks.json")
+	legacy := `[{"id":1,"title":"Legacy","startTime":700000000,"status":"created","subTasks":[],"notes":[]}]`
+	if err := os.WriteFile(file, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(file)
+	if _, err := s.AddTask(&model.TaskItem{Title: "New", StartTime: 700000100}); err != nil {
+		t.Fatal(err)
+	}
+	if content := readFile(t, file); strings.Contains(content, "timeFormat") || !strings.Contains(content, `"startTime": 700000100`) {
+		t.Fatalf("expect Swift timestamps kept, actual: %s", content)
+	}
+	format, err := s.TimeFormat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != model.TimeFormatSwift {
+		t.Fatalf("expect %s, actual: %s", model.TimeFormatSwift, format)
+	}
+
+	migrated, err := s.MigrateTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrated {
+		t.Fatal("expect migrated")
+	}
+	if err := s.AddTaskNote(1, "after migrating"); err != nil {
+		t.Fatal(err)
+	}
+	content := readFile(t, file)
+	if !strings.Contains(content, `"timeFormat": "rfc3339"`) || !strings.Contains(content, `"startTime": "2023-03-08T20:26:40Z"`) {
+		t.Fatalf("expect RFC 3339 times kept, actual: %s", content)
+	}
+	tasks, err := s.LoadTasks("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// new tasks come first
+	if len(tasks) != 2 || tasks[0].StartTime != 700000100 || tasks[1].StartTime != 700000000 {
+		t.Fatalf("expect times read back unchanged, actual: %s", toJSON(tasks))
+	}
+}
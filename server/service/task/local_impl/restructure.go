@@ -0,0 +1,308 @@
+package local_impl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+	"github.com/xhd2015/task-banner/server/service/task/links"
+)
+
+// CloneTask copies the subtree of a task with new IDs
+func (s *LocalStorage) CloneTask(taskID int64, opts *model.CloneOptions) (*model.TaskItem, error) {
+	var copied *model.TaskItem
+	err := s.update(func(tree *taskTree) error {
+		var err error
+		copied, err = tree.clone(taskID, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// MergeTasks folds the subtasks and notes of sourceID into targetID
+func (s *LocalStorage) MergeTasks(sourceID int64, targetID int64) (*model.TaskItem, error) {
+	var merged *model.TaskItem
+	err := s.update(func(tree *taskTree) error {
+		var err error
+		merged, err = tree.merge(sourceID, targetID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// SplitTask turns notes and subtasks of a task into its siblings
+func (s *LocalStorage) SplitTask(taskID int64, opts *model.SplitOptions) ([]*model.TaskItem, error) {
+	var created []*model.TaskItem
+	err := s.update(func(tree *taskTree) error {
+		var err error
+		created, err = tree.split(taskID, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (t *taskTree) clone(taskID int64, opts *model.CloneOptions) (*model.TaskItem, error) {
+	if opts == nil {
+		opts = &model.CloneOptions{}
+	}
+	list, idx := t.locate(taskID)
+	if list == nil {
+		return nil, task.ErrTaskNotFound
+	}
+	original := (*list)[idx]
+	parentID := original.ParentID
+	index := idx + 1
+	if opts.ParentID != nil && *opts.ParentID != original.ParentID {
+		parentID = *opts.ParentID
+		index = -1
+	}
+	if opts.Index != nil {
+		index = *opts.Index
+	}
+	siblings, err := t.children(parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// copied before inserting, so a copy into the own subtree is not copied again
+	copied := original.DeepClone()
+	if opts.Title != "" {
+		copied.Title = opts.Title
+	}
+	now := model.ToSwiftTimestamp(time.Now())
+	nextID := t.maxID()
+	var renew func(cl *model.TaskItem, parentID int64)
+	renew = func(cl *model.TaskItem, parentID int64) {
+		nextID++
+		cl.ID = nextID
+		cl.ParentID = parentID
+		cl.Revision = 1
+		cl.ExternalID = ""
+		cl.ChildCount = 0
+		cl.DescendantCount = 0
+		if opts.ResetStatus {
+			if cl.Status == model.TaskStatusDone || cl.Status == model.TaskStatusArchived {
+				cl.Status = model.TaskStatusCreated
+			}
+			cl.StartTime = now
+			cl.DoneTime = 0
+			cl.StatusHistory = nil
+		}
+		initHistory(cl)
+		if cl.SubTasks == nil {
+			cl.SubTasks = []*model.TaskItem{}
+		}
+		for _, sub := range cl.SubTasks {
+			renew(sub, cl.ID)
+		}
+	}
+	renew(copied, parentID)
+
+	index = insertAt(siblings, index, copied)
+	t.emit(model.TaskEventAdded, copied).Index = &index
+	var emitAdded func(tasks []*model.TaskItem)
+	emitAdded = func(tasks []*model.TaskItem) {
+		for i, sub := range tasks {
+			subIndex := i
+			t.emit(model.TaskEventAdded, sub).Index = &subIndex
+			emitAdded(sub.SubTasks)
+		}
+	}
+	emitAdded(copied.SubTasks)
+	return copied, nil
+}
+
+func (t *taskTree) merge(sourceID int64, targetID int64) (*model.TaskItem, error) {
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: cannot merge task %d into itself", task.ErrInvalidOperation, sourceID)
+	}
+	list, idx := t.locate(sourceID)
+	if list == nil {
+		return nil, task.ErrTaskNotFound
+	}
+	source := (*list)[idx]
+	if model.FindTask(source.SubTasks, targetID) != nil {
+		return nil, fmt.Errorf("%w: cannot merge task %d into its own subtask %d", task.ErrInvalidOperation, sourceID, targetID)
+	}
+	target, err := t.find(targetID)
+	if err != nil {
+		return nil, err
+	}
+	*list = append((*list)[:idx], (*list)[idx+1:]...)
+
+	if len(source.Notes) > 0 {
+		times := append(noteTimes(target), noteTimes(source)...)
+		target.Notes = append(append([]string{}, target.Notes...), source.Notes...)
+		target.NoteTimes = nil
+		for _, ts := range times {
+			if ts != 0 {
+				target.NoteTimes = times
+				break
+			}
+		}
+	}
+	for _, sub := range source.SubTasks {
+		if sub == nil {
+			continue
+		}
+		sub.ParentID = targetID
+		index := insertAt(&target.SubTasks, -1, sub)
+		touch(sub)
+		t.emit(model.TaskEventMoved, sub).Index = &index
+	}
+	// links, such as the commits linked by gitlink, and the external
+	// id keep pointing at the merged task
+	var sourceLinks []*model.TaskLink
+	for _, link := range source.Links {
+		if link != nil {
+			sourceLinks = append(sourceLinks, link)
+		}
+	}
+	if merged, added := links.Merge(target.Links, sourceLinks); len(added) > 0 {
+		target.Links = merged
+	}
+	if target.ExternalID == "" {
+		target.ExternalID = source.ExternalID
+	}
+	touch(target)
+	t.emit(model.TaskEventUpdated, target)
+	t.emit(model.TaskEventRemoved, source)
+	return target, nil
+}
+
+func (t *taskTree) split(taskID int64, opts *model.SplitOptions) ([]*model.TaskItem, error) {
+	if opts == nil || len(opts.NoteIndexes)+len(opts.SubTaskIDs) == 0 {
+		return nil, fmt.Errorf("%w: requires notes or subtasks to split", task.ErrInvalidOperation)
+	}
+	list, idx := t.locate(taskID)
+	if list == nil {
+		return nil, task.ErrTaskNotFound
+	}
+	original := (*list)[idx]
+
+	splitNotes := make(map[int]bool, len(opts.NoteIndexes))
+	for _, i := range opts.NoteIndexes {
+		if i < 0 || i >= len(original.Notes) {
+			return nil, fmt.Errorf("%w: note index out of range: %d", task.ErrInvalidOperation, i)
+		}
+		if splitNotes[i] {
+			return nil, fmt.Errorf("%w: duplicate note index: %d", task.ErrInvalidOperation, i)
+		}
+		if strings.TrimSpace(original.Notes[i]) == "" {
+			return nil, fmt.Errorf("%w: note %d is empty", task.ErrInvalidOperation, i)
+		}
+		splitNotes[i] = true
+	}
+	subIndexes := make(map[int64]int, len(original.SubTasks))
+	for i, sub := range original.SubTasks {
+		if sub != nil {
+			subIndexes[sub.ID] = i
+		}
+	}
+	splitSubs := make(map[int64]bool, len(opts.SubTaskIDs))
+	for _, id := range opts.SubTaskIDs {
+		if _, ok := subIndexes[id]; !ok {
+			return nil, fmt.Errorf("%w: task %d is not a subtask of %d", task.ErrInvalidOperation, id, taskID)
+		}
+		if splitSubs[id] {
+			return nil, fmt.Errorf("%w: duplicate subtask: %d", task.ErrInvalidOperation, id)
+		}
+		splitSubs[id] = true
+	}
+
+	now := model.ToSwiftTimestamp(time.Now())
+	times := noteTimes(original)
+	index := idx + 1
+	var created []*model.TaskItem
+	for _, i := range opts.NoteIndexes {
+		title, rest, _ := strings.Cut(strings.TrimSpace(original.Notes[i]), "\n")
+		start := times[i]
+		if start == 0 {
+			start = now
+		}
+		newTask := &model.TaskItem{
+			Title:     strings.TrimSpace(title),
+			StartTime: start,
+			ParentID:  original.ParentID,
+			Mode:      original.Mode,
+			Status:    model.TaskStatusCreated,
+		}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			newTask.Notes = []string{rest}
+			newTask.NoteTimes = []model.SwiftTimestamp{start}
+		}
+		added, err := t.add(newTask, index)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, added)
+		index++
+	}
+	if len(splitNotes) > 0 {
+		var notes []string
+		var keptTimes []model.SwiftTimestamp
+		for i, note := range original.Notes {
+			if !splitNotes[i] {
+				notes = append(notes, note)
+				keptTimes = append(keptTimes, times[i])
+			}
+		}
+		if notes == nil {
+			notes = []string{}
+		}
+		original.Notes = notes
+		original.NoteTimes = nil
+		for _, ts := range keptTimes {
+			if ts != 0 {
+				original.NoteTimes = keptTimes
+				break
+			}
+		}
+	}
+
+	var kept []*model.TaskItem
+	for _, sub := range original.SubTasks {
+		if sub == nil || !splitSubs[sub.ID] {
+			kept = append(kept, sub)
+		}
+	}
+	moving := make([]*model.TaskItem, 0, len(opts.SubTaskIDs))
+	for _, id := range opts.SubTaskIDs {
+		moving = append(moving, original.SubTasks[subIndexes[id]])
+	}
+	if len(moving) > 0 {
+		if kept == nil {
+			kept = []*model.TaskItem{}
+		}
+		original.SubTasks = kept
+	}
+	for _, sub := range moving {
+		sub.ParentID = original.ParentID
+		subIndex := insertAt(list, index, sub)
+		index++
+		touch(sub)
+		t.emit(model.TaskEventMoved, sub).Index = &subIndex
+		created = append(created, sub)
+	}
+	touch(original)
+	t.emit(model.TaskEventUpdated, original)
+	return created, nil
+}
+
+// noteTimes returns a copy of the note times with one per note, 0 if unknown
+func noteTimes(task *model.TaskItem) []model.SwiftTimestamp {
+	times := make([]model.SwiftTimestamp, len(task.Notes))
+	copy(times, task.NoteTimes)
+	return times
+}
@@ -0,0 +1,56 @@
+package local_impl
+
+import (
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestMerge(t *testing.T) {
+	tree := &taskTree{tasks: []*model.TaskItem{
+		{
+			ID:    1,
+			Title: "Target",
+			Links: []*model.TaskLink{{URL: "https://github.com/o/r/pull/1", Kind: model.LinkKindPR}},
+		},
+		{
+			ID:         2,
+			Title:      "Source",
+			ExternalID: "github:o/r#7",
+			Notes:      []string{"from source"},
+			Links: []*model.TaskLink{
+				{URL: "https://github.com/o/r/pull/1/", Kind: model.LinkKindPR},
+				{URL: "https://github.com/o/r/commit/abc", Kind: model.LinkKindCommit},
+			},
+			SubTasks: []*model.TaskItem{{ID: 3, ParentID: 2, Title: "Sub"}},
+		},
+	}}
+	merged, err := tree.merge(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.tasks) != 1 || merged != tree.tasks[0] {
+		t.Fatalf("expect only the target left, actual: %s", toJSON(tree.tasks))
+	}
+	if len(merged.Links) != 2 || merged.Links[1].URL != "https://github.com/o/r/commit/abc" {
+		t.Fatalf("expect the commit link added once, actual: %s", toJSON(merged.Links))
+	}
+	if merged.ExternalID != "github:o/r#7" {
+		t.Fatalf("expect the external id of the source, actual: %q", merged.ExternalID)
+	}
+	if len(merged.SubTasks) != 1 || merged.SubTasks[0].ParentID != 1 || len(merged.Notes) != 1 {
+		t.Fatalf("expect subtasks and notes moved, actual: %s", toJSON(merged))
+	}
+
+	var types []model.TaskEventType
+	for _, ev := range tree.events {
+		types = append(types, ev.Type)
+	}
+	expect := []model.TaskEventType{model.TaskEventMoved, model.TaskEventUpdated, model.TaskEventRemoved}
+	if toJSON(types) != toJSON(expect) {
+		t.Fatalf("expect events %v, actual: %v", expect, types)
+	}
+	if moved := tree.events[0]; moved.TaskID != 3 || moved.ParentID != 1 || moved.Index == nil || *moved.Index != 0 {
+		t.Fatalf("unexpected move event: %s", toJSON(moved))
+	}
+}
@@ -0,0 +1,84 @@
+package local_impl
+
+import (
+	"errors"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+// Sync applies operations queued by an offline client and returns the
+// changes it missed since cursor.
+//
+// Unlike Batch, operations are applied independently: one that conflicts
+// or fails is skipped and reported, the rest still apply. Conflicts are
+// resolved in favor of the server, except that appending a note never
+// conflicts.
+func (s *LocalStorage) Sync(cursor int64, ops []*model.BatchOperation) (*model.SyncResult, error) {
+	results := make([]*model.SyncOpResult, 0, len(ops))
+	if len(ops) > 0 {
+		err := s.update(func(tree *taskTree) error {
+			refs := make(refTable)
+			for _, op := range ops {
+				results = append(results, tree.syncOne(op, refs))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := &model.SyncResult{Results: results}
+	changes, lastID, ok, err := s.changes.readAfter(cursor)
+	if err != nil {
+		return nil, err
+	}
+	result.Cursor = lastID
+	if !ok || cursor == 0 {
+		store, err := s.readStoreLocked()
+		if err != nil {
+			return nil, err
+		}
+		result.Reset = true
+		result.Tasks = store.Tasks
+		changes = nil
+	}
+	if changes == nil {
+		changes = []*model.TaskEvent{}
+	}
+	result.Changes = changes
+	return result, nil
+}
+
+func (t *taskTree) syncOne(op *model.BatchOperation, refs refTable) *model.SyncOpResult {
+	if op != nil && op.Op == model.BatchOpNote && op.NoteIndex == nil && op.ExpectedRevision != nil {
+		// appending notes commutes with other changes
+		cl := *op
+		cl.ExpectedRevision = nil
+		op = &cl
+	}
+	res := &model.SyncOpResult{}
+	if op != nil {
+		res.Op = op.Op
+		res.TaskID = op.TaskID
+		res.Ref = op.Ref
+	}
+	applied, err := t.apply(op, refs)
+	if err != nil {
+		res.Error = err.Error()
+		var conflict *task.ConflictError
+		if errors.As(err, &conflict) {
+			res.Status = model.SyncOpConflict
+			res.Current = conflict.Task
+		} else {
+			res.Status = model.SyncOpRejected
+		}
+		return res
+	}
+	res.BatchResult = *applied
+	res.Status = model.SyncOpApplied
+	return res
+}
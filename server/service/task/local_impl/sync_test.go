@@ -0,0 +1,132 @@
+package local_impl
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestSyncChanges(t *testing.T) {
+	s := newBatchStorage(t)
+	if err := s.AddTaskNote(1, "first"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.Sync(0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cursor 0 is a client that has nothing yet
+	if !first.Reset || len(first.Tasks) != 1 || len(first.Changes) != 0 || first.Cursor != 2 {
+		t.Fatalf("expect a reset at cursor 2, actual: %s", toJSON(first))
+	}
+
+	if err := s.UpdateTask(1, &model.TaskUpdate{Title: ptr("Release v2")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddTask(&model.TaskItem{Title: "Plan"}); err != nil {
+		t.Fatal(err)
+	}
+	next, err := s.Sync(first.Cursor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Reset || next.Tasks != nil || next.Cursor != 4 || len(next.Changes) != 2 {
+		t.Fatalf("expect 2 changes after cursor 2, actual: %s", toJSON(next))
+	}
+	if next.Changes[0].ID != 3 || next.Changes[0].Type != model.TaskEventUpdated || next.Changes[1].Type != model.TaskEventAdded {
+		t.Fatalf("unexpected changes: %s", toJSON(next.Changes))
+	}
+
+	upToDate, err := s.Sync(next.Cursor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upToDate.Reset || upToDate.Changes == nil || len(upToDate.Changes) != 0 {
+		t.Fatalf("expect no changes, actual: %s", toJSON(upToDate))
+	}
+}
+
+func TestSyncStaleCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  int64
+		compact bool
+	}{
+		{name: "ahead of the log", cursor: 10},
+		{name: "compacted away", cursor: 1, compact: true},
+		{name: "right before the compacted log", cursor: 2, compact: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBatchStorage(t)
+			for _, note := range []string{"one", "two", "three"} {
+				if err := s.AddTaskNote(1, note); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.compact {
+				// keep only the changes after 2
+				lines := strings.SplitAfter(readFile(t, s.changes.filename), "\n")
+				if err := os.WriteFile(s.changes.filename, []byte(strings.Join(lines[2:], "")), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := s.Sync(tt.cursor, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectReset := tt.cursor != 2
+			if result.Reset != expectReset || result.Cursor != 4 {
+				t.Fatalf("expect reset %v at cursor 4, actual: %s", expectReset, toJSON(result))
+			}
+			if expectReset && (len(result.Tasks) != 1 || len(result.Tasks[0].Notes) != 3 || len(result.Changes) != 0) {
+				t.Fatalf("expect all tasks, actual: %s", toJSON(result))
+			}
+			if !expectReset && len(result.Changes) != 2 {
+				t.Fatalf("expect 2 changes, actual: %s", toJSON(result))
+			}
+		})
+	}
+}
+
+func TestSyncOps(t *testing.T) {
+	s := newBatchStorage(t)
+	if err := s.UpdateTask(1, &model.TaskUpdate{Title: ptr("Release v2")}); err != nil {
+		t.Fatal(err)
+	}
+	// queued offline while the task was at revision 1
+	result, err := s.Sync(2, []*model.BatchOperation{
+		{Op: model.BatchOpNote, TaskID: 1, Note: "offline", ExpectedRevision: ptr(int64(1))},
+		{Op: model.BatchOpUpdate, TaskID: 1, ExpectedRevision: ptr(int64(1)), Update: &model.TaskUpdate{Title: ptr("Offline")}},
+		{Op: model.BatchOpRemove, TaskID: 9},
+		{Op: model.BatchOpNote, TaskID: 1, NoteIndex: ptr(0), Note: "edited", ExpectedRevision: ptr(int64(1))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make([]model.SyncOpStatus, 0, len(result.Results))
+	for _, res := range result.Results {
+		statuses = append(statuses, res.Status)
+	}
+	expect := []model.SyncOpStatus{model.SyncOpApplied, model.SyncOpConflict, model.SyncOpRejected, model.SyncOpConflict}
+	if toJSON(statuses) != toJSON(expect) {
+		t.Fatalf("expect %v, actual: %s", expect, toJSON(result.Results))
+	}
+	if current := result.Results[1].Current; current == nil || current.Title != "Release v2" {
+		t.Fatalf("expect the server state, actual: %s", toJSON(result.Results[1]))
+	}
+	// the client sees its own note with the changes it missed
+	if result.Reset || len(result.Changes) != 1 || result.Changes[0].Type != model.TaskEventNote {
+		t.Fatalf("expect the note change, actual: %s", toJSON(result.Changes))
+	}
+
+	tasks, err := s.readTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].Title != "Release v2" || len(tasks[0].Notes) != 1 || tasks[0].Notes[0] != "offline" {
+		t.Fatalf("expect only the note applied, actual: %s", toJSON(tasks))
+	}
+}
@@ -0,0 +1,389 @@
+package local_impl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+// taskTree holds all tasks while a modification is in progress,
+// every mutation of the storage goes through it
+type taskTree struct {
+	// revision of the whole store before the modification
+	revision int64
+	tasks    []*model.TaskItem
+	// events are published once the modification is written
+	events []*model.TaskEvent
+}
+
+// emit records an event of the task, a snapshot without subtasks is attached
+// unless the task is removed
+func (t *taskTree) emit(eventType model.TaskEventType, changed *model.TaskItem) *model.TaskEvent {
+	ev := &model.TaskEvent{
+		Type:     eventType,
+		TaskID:   changed.ID,
+		ParentID: changed.ParentID,
+		Mode:     changed.Mode,
+	}
+	if eventType != model.TaskEventRemoved {
+		snapshot := changed.ShallowClone()
+		snapshot.SubTasks = []*model.TaskItem{}
+		ev.Task = snapshot
+	}
+	t.events = append(t.events, ev)
+	return ev
+}
+
+// touch bumps the revision of a modified task
+func touch(task *model.TaskItem) {
+	task.Revision++
+}
+
+// checkRevision fails with a conflict if the task is not at the expected revision,
+// nil expectedRevision skips the check
+func (t *taskTree) checkRevision(taskID int64, expectedRevision *int64) error {
+	if expectedRevision == nil {
+		return nil
+	}
+	found, err := t.find(taskID)
+	if err != nil {
+		return err
+	}
+	if found.Revision != *expectedRevision {
+		return &task.ConflictError{
+			TaskID:           taskID,
+			ExpectedRevision: *expectedRevision,
+			ActualRevision:   found.Revision,
+			Task:             found.DeepClone(),
+		}
+	}
+	return nil
+}
+
+func (t *taskTree) maxID() int64 {
+	var maxID int64
+	model.WalkTasks(t.tasks, func(task *model.TaskItem, depth int) bool {
+		if task.ID > maxID {
+			maxID = task.ID
+		}
+		return true
+	})
+	return maxID
+}
+
+func (t *taskTree) find(taskID int64) (*model.TaskItem, error) {
+	found := model.FindTask(t.tasks, taskID)
+	if found == nil {
+		return nil, task.ErrTaskNotFound
+	}
+	return found, nil
+}
+
+// children returns the list holding the subtasks of parentID, 0 means top level
+func (t *taskTree) children(parentID int64) (*[]*model.TaskItem, error) {
+	if parentID == 0 {
+		return &t.tasks, nil
+	}
+	parent := model.FindTask(t.tasks, parentID)
+	if parent == nil {
+		return nil, errParentNotFound
+	}
+	return &parent.SubTasks, nil
+}
+
+// locate returns the list containing the task and its index in that list
+func (t *taskTree) locate(taskID int64) (*[]*model.TaskItem, int) {
+	var locateIn func(list *[]*model.TaskItem) (*[]*model.TaskItem, int)
+	locateIn = func(list *[]*model.TaskItem) (*[]*model.TaskItem, int) {
+		for i, task := range *list {
+			if task == nil {
+				continue
+			}
+			if task.ID == taskID {
+				return list, i
+			}
+			if found, idx := locateIn(&task.SubTasks); found != nil {
+				return found, idx
+			}
+		}
+		return nil, -1
+	}
+	return locateIn(&t.tasks)
+}
+
+// insertAt inserts the task at index, negative or out of range index appends.
+// It returns the actual index.
+func insertAt(list *[]*model.TaskItem, index int, task *model.TaskItem) int {
+	if index < 0 || index > len(*list) {
+		index = len(*list)
+	}
+	*list = append(*list, nil)
+	copy((*list)[index+1:], (*list)[index:])
+	(*list)[index] = task
+	return index
+}
+
+// add adds a copy of inputTask with a new ID under inputTask.ParentID
+func (t *taskTree) add(inputTask *model.TaskItem, index int) (*model.TaskItem, error) {
+	newTask := inputTask.ShallowClone()
+	newTask.ID = t.maxID() + 1
+	newTask.Revision = 1
+	setStatus(newTask, newTask.Status, nil)
+	initHistory(newTask)
+	fillNoteTimes(newTask, nil)
+	if newTask.SubTasks == nil {
+		newTask.SubTasks = []*model.TaskItem{}
+	}
+	list, err := t.children(newTask.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	index = insertAt(list, index, newTask)
+	t.emit(model.TaskEventAdded, newTask).Index = &index
+	return newTask, nil
+}
+
+func (t *taskTree) remove(taskID int64) error {
+	list, idx := t.locate(taskID)
+	if list == nil {
+		return task.ErrTaskNotFound
+	}
+	t.emit(model.TaskEventRemoved, (*list)[idx])
+	*list = append((*list)[:idx], (*list)[idx+1:]...)
+	return nil
+}
+
+func (t *taskTree) update(taskID int64, update *model.TaskUpdate) error {
+	found, err := t.find(taskID)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		return nil
+	}
+	previousStatus := found.Status
+	if update.Title != nil {
+		found.Title = *update.Title
+	}
+	if update.Status != nil {
+		setStatus(found, model.TaskStatus(*update.Status), nil)
+	}
+	if update.Notes != nil {
+		found.Notes = append(found.Notes, *update.Notes)
+		addNoteTime(found)
+	}
+	if update.Mode != nil {
+		found.Mode = model.TaskMode(*update.Mode)
+	}
+	if update.DueTime != nil {
+		found.DueTime = *update.DueTime
+	}
+	if update.Priority != nil {
+		found.Priority = *update.Priority
+	}
+	if update.Links != nil {
+		found.Links = *update.Links
+		if len(found.Links) == 0 {
+			found.Links = nil
+		}
+	}
+	touch(found)
+	ev := t.emit(model.TaskEventUpdated, found)
+	if found.Status != previousStatus {
+		ev.PreviousStatus = &previousStatus
+	}
+	return nil
+}
+
+// exchange swaps the order of two tasks at the same level
+func (t *taskTree) exchange(taskID int64, exchangeTaskID int64) error {
+	if taskID == 0 {
+		return errors.New("requires taskID")
+	}
+	if exchangeTaskID == 0 {
+		return errors.New("requires exchangeTaskID")
+	}
+	if taskID == exchangeTaskID {
+		return nil
+	}
+	aList, aIndex := t.locate(taskID)
+	bList, bIndex := t.locate(exchangeTaskID)
+	if aList == nil || bList == nil || aList != bList {
+		return errors.New("tasks not found or not at same level")
+	}
+	(*aList)[aIndex], (*aList)[bIndex] = (*aList)[bIndex], (*aList)[aIndex]
+	touch((*aList)[aIndex])
+	touch((*aList)[bIndex])
+	t.emit(model.TaskEventReordered, (*aList)[aIndex]).Index = &aIndex
+	t.emit(model.TaskEventReordered, (*aList)[bIndex]).Index = &bIndex
+	return nil
+}
+
+// move moves the task under parentID at index, negative index appends
+func (t *taskTree) move(taskID int64, parentID int64, index int) error {
+	list, idx := t.locate(taskID)
+	if list == nil {
+		return task.ErrTaskNotFound
+	}
+	moving := (*list)[idx]
+	if parentID == taskID || model.FindTask(moving.SubTasks, parentID) != nil {
+		return fmt.Errorf("cannot move task %d into its own subtree", taskID)
+	}
+	newList, err := t.children(parentID)
+	if err != nil {
+		return err
+	}
+	*list = append((*list)[:idx], (*list)[idx+1:]...)
+	eventType := model.TaskEventReordered
+	if moving.ParentID != parentID {
+		eventType = model.TaskEventMoved
+	}
+	moving.ParentID = parentID
+	index = insertAt(newList, index, moving)
+	touch(moving)
+	t.emit(eventType, moving).Index = &index
+	return nil
+}
+
+func (t *taskTree) addNote(taskID int64, note string) error {
+	found, err := t.find(taskID)
+	if err != nil {
+		return err
+	}
+	found.Notes = append(found.Notes, note)
+	addNoteTime(found)
+	touch(found)
+	noteIndex := len(found.Notes) - 1
+	t.emit(model.TaskEventNote, found).NoteIndex = &noteIndex
+	return nil
+}
+
+func (t *taskTree) updateNote(taskID int64, noteIndex int, newText string) error {
+	found, err := t.find(taskID)
+	if err != nil {
+		return err
+	}
+	if noteIndex < 0 || noteIndex >= len(found.Notes) {
+		return fmt.Errorf("note index out of range: %d", noteIndex)
+	}
+	found.Notes[noteIndex] = newText
+	touch(found)
+	t.emit(model.TaskEventNote, found).NoteIndex = &noteIndex
+	return nil
+}
+
+// replace replaces all tasks, carrying over revisions of the existing tasks.
+// A posted task with a revision other than the stored one was loaded before
+// a concurrent modification, it fails with a conflict. Revision 0 means the
+// client does not track revisions, such clients predate the fields kept by
+// carryOver, which are taken from the stored task if omitted.
+func (t *taskTree) replace(tasks []*model.TaskItem) error {
+	existing := make(map[int64]*model.TaskItem)
+	model.WalkTasks(t.tasks, func(task *model.TaskItem, depth int) bool {
+		existing[task.ID] = task
+		return true
+	})
+	var conflict error
+	model.WalkTasks(tasks, func(newTask *model.TaskItem, depth int) bool {
+		if conflict != nil {
+			return false
+		}
+		old, ok := existing[newTask.ID]
+		if !ok {
+			newTask.Revision = 1
+			setStatus(newTask, newTask.Status, nil)
+			initHistory(newTask)
+			fillNoteTimes(newTask, nil)
+			return true
+		}
+		if newTask.Revision != 0 && newTask.Revision != old.Revision {
+			conflict = &task.ConflictError{
+				TaskID:           newTask.ID,
+				ExpectedRevision: newTask.Revision,
+				ActualRevision:   old.Revision,
+				Task:             old.DeepClone(),
+			}
+			return false
+		}
+		if newTask.Revision == 0 {
+			carryOver(newTask, old)
+		}
+		newTask.Revision = old.Revision
+		setStatus(newTask, newTask.Status, old)
+		fillNoteTimes(newTask, old)
+		if !sameContent(old, newTask) {
+			touch(newTask)
+		}
+		return true
+	})
+	if conflict != nil {
+		return conflict
+	}
+	t.tasks = tasks
+	t.events = append(t.events, &model.TaskEvent{Type: model.TaskEventReplaced})
+	return nil
+}
+
+// carryOver fills the fields of task left empty from old, an
+// empty but non-nil Links clears the links
+func carryOver(task *model.TaskItem, old *model.TaskItem) {
+	if task.DueTime == 0 {
+		task.DueTime = old.DueTime
+	}
+	if task.Priority == "" {
+		task.Priority = old.Priority
+	}
+	if task.ExternalID == "" {
+		task.ExternalID = old.ExternalID
+	}
+	if task.Links == nil {
+		task.Links = model.CloneLinks(old.Links)
+	}
+}
+
+// sameContent compares the fields of two tasks, excluding subtasks
+func sameContent(a *model.TaskItem, b *model.TaskItem) bool {
+	if a.Title != b.Title || a.StartTime != b.StartTime || a.DueTime != b.DueTime ||
+		a.DoneTime != b.DoneTime || a.Priority != b.Priority || a.ExternalID != b.ExternalID || a.ParentID != b.ParentID ||
+		a.Mode != b.Mode || a.Status != b.Status || len(a.Notes) != len(b.Notes) || !model.SameLinks(a.Links, b.Links) {
+		return false
+	}
+	for i := range a.Notes {
+		if a.Notes[i] != b.Notes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setStatus sets the status and keeps DoneTime and StatusHistory in line
+// with it, a task already done in old keeps its done time. old is the
+// stored task replaced by task, nil if task is the stored one or new.
+func setStatus(task *model.TaskItem, status model.TaskStatus, old *model.TaskItem) {
+	from := task.Status
+	if old != nil {
+		from = old.Status
+		if task.StatusHistory == nil {
+			task.StatusHistory = old.StatusHistory
+		}
+	}
+	task.Status = status
+	if from != status {
+		recordStatus(task, from, model.ToSwiftTimestamp(time.Now()))
+	}
+	if status != model.TaskStatusDone {
+		task.DoneTime = 0
+		return
+	}
+	if task.DoneTime != 0 {
+		return
+	}
+	if old != nil && old.Status == model.TaskStatusDone && old.DoneTime != 0 {
+		task.DoneTime = old.DoneTime
+		return
+	}
+	task.DoneTime = model.ToSwiftTimestamp(time.Now())
+}
@@ -0,0 +1,77 @@
+package local_impl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+func storedTree() *taskTree {
+	return &taskTree{revision: 3, tasks: []*model.TaskItem{
+		{
+			ID:         1,
+			Title:      "Release",
+			Status:     model.TaskStatusCreated,
+			DueTime:    800000000,
+			Priority:   "A",
+			ExternalID: "jira:REL-1",
+			Links:      []*model.TaskLink{{URL: "https://example.com/dash", Kind: model.LinkKindDashboard}},
+			Revision:   2,
+		},
+	}}
+}
+
+func TestReplaceCarryOver(t *testing.T) {
+	tree := storedTree()
+	// as posted by a client not tracking revisions
+	err := tree.replace([]*model.TaskItem{{ID: 1, Title: "Release v2", Status: model.TaskStatusCreated}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := tree.tasks[0]
+	if saved.DueTime != 800000000 || saved.Priority != "A" || saved.ExternalID != "jira:REL-1" || len(saved.Links) != 1 {
+		t.Fatalf("expect omitted fields kept, actual: %s", toJSON(saved))
+	}
+	if saved.Revision != 3 {
+		t.Fatalf("expect revision bumped to 3, actual: %d", saved.Revision)
+	}
+
+	tree = storedTree()
+	err = tree.replace([]*model.TaskItem{{ID: 1, Title: "Release", Status: model.TaskStatusCreated, Links: []*model.TaskLink{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.tasks[0].Links) != 0 {
+		t.Fatalf("expect empty links to clear them, actual: %s", toJSON(tree.tasks[0].Links))
+	}
+}
+
+func TestReplaceTrackedRevision(t *testing.T) {
+	tree := storedTree()
+	// a client tracking revisions sends the fields it means
+	err := tree.replace([]*model.TaskItem{{ID: 1, Title: "Release", Status: model.TaskStatusCreated, Revision: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := tree.tasks[0]
+	if saved.DueTime != 0 || saved.Priority != "" || saved.ExternalID != "" || saved.Links != nil {
+		t.Fatalf("expect fields cleared, actual: %s", toJSON(saved))
+	}
+}
+
+func TestReplaceConflict(t *testing.T) {
+	tree := storedTree()
+	err := tree.replace([]*model.TaskItem{{ID: 1, Title: "Stale", Status: model.TaskStatusCreated, Revision: 1}})
+	var conflict *task.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expect conflict, actual: %v", err)
+	}
+	if conflict.TaskID != 1 || conflict.ExpectedRevision != 1 || conflict.ActualRevision != 2 {
+		t.Fatalf("unexpected conflict: %s", toJSON(conflict))
+	}
+	if tree.tasks[0].Title != "Release" || len(tree.events) != 0 {
+		t.Fatalf("expect nothing replaced, actual: %s", toJSON(tree.tasks))
+	}
+}
@@ -0,0 +1,315 @@
+// Package markdown converts task trees to and from nested Markdown checklists.
+//
+// Top level tasks are grouped under a `## <mode>` heading, subtasks are
+// indented by two spaces, and notes follow their task as indented quotes,
+// one quote block per note:
+//
+//	## work
+//
+//	- [ ] Release v2 <!-- started=2026-09-01T10:00:00Z -->
+//	  > check the changelog
+//	  - [x] Tag the commit <!-- started=2026-09-01T10:05:00Z -->
+//
+// Attributes a checklist cannot express are kept in a trailing comment,
+// so exported tasks are parsed back unchanged.
+package markdown
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// Render writes tasks as a Markdown checklist grouped by the mode of the top level tasks
+func Render(w io.Writer, tasks []*model.TaskItem) error {
+	var modes []model.TaskMode
+	groups := make(map[model.TaskMode][]*model.TaskItem)
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		mode := task.Mode
+		if mode == model.TaskModeShared {
+			mode = ""
+		}
+		if _, ok := groups[mode]; !ok {
+			modes = append(modes, mode)
+		}
+		groups[mode] = append(groups[mode], task)
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, mode := range modes {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		heading := string(mode)
+		if heading == "" {
+			heading = string(model.TaskModeShared)
+		}
+		fmt.Fprintf(bw, "## %s\n\n", heading)
+		for _, task := range groups[mode] {
+			renderTask(bw, task, 0, task.Mode)
+		}
+	}
+	return bw.Flush()
+}
+
+func renderTask(w *bufio.Writer, task *model.TaskItem, depth int, parentMode model.TaskMode) {
+	indent := strings.Repeat("  ", depth)
+	check := " "
+	if task.Status == model.TaskStatusDone {
+		check = "x"
+	}
+	title := strings.Join(strings.Fields(task.Title), " ")
+	fmt.Fprintf(w, "%s- [%s] %s", indent, check, title)
+
+	attrs := []string{"started=" + model.ConvertSwiftTimestamp(task.StartTime).Format(time.RFC3339Nano)}
+	if task.DueTime != 0 {
+		attrs = append(attrs, "due="+model.ConvertSwiftTimestamp(task.DueTime).Format(time.RFC3339Nano))
+	}
+	if task.DoneTime != 0 {
+		attrs = append(attrs, "done="+model.ConvertSwiftTimestamp(task.DoneTime).Format(time.RFC3339Nano))
+	}
+	if task.Priority != "" {
+		attrs = append(attrs, "priority="+task.Priority)
+	}
+	if task.Status != "" && task.Status != model.TaskStatusCreated && task.Status != model.TaskStatusDone {
+		attrs = append(attrs, "status="+string(task.Status))
+	}
+	if task.Mode != parentMode {
+		mode := string(task.Mode)
+		if mode == "" {
+			mode = string(model.TaskModeShared)
+		}
+		attrs = append(attrs, "mode="+mode)
+	}
+	fmt.Fprintf(w, " <!-- %s -->", strings.Join(attrs, " "))
+	w.WriteString("\n")
+
+	for i, note := range task.Notes {
+		if i > 0 {
+			w.WriteString("\n")
+		}
+		for _, line := range strings.Split(note, "\n") {
+			if line == "" {
+				fmt.Fprintf(w, "%s  >\n", indent)
+				continue
+			}
+			fmt.Fprintf(w, "%s  > %s\n", indent, line)
+		}
+	}
+	for _, sub := range task.SubTasks {
+		if sub == nil {
+			continue
+		}
+		renderTask(w, sub, depth+1, task.Mode)
+	}
+}
+
+// Parse reads the checklist items of a Markdown document as a task tree,
+// other lines are ignored. Top level items before any mode heading get mode,
+// subtasks inherit the mode of their parent. Only the work, life and shared
+// headings switch the mode, other headings just end the list above them.
+// IDs are left zero, tasks without start time start now.
+func Parse(r io.Reader, mode model.TaskMode) ([]*model.TaskItem, error) {
+	type level struct {
+		indent int
+		task   *model.TaskItem
+	}
+	var stack []level
+	tasks := []*model.TaskItem{}
+	currentMode := mode
+	now := model.ToSwiftTimestamp(time.Now())
+
+	// the note being read, and the task it belongs to
+	var note []string
+	var noteTask *model.TaskItem
+	flushNote := func() {
+		if noteTask != nil {
+			noteTask.Notes = append(noteTask.Notes, strings.Join(note, "\n"))
+		}
+		note = nil
+		noteTask = nil
+	}
+	// parentAt pops the items the line at indent is not nested in
+	parentAt := func(indent int) *model.TaskItem {
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			return nil
+		}
+		return stack[len(stack)-1].task
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		content := strings.TrimLeft(line, " \t")
+		indent := indentWidth(line[:len(line)-len(content)])
+
+		if strings.HasPrefix(content, ">") {
+			text := strings.TrimPrefix(content, ">")
+			text = strings.TrimPrefix(text, " ")
+			if noteTask == nil {
+				noteTask = parentAt(indent)
+				if noteTask == nil {
+					// a quote outside of any task
+					continue
+				}
+			}
+			note = append(note, text)
+			continue
+		}
+		flushNote()
+
+		if content == "" {
+			continue
+		}
+		if strings.HasPrefix(content, "## ") {
+			if m, ok := parseMode(strings.TrimPrefix(content, "## ")); ok {
+				currentMode = m
+			}
+			stack = nil
+			continue
+		}
+		check, rest, ok := parseItem(content)
+		if !ok {
+			// other content still ends the items nested deeper
+			parentAt(indent)
+			continue
+		}
+		title, attrs, err := parseAttrs(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		task := &model.TaskItem{
+			Title:     title,
+			StartTime: now,
+			Status:    model.TaskStatusCreated,
+			SubTasks:  []*model.TaskItem{},
+			Notes:     []string{},
+		}
+		if check {
+			task.Status = model.TaskStatusDone
+		}
+		parent := parentAt(indent)
+		if parent != nil {
+			task.Mode = parent.Mode
+		} else {
+			task.Mode = currentMode
+		}
+		for key, value := range attrs {
+			switch key {
+			case "started":
+				t, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid started: %s", lineNo, value)
+				}
+				task.StartTime = model.ToSwiftTimestamp(t)
+			case "due":
+				t, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid due: %s", lineNo, value)
+				}
+				task.DueTime = model.ToSwiftTimestamp(t)
+			case "done":
+				t, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid done: %s", lineNo, value)
+				}
+				task.DoneTime = model.ToSwiftTimestamp(t)
+			case "priority":
+				task.Priority = value
+			case "status":
+				task.Status = model.TaskStatus(value)
+			case "mode":
+				if m, ok := parseMode(value); ok {
+					task.Mode = m
+				}
+			}
+		}
+		if parent != nil {
+			parent.SubTasks = append(parent.SubTasks, task)
+		} else {
+			tasks = append(tasks, task)
+		}
+		stack = append(stack, level{indent: indent, task: task})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flushNote()
+	return tasks, nil
+}
+
+// parseMode parses a mode heading or attribute, shared is the empty mode
+func parseMode(s string) (model.TaskMode, bool) {
+	switch m := model.TaskMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case model.TaskModeWork, model.TaskModeLife:
+		return m, true
+	case model.TaskModeShared:
+		return "", true
+	}
+	return "", false
+}
+
+func indentWidth(s string) int {
+	n := 0
+	for _, c := range s {
+		if c == '\t' {
+			n += 4
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// parseItem parses `- [ ] rest`, `*` and `+` bullets are accepted too
+func parseItem(content string) (check bool, rest string, ok bool) {
+	if len(content) < 5 || !strings.ContainsRune("-*+", rune(content[0])) || content[1] != ' ' {
+		return false, "", false
+	}
+	box := strings.TrimLeft(content[1:], " ")
+	if len(box) < 3 || box[0] != '[' || box[2] != ']' {
+		return false, "", false
+	}
+	switch box[1] {
+	case ' ':
+	case 'x', 'X':
+		check = true
+	default:
+		return false, "", false
+	}
+	return check, strings.TrimSpace(box[3:]), true
+}
+
+// parseAttrs splits the trailing `<!-- key=value ... -->` comment from the title
+func parseAttrs(rest string) (string, map[string]string, error) {
+	if !strings.HasSuffix(rest, "-->") {
+		return rest, nil, nil
+	}
+	start := strings.LastIndex(rest, "<!--")
+	if start < 0 {
+		return rest, nil, nil
+	}
+	comment := strings.TrimSuffix(rest[start+len("<!--"):], "-->")
+	attrs := make(map[string]string)
+	for _, field := range strings.Fields(comment) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("invalid attribute: %s", field)
+		}
+		attrs[key] = value
+	}
+	return strings.TrimSpace(rest[:start]), attrs, nil
+}
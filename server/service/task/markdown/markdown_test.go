@@ -0,0 +1,110 @@
+package markdown
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func swiftTime(s string) model.SwiftTimestamp {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return model.ToSwiftTimestamp(t)
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+func TestRoundTrip(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{
+			Title:     "Release v2",
+			StartTime: swiftTime("2026-09-01T10:00:00Z"),
+			DueTime:   swiftTime("2026-09-05T18:00:00Z"),
+			Mode:      model.TaskModeWork,
+			Status:    model.TaskStatusCreated,
+			Priority:  "A",
+			Notes:     []string{"check the changelog", "first line\n\nafter a blank line"},
+			SubTasks: []*model.TaskItem{
+				{
+					Title:     "Tag the commit",
+					StartTime: swiftTime("2026-09-01T10:05:00Z"),
+					DoneTime:  swiftTime("2026-09-02T09:00:00Z"),
+					Mode:      model.TaskModeWork,
+					Status:    model.TaskStatusDone,
+					Notes:     []string{},
+					SubTasks:  []*model.TaskItem{},
+				},
+				{
+					Title:     "Shared step",
+					StartTime: swiftTime("2026-09-01T10:06:00Z"),
+					Status:    model.TaskStatusArchived,
+					Notes:     []string{},
+					SubTasks:  []*model.TaskItem{},
+				},
+			},
+		},
+		{
+			Title:     "Groceries",
+			StartTime: swiftTime("2026-09-03T08:00:00Z"),
+			Mode:      model.TaskModeLife,
+			Status:    model.TaskStatusCreated,
+			Notes:     []string{},
+			SubTasks:  []*model.TaskItem{},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tasks); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buf, model.TaskModeWork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expect := toJSON(parsed), toJSON(tasks); actual != expect {
+		t.Fatalf("round trip changed the tasks, expect: %s\nactual: %s", expect, actual)
+	}
+}
+
+func TestParseHeadings(t *testing.T) {
+	doc := `
+# Plan
+
+- [ ] Before any heading
+
+## Life
+
+- [ ] Call mom
+
+## Sprint 12
+
+- [ ] Still life
+  - [x] Nested
+
+## shared
+
+- [ ] Anyone
+- [ ] Odd mode <!-- mode=holiday -->
+`
+	tasks, err := Parse(strings.NewReader(doc), model.TaskModeWork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		actual = append(actual, task.Title+":"+string(task.Mode))
+		return true
+	})
+	expect := []string{"Before any heading:work", "Call mom:life", "Still life:life", "Nested:life", "Anyone:", "Odd mode:"}
+	if strings.Join(actual, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expect %v, actual: %v", expect, actual)
+	}
+}
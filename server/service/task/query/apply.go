@@ -0,0 +1,205 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+type ResultMode string
+
+const (
+	// ResultTree keeps matched tasks in place with their subtrees,
+	// together with their ancestors
+	ResultTree ResultMode = "tree"
+	// ResultFlat returns matched tasks as a plain list without subtasks
+	ResultFlat ResultMode = "flat"
+)
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+type Options struct {
+	Query  *Query
+	Result ResultMode
+	Sort   []*SortKey
+	// Limit and Offset paginate the top level tasks in tree mode,
+	// and the whole list in flat mode. Limit <= 0 means no limit.
+	Limit  int
+	Offset int
+}
+
+var sortFields = map[string]string{
+	"id":        "id",
+	"title":     "title",
+	"status":    "status",
+	"mode":      "mode",
+	"started":   "started",
+	"starttime": "started",
+	"notes":     "notes",
+}
+
+// ParseSort parses comma separated sort keys, a leading `-` sorts descending.
+// e.g. `-started,title`
+func ParseSort(s string) ([]*SortKey, error) {
+	var keys []*SortKey
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := &SortKey{}
+		if strings.HasPrefix(part, "-") {
+			key.Desc = true
+			part = part[1:]
+		} else if strings.HasPrefix(part, "+") {
+			part = part[1:]
+		}
+		field, ok := sortFields[strings.ToLower(part)]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field: %s", part)
+		}
+		key.Field = field
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func ParseResultMode(s string) (ResultMode, error) {
+	switch ResultMode(s) {
+	case "", ResultTree:
+		return ResultTree, nil
+	case ResultFlat:
+		return ResultFlat, nil
+	}
+	return "", fmt.Errorf("unknown result mode: %s, expect tree or flat", s)
+}
+
+// Apply filters, sorts and paginates tasks according to opts.
+// The input tree is not modified.
+func Apply(tasks []*model.TaskItem, opts *Options) []*model.TaskItem {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var result []*model.TaskItem
+	if opts.Result == ResultFlat {
+		result = flatten(tasks, opts.Query)
+		sortTasks(result, opts.Sort)
+	} else {
+		result = filterTree(tasks, opts.Query)
+		sortTree(result, opts.Sort)
+	}
+	return paginate(result, opts.Offset, opts.Limit)
+}
+
+func flatten(tasks []*model.TaskItem, q *Query) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0)
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		if q.Match(task) {
+			cl := task.ShallowClone()
+			cl.SubTasks = []*model.TaskItem{}
+			result = append(result, cl)
+		}
+		return true
+	})
+	return result
+}
+
+// filterTree keeps a task with its whole subtree if it matches,
+// and as a parent of the filtered subtasks if any of its descendants matches.
+// Kept tasks are cloned so sorting does not modify the input.
+func filterTree(tasks []*model.TaskItem, q *Query) []*model.TaskItem {
+	result := make([]*model.TaskItem, 0, len(tasks))
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		if q.Match(task) {
+			result = append(result, task.DeepClone())
+			continue
+		}
+		subTasks := filterTree(task.SubTasks, q)
+		if len(subTasks) == 0 {
+			continue
+		}
+		cl := task.ShallowClone()
+		cl.SubTasks = subTasks
+		result = append(result, cl)
+	}
+	return result
+}
+
+func sortTree(tasks []*model.TaskItem, keys []*SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sortTasks(tasks, keys)
+	for _, task := range tasks {
+		sortTree(task.SubTasks, keys)
+	}
+}
+
+func sortTasks(tasks []*model.TaskItem, keys []*SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		for _, key := range keys {
+			c := compare(tasks[i], tasks[j], key.Field)
+			if c == 0 {
+				continue
+			}
+			if key.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func compare(a *model.TaskItem, b *model.TaskItem, field string) int {
+	switch field {
+	case "id":
+		return compareOrdered(a.ID, b.ID)
+	case "title":
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case "status":
+		return strings.Compare(string(a.Status), string(b.Status))
+	case "mode":
+		return strings.Compare(string(a.Mode), string(b.Mode))
+	case "started":
+		return compareOrdered(a.StartTime, b.StartTime)
+	case "notes":
+		return compareOrdered(len(a.Notes), len(b.Notes))
+	}
+	return 0
+}
+
+func compareOrdered[T int | int64 | model.SwiftTimestamp](a T, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func paginate(tasks []*model.TaskItem, offset int, limit int) []*model.TaskItem {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(tasks) {
+		return []*model.TaskItem{}
+	}
+	tasks = tasks[offset:]
+	if limit > 0 && limit < len(tasks) {
+		tasks = tasks[:limit]
+	}
+	return tasks
+}
@@ -0,0 +1,396 @@
+// Package query implements a small filter language for task trees.
+//
+// A query is a list of whitespace separated terms, all of which must match:
+//
+//	status:created mode:work started:>2026-09-01 has:notes title:~deploy
+//
+// A term is `field:value`, where value may start with an operator:
+// `~`(contains), `>`, `>=`, `<`, `<=`. Without operator the value is
+// compared for equality. Comma separated values match any of them.
+// A leading `-` negates the term, and a term without field matches titles
+// containing it. Values with spaces can be double quoted, a quoted term
+// such as `"todo: later"` is always a title search.
+// Unknown fields, and `>`, `<` on text fields, are parse errors.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+type Op string
+
+const (
+	OpEqual        Op = "="
+	OpContains     Op = "~"
+	OpGreater      Op = ">"
+	OpGreaterEqual Op = ">="
+	OpLess         Op = "<"
+	OpLessEqual    Op = "<="
+)
+
+// Query is a conjunction of terms
+type Query struct {
+	Terms []*Term
+}
+
+type Term struct {
+	Negate bool
+	Field  string
+	Op     Op
+	Values []string
+
+	nums  []int64
+	times []timeRange
+}
+
+// timeRange is [start,end), a date without time covers the whole day
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+var fields = map[string]bool{
+	"id":      true,
+	"parent":  true,
+	"status":  true,
+	"mode":    true,
+	"title":   true,
+	"note":    true,
+	"started": true,
+	"has":     true,
+}
+
+var fieldAlias = map[string]string{
+	"parentid":  "parent",
+	"notes":     "note",
+	"starttime": "started",
+	"start":     "started",
+}
+
+// Parse parses the query string, an empty string yields an empty query
+// which matches every task.
+func Parse(s string) (*Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{}
+	for _, token := range tokens {
+		term, err := parseTerm(token.text, token.quoted)
+		if err != nil {
+			return nil, err
+		}
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+// IsEmpty reports whether the query matches everything
+func (q *Query) IsEmpty() bool {
+	return q == nil || len(q.Terms) == 0
+}
+
+// Match reports whether the task matches all terms
+func (q *Query) Match(task *model.TaskItem) bool {
+	if q == nil {
+		return true
+	}
+	for _, term := range q.Terms {
+		if term.match(task) == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+type token struct {
+	text string
+	// quoted is set if a double quote appears before the first colon,
+	// so the token is not a field:value term
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	var b strings.Builder
+	inQuote := false
+	hasToken := false
+	quoted := false
+	hasColon := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasToken = true
+			if !hasColon {
+				quoted = true
+			}
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if hasToken {
+				tokens = append(tokens, token{text: b.String(), quoted: quoted})
+				b.Reset()
+				hasToken = false
+				quoted = false
+				hasColon = false
+			}
+		default:
+			if r == ':' {
+				hasColon = true
+			}
+			b.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query: %s", s)
+	}
+	if hasToken {
+		tokens = append(tokens, token{text: b.String(), quoted: quoted})
+	}
+	return tokens, nil
+}
+
+func parseTerm(token string, quoted bool) (*Term, error) {
+	term := &Term{}
+	if strings.HasPrefix(token, "-") && len(token) > 1 {
+		term.Negate = true
+		token = token[1:]
+	}
+	field, value, ok := strings.Cut(token, ":")
+	if ok && !quoted && isWord(field) {
+		field = strings.ToLower(field)
+		if alias, ok := fieldAlias[field]; ok {
+			field = alias
+		}
+		if !fields[field] {
+			return nil, fmt.Errorf("unknown field: %s, quote the term to search titles", field)
+		}
+	} else {
+		ok = false
+	}
+	if !ok {
+		// bare word
+		term.Field = "title"
+		term.Op = OpContains
+		term.Values = []string{token}
+		return term, nil
+	}
+	term.Field = field
+	term.Op = OpEqual
+	for _, op := range []Op{OpGreaterEqual, OpLessEqual, OpGreater, OpLess, OpContains, OpEqual} {
+		if strings.HasPrefix(value, string(op)) {
+			term.Op = op
+			value = value[len(op):]
+			break
+		}
+	}
+	if value == "" {
+		return nil, fmt.Errorf("missing value for %s", field)
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v == "" {
+			continue
+		}
+		term.Values = append(term.Values, v)
+	}
+
+	switch field {
+	case "id", "parent":
+		if term.Op == OpContains {
+			return nil, fmt.Errorf("%s does not support ~", field)
+		}
+		for _, v := range term.Values {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", field, v)
+			}
+			term.nums = append(term.nums, n)
+		}
+	case "started":
+		if term.Op == OpContains {
+			return nil, fmt.Errorf("%s does not support ~", field)
+		}
+		for _, v := range term.Values {
+			tr, err := parseTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", field, v)
+			}
+			term.times = append(term.times, tr)
+		}
+	case "has":
+		if term.Op != OpEqual {
+			return nil, fmt.Errorf("has only supports equality")
+		}
+		for _, v := range term.Values {
+			switch v {
+			case "notes", "subtasks", "parent":
+			default:
+				return nil, fmt.Errorf("unknown has:%s, expect notes, subtasks or parent", v)
+			}
+		}
+	case "status", "mode":
+		if term.Op != OpEqual {
+			return nil, fmt.Errorf("%s only supports equality", field)
+		}
+	case "title", "note":
+		if term.Op != OpEqual && term.Op != OpContains {
+			return nil, fmt.Errorf("%s only supports equality and ~", field)
+		}
+	}
+	return term, nil
+}
+
+// isWord reports whether s looks like a field name, so that bare words
+// such as 12:30 or http://host are title searches
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTime(s string) (timeRange, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return timeRange{start: t, end: t.AddDate(0, 0, 1)}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return timeRange{start: t, end: t}, nil
+		}
+	}
+	return timeRange{}, fmt.Errorf("unrecognized time: %s", s)
+}
+
+func (c *Term) match(task *model.TaskItem) bool {
+	switch c.Field {
+	case "id":
+		return c.matchNum(task.ID)
+	case "parent":
+		return c.matchNum(task.ParentID)
+	case "status":
+		status := task.Status
+		if status == "" {
+			status = model.TaskStatusCreated
+		}
+		return c.matchAny(func(v string) bool {
+			return strings.EqualFold(v, string(status))
+		})
+	case "mode":
+		return c.matchAny(func(v string) bool {
+			if strings.EqualFold(v, string(model.TaskModeShared)) {
+				return task.Mode == "" || task.Mode == model.TaskModeShared
+			}
+			return strings.EqualFold(v, string(task.Mode))
+		})
+	case "title":
+		return c.matchAny(func(v string) bool {
+			return c.matchText(task.Title, v)
+		})
+	case "note":
+		return c.matchAny(func(v string) bool {
+			for _, note := range task.Notes {
+				if c.matchText(note, v) {
+					return true
+				}
+			}
+			return false
+		})
+	case "started":
+		if task.StartTime == 0 {
+			return false
+		}
+		t := model.ConvertSwiftTimestamp(task.StartTime)
+		for _, tr := range c.times {
+			if matchTime(c.Op, t, tr) {
+				return true
+			}
+		}
+		return false
+	case "has":
+		return c.matchAny(func(v string) bool {
+			switch v {
+			case "notes":
+				return len(task.Notes) > 0
+			case "subtasks":
+				return len(task.SubTasks) > 0
+			case "parent":
+				return task.ParentID != 0
+			}
+			return false
+		})
+	}
+	return false
+}
+
+func (c *Term) matchAny(fn func(v string) bool) bool {
+	for _, v := range c.Values {
+		if fn(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Term) matchText(text string, v string) bool {
+	if c.Op == OpContains {
+		return strings.Contains(strings.ToLower(text), strings.ToLower(v))
+	}
+	return strings.EqualFold(text, v)
+}
+
+func (c *Term) matchNum(n int64) bool {
+	for _, v := range c.nums {
+		var ok bool
+		switch c.Op {
+		case OpEqual:
+			ok = n == v
+		case OpGreater:
+			ok = n > v
+		case OpGreaterEqual:
+			ok = n >= v
+		case OpLess:
+			ok = n < v
+		case OpLessEqual:
+			ok = n <= v
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTime(op Op, t time.Time, tr timeRange) bool {
+	switch op {
+	case OpEqual:
+		if tr.start.Equal(tr.end) {
+			return t.Equal(tr.start)
+		}
+		return !t.Before(tr.start) && t.Before(tr.end)
+	case OpGreater:
+		if tr.start.Equal(tr.end) {
+			return t.After(tr.start)
+		}
+		return !t.Before(tr.end)
+	case OpGreaterEqual:
+		return !t.Before(tr.start)
+	case OpLess:
+		return t.Before(tr.start)
+	case OpLessEqual:
+		if tr.start.Equal(tr.end) {
+			return !t.After(tr.start)
+		}
+		return t.Before(tr.end)
+	}
+	return false
+}
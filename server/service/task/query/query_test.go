@@ -0,0 +1,133 @@
+package query
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []*Term
+		err   string
+	}{
+		{query: "", terms: nil},
+		{query: "deploy", terms: []*Term{{Field: "title", Op: OpContains, Values: []string{"deploy"}}}},
+		{query: "status:created,done", terms: []*Term{{Field: "status", Op: OpEqual, Values: []string{"created", "done"}}}},
+		{query: "-mode:work", terms: []*Term{{Negate: true, Field: "mode", Op: OpEqual, Values: []string{"work"}}}},
+		{query: "title:~deploy", terms: []*Term{{Field: "title", Op: OpContains, Values: []string{"deploy"}}}},
+		{query: `title:"release notes"`, terms: []*Term{{Field: "title", Op: OpEqual, Values: []string{"release notes"}}}},
+		{query: `"todo: later"`, terms: []*Term{{Field: "title", Op: OpContains, Values: []string{"todo: later"}}}},
+		{query: "12:30", terms: []*Term{{Field: "title", Op: OpContains, Values: []string{"12:30"}}}},
+		{query: "Notes:~x", terms: []*Term{{Field: "note", Op: OpContains, Values: []string{"x"}}}},
+		{query: "stauts:done", err: "unknown field: stauts"},
+		{query: "title:>x", err: "title only supports equality and ~"},
+		{query: "note:<=x", err: "note only supports equality and ~"},
+		{query: "status:~do", err: "status only supports equality"},
+		{query: "id:~1", err: "id does not support ~"},
+		{query: "id:abc", err: "invalid id: abc"},
+		{query: "started:yesterday", err: "invalid started: yesterday"},
+		{query: "has:links", err: "unknown has:links"},
+		{query: "title:", err: "missing value for title"},
+		{query: `title:"open`, err: "unterminated quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expect error %q, actual: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, term := range q.Terms {
+				term.nums = nil
+				term.times = nil
+			}
+			if !reflect.DeepEqual(q.Terms, tt.terms) {
+				t.Fatalf("expect terms %s, actual: %s", formatTerms(tt.terms), formatTerms(q.Terms))
+			}
+		})
+	}
+}
+
+func formatTerms(terms []*Term) string {
+	var parts []string
+	for _, term := range terms {
+		parts = append(parts, strings.Join([]string{term.Field, string(term.Op), strings.Join(term.Values, ",")}, " "))
+	}
+	return "[" + strings.Join(parts, "; ") + "]"
+}
+
+func testTree() []*model.TaskItem {
+	return []*model.TaskItem{
+		{ID: 1, Title: "Release", Mode: model.TaskModeWork, SubTasks: []*model.TaskItem{
+			{ID: 2, ParentID: 1, Title: "Write notes", Status: model.TaskStatusDone},
+			{ID: 3, ParentID: 1, Title: "Deploy", SubTasks: []*model.TaskItem{
+				{ID: 4, ParentID: 3, Title: "Check metrics"},
+			}},
+		}},
+		{ID: 5, Title: "Groceries", Mode: model.TaskModeLife, Notes: []string{"milk"}},
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		opts  *Options
+		// expect is the ids of the result, subtasks in parentheses
+		expect string
+	}{
+		{name: "empty", query: "", expect: "1(2 3(4)) 5"},
+		{name: "matching task keeps subtree", query: "title:release", expect: "1(2 3(4))"},
+		{name: "ancestors of match", query: "title:~metrics", expect: "1(3(4))"},
+		{name: "match in the middle", query: "deploy", expect: "1(3(4))"},
+		{name: "negate", query: "-status:done mode:work", expect: "1(2 3(4))"},
+		{name: "no match", query: "title:~nothing", expect: ""},
+		{name: "has notes", query: "has:notes", expect: "5"},
+		{name: "flat", query: "-has:subtasks", opts: &Options{Result: ResultFlat}, expect: "2 4 5"},
+		{name: "sort", query: "", opts: &Options{Sort: []*SortKey{{Field: "title"}}}, expect: "5 1(3(4) 2)"},
+		{name: "paginate", query: "", opts: &Options{Offset: 1, Limit: 1}, expect: "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := tt.opts
+			if opts == nil {
+				opts = &Options{}
+			}
+			opts.Query = q
+			tasks := testTree()
+			result := Apply(tasks, opts)
+			if actual := formatIDs(result); actual != tt.expect {
+				t.Fatalf("expect %q, actual: %q", tt.expect, actual)
+			}
+			if !reflect.DeepEqual(tasks, testTree()) {
+				t.Fatalf("input tree modified")
+			}
+		})
+	}
+}
+
+func formatIDs(tasks []*model.TaskItem) string {
+	var parts []string
+	for _, task := range tasks {
+		s := strconv.FormatInt(task.ID, 10)
+		if len(task.SubTasks) > 0 {
+			s += "(" + formatIDs(task.SubTasks) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
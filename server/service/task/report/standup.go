@@ -0,0 +1,242 @@
+// Package report summarizes what happened to tasks over a period,
+// from their status history and note times.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// Standup lists what happened on a day, by mode
+type Standup struct {
+	// Date is the day reported, 2006-01-02
+	Date   string          `json:"date"`
+	Groups []*StandupGroup `json:"groups"`
+}
+
+type StandupGroup struct {
+	Mode model.TaskMode `json:"mode"`
+	// Completed are the tasks marked done on the day
+	Completed []*StandupItem `json:"completed"`
+	// Started are the tasks created on the day
+	Started []*StandupItem `json:"started"`
+	// Notes are the notes added on the day
+	Notes []*StandupItem `json:"notes"`
+	// InProgress are the tasks still open at the end of the day
+	// that were started, noted or changed status on it
+	InProgress []*StandupItem `json:"inProgress"`
+}
+
+type StandupItem struct {
+	TaskID int64  `json:"taskID"`
+	Title  string `json:"title"`
+	// Path is the titles of the ancestors
+	Path []string `json:"path"`
+	// Time is when it happened, the start time for tasks in progress
+	Time model.SwiftTimestamp `json:"time"`
+	// Note is the note added, only for notes
+	Note string `json:"note,omitempty"`
+}
+
+// modeOrder lists the groups first, other modes follow by name
+var modeOrder = []model.TaskMode{model.TaskModeWork, model.TaskModeLife, model.TaskModeShared}
+
+// BuildStandup reports the day starting at start. Tasks with a status
+// history are judged by it, others by their start and done times.
+func BuildStandup(tasks []*model.TaskItem, start time.Time) *Standup {
+	end := start.AddDate(0, 0, 1)
+	from, to := model.ToSwiftTimestamp(start), model.ToSwiftTimestamp(end)
+	inDay := func(ts model.SwiftTimestamp) bool {
+		return ts != 0 && ts >= from && ts < to
+	}
+
+	groups := make(map[model.TaskMode]*StandupGroup)
+	group := func(mode model.TaskMode) *StandupGroup {
+		if mode == "" {
+			mode = model.TaskModeShared
+		}
+		g, ok := groups[mode]
+		if !ok {
+			g = &StandupGroup{
+				Mode:       mode,
+				Completed:  []*StandupItem{},
+				Started:    []*StandupItem{},
+				Notes:      []*StandupItem{},
+				InProgress: []*StandupItem{},
+			}
+			groups[mode] = g
+		}
+		return g
+	}
+
+	var walk func(tasks []*model.TaskItem, path []string)
+	walk = func(tasks []*model.TaskItem, path []string) {
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			item := func(ts model.SwiftTimestamp) *StandupItem {
+				return &StandupItem{TaskID: task.ID, Title: task.Title, Path: path, Time: ts}
+			}
+			if ts, ok := doneAt(task, inDay); ok {
+				g := group(task.Mode)
+				g.Completed = append(g.Completed, item(ts))
+			}
+			if created := createdAt(task); inDay(created) {
+				g := group(task.Mode)
+				g.Started = append(g.Started, item(created))
+			}
+			noted := false
+			for i, note := range task.Notes {
+				if i < len(task.NoteTimes) && inDay(task.NoteTimes[i]) {
+					g := group(task.Mode)
+					n := item(task.NoteTimes[i])
+					n.Note = note
+					g.Notes = append(g.Notes, n)
+					noted = true
+				}
+			}
+			touched := noted || inDay(createdAt(task)) || changedIn(task, inDay)
+			if touched && isOpen(statusAt(task, to)) {
+				g := group(task.Mode)
+				g.InProgress = append(g.InProgress, item(task.StartTime))
+			}
+			walk(task.SubTasks, append(path[:len(path):len(path)], task.Title))
+		}
+	}
+	walk(tasks, []string{})
+
+	report := &Standup{
+		Date:   start.Format("2006-01-02"),
+		Groups: []*StandupGroup{},
+	}
+	for _, mode := range modeOrder {
+		if g, ok := groups[mode]; ok {
+			report.Groups = append(report.Groups, g)
+			delete(groups, mode)
+		}
+	}
+	var others []*StandupGroup
+	for _, g := range groups {
+		others = append(others, g)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Mode < others[j].Mode })
+	report.Groups = append(report.Groups, others...)
+	for _, g := range report.Groups {
+		for _, items := range [][]*StandupItem{g.Completed, g.Started, g.Notes} {
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Time < items[j].Time })
+		}
+	}
+	return report
+}
+
+// doneAt returns the last time the task was marked done within the range
+func doneAt(task *model.TaskItem, inRange func(ts model.SwiftTimestamp) bool) (model.SwiftTimestamp, bool) {
+	var at model.SwiftTimestamp
+	found := false
+	for _, ts := range doneTimes(task) {
+		if inRange(ts) {
+			at, found = ts, true
+		}
+	}
+	return at, found
+}
+
+// changedIn reports whether the status changed within the range
+func changedIn(task *model.TaskItem, inRange func(ts model.SwiftTimestamp) bool) bool {
+	for _, change := range task.StatusHistory {
+		if change != nil && inRange(change.Time) {
+			return true
+		}
+	}
+	return false
+}
+
+// createdAt is the time of the initial status, the start time if unknown
+func createdAt(task *model.TaskItem) model.SwiftTimestamp {
+	for _, change := range task.StatusHistory {
+		if change != nil && change.From == "" {
+			return change.Time
+		}
+	}
+	return task.StartTime
+}
+
+// isOpen reports whether the status is neither done nor archived,
+// legacy tasks have an empty status
+func isOpen(status model.TaskStatus) bool {
+	return status != model.TaskStatusDone && status != model.TaskStatusArchived
+}
+
+// statusAt returns the status the task had just before t
+func statusAt(task *model.TaskItem, t model.SwiftTimestamp) model.TaskStatus {
+	if len(task.StatusHistory) == 0 {
+		if task.Status == model.TaskStatusDone && task.DoneTime >= t {
+			return model.TaskStatusCreated
+		}
+		return task.Status
+	}
+	var status model.TaskStatus
+	for _, change := range task.StatusHistory {
+		if change == nil || change.Time >= t {
+			continue
+		}
+		status = change.To
+	}
+	if status == "" && len(task.StatusHistory) > 0 && task.StatusHistory[0] != nil && task.StatusHistory[0].From != "" {
+		// the history starts after t, with the status before it
+		status = task.StatusHistory[0].From
+	}
+	return status
+}
+
+// RenderStandup writes the report as Markdown, empty sections are left out
+func RenderStandup(w io.Writer, report *Standup) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Standup %s\n", report.Date)
+	empty := true
+	for _, g := range report.Groups {
+		sections := []struct {
+			title string
+			items []*StandupItem
+		}{
+			{"Completed", g.Completed},
+			{"Started", g.Started},
+			{"Notes", g.Notes},
+			{"In progress", g.InProgress},
+		}
+		written := false
+		for _, section := range sections {
+			if len(section.items) == 0 {
+				continue
+			}
+			if !written {
+				fmt.Fprintf(&b, "\n## %s\n", g.Mode)
+				written = true
+				empty = false
+			}
+			fmt.Fprintf(&b, "\n### %s\n\n", section.title)
+			for _, item := range section.items {
+				title := strings.Join(append(item.Path[:len(item.Path):len(item.Path)], item.Title), " / ")
+				if item.Note == "" {
+					fmt.Fprintf(&b, "- %s\n", title)
+					continue
+				}
+				fmt.Fprintf(&b, "- %s:\n", title)
+				for _, line := range strings.Split(item.Note, "\n") {
+					fmt.Fprintf(&b, "  > %s\n", line)
+				}
+			}
+		}
+	}
+	if empty {
+		b.WriteString("\nNothing recorded.\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
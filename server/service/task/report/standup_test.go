@@ -0,0 +1,212 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// at parses a UTC time like 2024-03-05 10:00
+func at(s string) model.SwiftTimestamp {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return model.ToSwiftTimestamp(t)
+}
+
+func change(from model.TaskStatus, to model.TaskStatus, s string) *model.StatusChange {
+	return &model.StatusChange{From: from, To: to, Time: at(s)}
+}
+
+// reportTasks is a small tree with fixed times around 2024-03-05
+func reportTasks() []*model.TaskItem {
+	const created, done = model.TaskStatusCreated, model.TaskStatusDone
+	return []*model.TaskItem{
+		{
+			ID: 1, Title: "Ship", Mode: model.TaskModeWork, Status: done,
+			StatusHistory: []*model.StatusChange{
+				change("", created, "2024-03-04 09:00"),
+				change(created, done, "2024-03-05 10:00"),
+				change(done, created, "2024-03-05 11:00"),
+				change(created, done, "2024-03-05 15:00"),
+			},
+		},
+		{
+			ID: 2, Title: "Review", Mode: model.TaskModeWork, Status: created,
+			StatusHistory: []*model.StatusChange{
+				change("", created, "2024-03-01 09:00"),
+				change(created, done, "2024-03-02 10:00"),
+				change(done, created, "2024-03-05 09:00"),
+			},
+		},
+		{ID: 3, Title: "Groceries", Mode: model.TaskModeLife, Status: created, StartTime: at("2024-03-05 08:00")},
+		{ID: 4, Title: "Taxes", Status: done, StartTime: at("2024-03-01 08:00"), DoneTime: at("2024-03-05 12:00")},
+		{
+			ID: 5, Title: "Backlog", Mode: model.TaskModeWork, Status: created,
+			StatusHistory: []*model.StatusChange{change("", created, "2024-03-01 09:00")},
+			SubTasks: []*model.TaskItem{
+				{
+					ID: 6, ParentID: 5, Title: "Spec", Mode: model.TaskModeWork, Status: created,
+					StatusHistory: []*model.StatusChange{change("", created, "2024-03-02 09:00")},
+					Notes:         []string{"outline", "drafted"},
+					NoteTimes:     []model.SwiftTimestamp{at("2024-03-02 09:30"), at("2024-03-05 14:00")},
+				},
+			},
+		},
+	}
+}
+
+// summarize lists the task ids of each non-empty section, one group per line
+func summarize(report *Standup) string {
+	var lines []string
+	for _, g := range report.Groups {
+		line := string(g.Mode)
+		for _, section := range []struct {
+			name  string
+			items []*StandupItem
+		}{
+			{"completed", g.Completed},
+			{"started", g.Started},
+			{"notes", g.Notes},
+			{"inProgress", g.InProgress},
+		} {
+			if len(section.items) == 0 {
+				continue
+			}
+			ids := make([]string, 0, len(section.items))
+			for _, item := range section.items {
+				ids = append(ids, fmt.Sprint(item.TaskID))
+			}
+			line += fmt.Sprintf(" %s:%s", section.name, strings.Join(ids, ","))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBuildStandup(t *testing.T) {
+	tests := []struct {
+		date   string
+		expect string
+	}{
+		{
+			date: "2024-03-05",
+			expect: "work completed:1 notes:6 inProgress:2,6\n" +
+				"life started:3 inProgress:3\n" +
+				"shared completed:4",
+		},
+		{
+			date:   "2024-03-02",
+			expect: "work completed:2 started:6 notes:6 inProgress:6",
+		},
+		{
+			date:   "2024-03-04",
+			expect: "work started:1 inProgress:1",
+		},
+		{date: "2024-03-06", expect: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			report := BuildStandup(reportTasks(), day(tt.date))
+			if report.Date != tt.date {
+				t.Fatalf("expect date %s, actual: %s", tt.date, report.Date)
+			}
+			if actual := summarize(report); actual != tt.expect {
+				t.Fatalf("expect:\n%s\nactual:\n%s", tt.expect, actual)
+			}
+		})
+	}
+}
+
+func TestBuildStandupItems(t *testing.T) {
+	report := BuildStandup(reportTasks(), day("2024-03-05"))
+	work := report.Groups[0]
+	// the last time done on the day
+	if work.Completed[0].Time != at("2024-03-05 15:00") {
+		t.Fatalf("expect completed at 15:00, actual: %v", work.Completed[0].Time)
+	}
+	note := work.Notes[0]
+	if note.Note != "drafted" || note.Time != at("2024-03-05 14:00") || strings.Join(note.Path, "/") != "Backlog" {
+		t.Fatalf("unexpected note: %+v", note)
+	}
+}
+
+func TestStatusAt(t *testing.T) {
+	history := reportTasks()[1]
+	legacy := reportTasks()[3]
+	tests := []struct {
+		name   string
+		task   *model.TaskItem
+		time   string
+		expect model.TaskStatus
+	}{
+		{name: "before created", task: history, time: "2024-03-01 08:00", expect: ""},
+		{name: "created", task: history, time: "2024-03-02 09:00", expect: model.TaskStatusCreated},
+		{name: "at a change", task: history, time: "2024-03-02 10:00", expect: model.TaskStatusCreated},
+		{name: "done", task: history, time: "2024-03-04 00:00", expect: model.TaskStatusDone},
+		{name: "reopened", task: history, time: "2024-03-06 00:00", expect: model.TaskStatusCreated},
+		{
+			name: "history starting later",
+			task: &model.TaskItem{Status: model.TaskStatusArchived, StatusHistory: []*model.StatusChange{
+				change(model.TaskStatusDone, model.TaskStatusArchived, "2024-03-05 10:00"),
+			}},
+			time:   "2024-03-04 00:00",
+			expect: model.TaskStatusDone,
+		},
+		{name: "no history before done", task: legacy, time: "2024-03-05 12:00", expect: model.TaskStatusCreated},
+		{name: "no history after done", task: legacy, time: "2024-03-05 12:01", expect: model.TaskStatusDone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := statusAt(tt.task, at(tt.time)); actual != tt.expect {
+				t.Fatalf("expect %q, actual: %q", tt.expect, actual)
+			}
+		})
+	}
+}
+
+func TestDoneAt(t *testing.T) {
+	tasks := reportTasks()
+	between := func(from string, to string) func(ts model.SwiftTimestamp) bool {
+		return func(ts model.SwiftTimestamp) bool { return ts >= at(from) && ts < at(to) }
+	}
+	tests := []struct {
+		name   string
+		task   *model.TaskItem
+		from   string
+		to     string
+		expect string
+	}{
+		{name: "done twice", task: tasks[0], from: "2024-03-05 00:00", to: "2024-03-06 00:00", expect: "2024-03-05 15:00"},
+		{name: "before reopened", task: tasks[0], from: "2024-03-05 00:00", to: "2024-03-05 11:00", expect: "2024-03-05 10:00"},
+		{name: "reopened", task: tasks[1], from: "2024-03-03 00:00", to: "2024-03-06 00:00"},
+		{name: "no history", task: tasks[3], from: "2024-03-05 00:00", to: "2024-03-06 00:00", expect: "2024-03-05 12:00"},
+		{name: "open", task: tasks[2], from: "2024-03-01 00:00", to: "2024-03-06 00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, ok := doneAt(tt.task, between(tt.from, tt.to))
+			if tt.expect == "" {
+				if ok {
+					t.Fatalf("expect not done, actual: %v", ts)
+				}
+				return
+			}
+			if !ok || ts != at(tt.expect) {
+				t.Fatalf("expect done at %s, actual: %v %v", tt.expect, ts, ok)
+			}
+		})
+	}
+}
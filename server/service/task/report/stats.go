@@ -0,0 +1,230 @@
+package report
+
+import (
+	"sort"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// Stats summarizes the tasks over a range of days, each list is a
+// series ready to chart
+type Stats struct {
+	// From and To are the first and last day, 2006-01-02
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Days has one point per day of the range
+	Days []*DayStats `json:"days"`
+	// CycleTime is from creation to done of the tasks completed in the range
+	CycleTime *CycleTime   `json:"cycleTime"`
+	Modes     []*ModeStats `json:"modes"`
+	// MostNoted are the tasks with the most notes added in the range
+	MostNoted []*TaskStats `json:"mostNoted"`
+	// OldestOpen are the tasks open the longest at the end of the range
+	OldestOpen []*TaskStats `json:"oldestOpen"`
+}
+
+type DayStats struct {
+	Date      string `json:"date"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+type CycleTime struct {
+	// Count is the number of tasks measured
+	Count int `json:"count"`
+	// MedianSeconds is 0 if no task is measured
+	MedianSeconds float64 `json:"medianSeconds"`
+}
+
+type ModeStats struct {
+	Mode      model.TaskMode `json:"mode"`
+	Created   int            `json:"created"`
+	Completed int            `json:"completed"`
+	// Open is the number of tasks open at the end of the range
+	Open int `json:"open"`
+}
+
+type TaskStats struct {
+	TaskID int64          `json:"taskID"`
+	Title  string         `json:"title"`
+	Path   []string       `json:"path"`
+	Mode   model.TaskMode `json:"mode"`
+	// CreatedAt is the time of the initial status, or the start time
+	CreatedAt model.SwiftTimestamp `json:"createdAt"`
+	// Notes is the number of all notes, NotesInRange of those added in the range
+	Notes        int `json:"notes"`
+	NotesInRange int `json:"notesInRange"`
+	// AgeSeconds is how long the task has been open at the end of the range
+	AgeSeconds float64 `json:"ageSeconds,omitempty"`
+}
+
+// BuildStats computes the stats of the days from start to the day
+// starting at last, both included, limit caps the task lists
+func BuildStats(tasks []*model.TaskItem, start time.Time, last time.Time, limit int) *Stats {
+	var dayStarts []time.Time
+	for d := start; !d.After(last); d = time.Date(d.Year(), d.Month(), d.Day()+1, 0, 0, 0, 0, d.Location()) {
+		dayStarts = append(dayStarts, d)
+	}
+	end := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, last.Location())
+	from, to := model.ToSwiftTimestamp(start), model.ToSwiftTimestamp(end)
+	inRange := func(ts model.SwiftTimestamp) bool {
+		return ts != 0 && ts >= from && ts < to
+	}
+	bounds := make([]model.SwiftTimestamp, len(dayStarts))
+	days := make([]*DayStats, len(dayStarts))
+	for i, d := range dayStarts {
+		bounds[i] = model.ToSwiftTimestamp(d)
+		days[i] = &DayStats{Date: d.Format("2006-01-02")}
+	}
+	dayOf := func(ts model.SwiftTimestamp) int {
+		return sort.Search(len(bounds), func(i int) bool { return bounds[i] > ts }) - 1
+	}
+	// age is measured up to now for a range not over yet
+	until := to
+	if now := model.ToSwiftTimestamp(time.Now()); now < until {
+		until = now
+	}
+
+	stats := &Stats{
+		From:       start.Format("2006-01-02"),
+		To:         last.Format("2006-01-02"),
+		Days:       days,
+		Modes:      []*ModeStats{},
+		MostNoted:  []*TaskStats{},
+		OldestOpen: []*TaskStats{},
+	}
+	modes := make(map[model.TaskMode]*ModeStats)
+	modeStats := func(mode model.TaskMode) *ModeStats {
+		if mode == "" {
+			mode = model.TaskModeShared
+		}
+		m, ok := modes[mode]
+		if !ok {
+			m = &ModeStats{Mode: mode}
+			modes[mode] = m
+		}
+		return m
+	}
+	var cycles []float64
+	var noted, open []*TaskStats
+
+	var walk func(tasks []*model.TaskItem, path []string)
+	walk = func(tasks []*model.TaskItem, path []string) {
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			created := createdAt(task)
+			if inRange(created) {
+				days[dayOf(created)].Created++
+				modeStats(task.Mode).Created++
+			}
+			completedDays := make(map[int]bool)
+			for _, ts := range doneTimes(task) {
+				if inRange(ts) {
+					completedDays[dayOf(ts)] = true
+				}
+			}
+			for i := range completedDays {
+				days[i].Completed++
+			}
+			if done, ok := doneAt(task, inRange); ok {
+				modeStats(task.Mode).Completed++
+				if created != 0 && done >= created {
+					cycles = append(cycles, float64(done-created))
+				}
+			}
+
+			item := &TaskStats{
+				TaskID:    task.ID,
+				Title:     task.Title,
+				Path:      path,
+				Mode:      task.Mode,
+				CreatedAt: created,
+				Notes:     len(task.Notes),
+			}
+			for i := range task.Notes {
+				if i < len(task.NoteTimes) && inRange(task.NoteTimes[i]) {
+					item.NotesInRange++
+				}
+			}
+			if item.NotesInRange > 0 {
+				noted = append(noted, item)
+			}
+			if created != 0 && created < to && isOpen(statusAt(task, to)) {
+				modeStats(task.Mode).Open++
+				openItem := *item
+				openItem.AgeSeconds = float64(until - created)
+				open = append(open, &openItem)
+			}
+			walk(task.SubTasks, append(path[:len(path):len(path)], task.Title))
+		}
+	}
+	walk(tasks, []string{})
+
+	stats.CycleTime = &CycleTime{Count: len(cycles), MedianSeconds: median(cycles)}
+	for _, mode := range modeOrder {
+		if m, ok := modes[mode]; ok {
+			stats.Modes = append(stats.Modes, m)
+			delete(modes, mode)
+		}
+	}
+	var others []*ModeStats
+	for _, m := range modes {
+		others = append(others, m)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Mode < others[j].Mode })
+	stats.Modes = append(stats.Modes, others...)
+
+	sort.SliceStable(noted, func(i, j int) bool {
+		if noted[i].NotesInRange != noted[j].NotesInRange {
+			return noted[i].NotesInRange > noted[j].NotesInRange
+		}
+		return noted[i].Notes > noted[j].Notes
+	})
+	sort.SliceStable(open, func(i, j int) bool {
+		return open[i].CreatedAt < open[j].CreatedAt
+	})
+	stats.MostNoted = append(stats.MostNoted, truncate(noted, limit)...)
+	stats.OldestOpen = append(stats.OldestOpen, truncate(open, limit)...)
+	return stats
+}
+
+// doneTimes lists when the task was marked done, its done time if
+// it has no history
+func doneTimes(task *model.TaskItem) []model.SwiftTimestamp {
+	if len(task.StatusHistory) == 0 {
+		if task.DoneTime == 0 {
+			return nil
+		}
+		return []model.SwiftTimestamp{task.DoneTime}
+	}
+	var times []model.SwiftTimestamp
+	for _, change := range task.StatusHistory {
+		if change != nil && change.To == model.TaskStatusDone && change.From != "" {
+			times = append(times, change.Time)
+		}
+	}
+	return times
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func truncate(list []*TaskStats, limit int) []*TaskStats {
+	if limit > 0 && len(list) > limit {
+		return list[:limit]
+	}
+	return list
+}
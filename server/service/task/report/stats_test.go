@@ -0,0 +1,136 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestBuildStats(t *testing.T) {
+	stats := BuildStats(reportTasks(), day("2024-03-01"), day("2024-03-05"), 2)
+	if stats.From != "2024-03-01" || stats.To != "2024-03-05" {
+		t.Fatalf("unexpected range: %s %s", stats.From, stats.To)
+	}
+
+	var days []string
+	for _, d := range stats.Days {
+		days = append(days, fmt.Sprintf("%s +%d -%d", d.Date[len("2024-03-"):], d.Created, d.Completed))
+	}
+	// Ship is done twice on the 5th, counted once
+	expectDays := []string{"01 +3 -0", "02 +1 -1", "03 +0 -0", "04 +1 -0", "05 +1 -2"}
+	if !slices.Equal(days, expectDays) {
+		t.Fatalf("expect days %v, actual: %v", expectDays, days)
+	}
+
+	// Review 25h, Ship 30h, Taxes 100h
+	if stats.CycleTime.Count != 3 || stats.CycleTime.MedianSeconds != 30*3600 {
+		t.Fatalf("unexpected cycle time: %+v", stats.CycleTime)
+	}
+
+	var modes []string
+	for _, m := range stats.Modes {
+		modes = append(modes, fmt.Sprintf("%s +%d -%d open:%d", m.Mode, m.Created, m.Completed, m.Open))
+	}
+	expectModes := []string{"work +4 -2 open:3", "life +1 -0 open:1", "shared +1 -1 open:0"}
+	if !slices.Equal(modes, expectModes) {
+		t.Fatalf("expect modes %v, actual: %v", expectModes, modes)
+	}
+
+	if len(stats.MostNoted) != 1 || stats.MostNoted[0].TaskID != 6 || stats.MostNoted[0].NotesInRange != 2 {
+		t.Fatalf("unexpected most noted: %s", toJSON(stats.MostNoted))
+	}
+	if strings.Join(stats.MostNoted[0].Path, "/") != "Backlog" {
+		t.Fatalf("expect path Backlog, actual: %v", stats.MostNoted[0].Path)
+	}
+
+	// Review, Backlog, Spec and Groceries are open, capped to 2
+	if len(stats.OldestOpen) != 2 || stats.OldestOpen[0].TaskID != 2 || stats.OldestOpen[1].TaskID != 5 {
+		t.Fatalf("unexpected oldest open: %s", toJSON(stats.OldestOpen))
+	}
+	if age := stats.OldestOpen[0].AgeSeconds; age != float64(at("2024-03-06 00:00")-at("2024-03-01 09:00")) {
+		t.Fatalf("expect age up to the end of the range, actual: %v", age)
+	}
+}
+
+func TestBuildStatsSingleDay(t *testing.T) {
+	stats := BuildStats(reportTasks(), day("2024-03-05"), day("2024-03-05"), 0)
+	if len(stats.Days) != 1 || stats.Days[0].Completed != 2 {
+		t.Fatalf("unexpected days: %s", toJSON(stats.Days))
+	}
+	// the median of Ship 30h and Taxes 100h
+	if stats.CycleTime.Count != 2 || stats.CycleTime.MedianSeconds != 65*3600 {
+		t.Fatalf("unexpected cycle time: %+v", stats.CycleTime)
+	}
+	if len(stats.OldestOpen) != 4 {
+		t.Fatalf("expect all open tasks without limit, actual: %s", toJSON(stats.OldestOpen))
+	}
+
+	empty := BuildStats(nil, day("2024-03-05"), day("2024-03-05"), 0)
+	if empty.CycleTime.Count != 0 || empty.CycleTime.MedianSeconds != 0 || empty.Modes == nil || empty.OldestOpen == nil {
+		t.Fatalf("unexpected empty stats: %s", toJSON(empty))
+	}
+}
+
+func TestDoneTimes(t *testing.T) {
+	tasks := reportTasks()
+	tests := []struct {
+		name   string
+		task   *model.TaskItem
+		expect []string
+	}{
+		{name: "done twice", task: tasks[0], expect: []string{"2024-03-05 10:00", "2024-03-05 15:00"}},
+		{name: "reopened", task: tasks[1], expect: []string{"2024-03-02 10:00"}},
+		{name: "no history", task: tasks[3], expect: []string{"2024-03-05 12:00"}},
+		{name: "never done", task: tasks[2]},
+		{
+			name: "created done",
+			task: &model.TaskItem{Status: model.TaskStatusDone, StatusHistory: []*model.StatusChange{
+				change("", model.TaskStatusDone, "2024-03-05 10:00"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expect []model.SwiftTimestamp
+			for _, s := range tt.expect {
+				expect = append(expect, at(s))
+			}
+			if actual := doneTimes(tt.task); !slices.Equal(actual, expect) {
+				t.Fatalf("expect %v, actual: %v", expect, actual)
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		expect float64
+	}{
+		{values: nil, expect: 0},
+		{values: []float64{3}, expect: 3},
+		{values: []float64{5, 1, 3}, expect: 3},
+		{values: []float64{4, 1}, expect: 2.5},
+		{values: []float64{4, 1, 3, 2}, expect: 2.5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.values), func(t *testing.T) {
+			values := slices.Clone(tt.values)
+			if actual := median(values); actual != tt.expect {
+				t.Fatalf("expect %v, actual: %v", tt.expect, actual)
+			}
+			if !slices.Equal(values, tt.values) {
+				t.Fatalf("expect values unsorted, actual: %v", values)
+			}
+		})
+	}
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
@@ -1,14 +1,45 @@
 package task
 
-import "github.com/xhd2015/task-banner/server/model"
+import (
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task/event"
+)
 
 type ITaskStorage interface {
-	SaveTasks(tasks []*model.TaskItem) error
+	// SaveTasks replaces all tasks, fails with *ConflictError if the store
+	// is not at expectedRevision, or a posted task is older than the stored one.
+	// nil expectedRevision skips the store check. A posted task with revision 0
+	// keeps the stored due time, priority, external ID and links it omits.
+	SaveTasks(tasks []*model.TaskItem, expectedRevision *int64) error
+	// Revision returns the revision of the whole store
+	Revision() (int64, error)
 	LoadTasks(mode model.TaskMode) ([]*model.TaskItem, error)
 	AddTask(task *model.TaskItem) (*model.TaskItem, error)
 	RemoveTask(taskId int64) error
 	UpdateTask(taskId int64, update *model.TaskUpdate) error
-	ExchangeOrder(taskID int64, exchangeTaskID int64) error
+	// ExchangeOrder fails with *ConflictError if taskID is not at
+	// expectedRevision, nil skips the check
+	ExchangeOrder(taskID int64, exchangeTaskID int64, expectedRevision *int64) error
+	MoveTask(taskID int64, parentID int64, index int) error
 	AddTaskNote(taskId int64, note string) error
 	UpdateTaskNote(taskId int64, noteIndex int, newText string) error
+	// CloneTask copies the subtree of a task with new IDs, returns the copy
+	CloneTask(taskID int64, opts *model.CloneOptions) (*model.TaskItem, error)
+	// MergeTasks moves the subtasks and notes of sourceID to the end of
+	// those of targetID, then removes sourceID, returns the merged target.
+	// The links of sourceID not on targetID are added, and its external ID
+	// kept if targetID has none. References by ID, such as `task #N` in
+	// later commits, are not redirected.
+	MergeTasks(sourceID int64, targetID int64) (*model.TaskItem, error)
+	// SplitTask turns notes and subtasks of a task into its siblings,
+	// returns the new siblings in order
+	SplitTask(taskID int64, opts *model.SplitOptions) ([]*model.TaskItem, error)
+	// Batch applies all operations atomically, returns one result per operation
+	Batch(ops []*model.BatchOperation) ([]*model.BatchResult, error)
+	// Sync applies operations queued by an offline client one by one,
+	// and returns the changes committed after cursor
+	Sync(cursor int64, ops []*model.BatchOperation) (*model.SyncResult, error)
+	// Subscribe subscribes to changes committed after lastEventID,
+	// the caller must close the subscription
+	Subscribe(lastEventID int64) *event.Subscription
 }
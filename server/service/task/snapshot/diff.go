@@ -0,0 +1,141 @@
+package snapshot
+
+import (
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// Change is a task added, removed or changed between two trees,
+// the tasks are copies without subtasks
+type Change struct {
+	TaskID int64  `json:"taskID"`
+	Title  string `json:"title"`
+	// Fields are the changed fields, position for a task moved among its siblings
+	Fields []string        `json:"fields,omitempty"`
+	Before *model.TaskItem `json:"before,omitempty"`
+	After  *model.TaskItem `json:"after,omitempty"`
+}
+
+type Diff struct {
+	Added   []*Change `json:"added"`
+	Removed []*Change `json:"removed"`
+	Changed []*Change `json:"changed"`
+}
+
+// Compare lists the differences from tasks before to tasks after,
+// in the tree order of after, removed tasks in the order of before
+func Compare(before []*model.TaskItem, after []*model.TaskItem) *Diff {
+	diff := &Diff{
+		Added:   []*Change{},
+		Removed: []*Change{},
+		Changed: []*Change{},
+	}
+	old := index(before)
+	cur := index(after)
+	oldPos := positions(before, cur)
+	curPos := positions(after, old)
+	seen := make(map[int64]bool)
+	walk(after, func(task *model.TaskItem) {
+		seen[task.ID] = true
+		prev, ok := old[task.ID]
+		if !ok {
+			diff.Added = append(diff.Added, &Change{TaskID: task.ID, Title: task.Title, After: shallow(task)})
+			return
+		}
+		fields := changedFields(prev, task)
+		if prev.ParentID == task.ParentID && oldPos[task.ID] != curPos[task.ID] {
+			fields = append(fields, "position")
+		}
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, &Change{
+				TaskID: task.ID,
+				Title:  task.Title,
+				Fields: fields,
+				Before: shallow(prev),
+				After:  shallow(task),
+			})
+		}
+	})
+	walk(before, func(task *model.TaskItem) {
+		if !seen[task.ID] {
+			diff.Removed = append(diff.Removed, &Change{TaskID: task.ID, Title: task.Title, Before: shallow(task)})
+		}
+	})
+	return diff
+}
+
+func index(tasks []*model.TaskItem) map[int64]*model.TaskItem {
+	m := make(map[int64]*model.TaskItem)
+	walk(tasks, func(task *model.TaskItem) {
+		m[task.ID] = task
+	})
+	return m
+}
+
+// positions numbers each task among its siblings also under the same
+// parent in other, so adding or removing a sibling moves no task
+func positions(tasks []*model.TaskItem, other map[int64]*model.TaskItem) map[int64]int {
+	m := make(map[int64]int)
+	var visit func(tasks []*model.TaskItem)
+	visit = func(tasks []*model.TaskItem) {
+		n := 0
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			if o, ok := other[task.ID]; ok && o.ParentID == task.ParentID {
+				m[task.ID] = n
+				n++
+			}
+			visit(task.SubTasks)
+		}
+	}
+	visit(tasks)
+	return m
+}
+
+// walk visits tasks in tree order
+func walk(tasks []*model.TaskItem, fn func(task *model.TaskItem)) {
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		fn(task)
+		return true
+	})
+}
+
+func changedFields(a *model.TaskItem, b *model.TaskItem) []string {
+	var fields []string
+	add := func(changed bool, name string) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	add(a.Title != b.Title, "title")
+	add(a.ParentID != b.ParentID, "parentID")
+	add(a.Mode != b.Mode, "mode")
+	add(a.Status != b.Status, "status")
+	add(a.StartTime != b.StartTime, "startTime")
+	add(a.DueTime != b.DueTime, "dueTime")
+	add(a.DoneTime != b.DoneTime, "doneTime")
+	add(a.Priority != b.Priority, "priority")
+	add(a.ExternalID != b.ExternalID, "externalID")
+	add(!sameNotes(a.Notes, b.Notes), "notes")
+	add(!model.SameLinks(a.Links, b.Links), "links")
+	return fields
+}
+
+func sameNotes(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func shallow(task *model.TaskItem) *model.TaskItem {
+	c := task.ShallowClone()
+	c.SubTasks = []*model.TaskItem{}
+	return c
+}
@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+// ErrTaskNotInSnapshot is returned when restoring a subtree missing in the snapshot
+var ErrTaskNotInSnapshot = fmt.Errorf("task not in snapshot")
+
+// Restore returns the tasks of a snapshot to save in place of current.
+//
+// With taskID 0 the whole snapshot is returned. Otherwise only the subtree
+// of taskID is taken from the snapshot: it replaces the subtree of the task
+// in current, or is put back under its old parent if the task was removed.
+// Tasks of the subtree found elsewhere in current are moved back.
+//
+// Tasks not in the snapshot's subtree keep their current parent, so those
+// added under a restored task since the snapshot follow it to its restored
+// place, after its restored subtasks. Nothing but the restored subtree
+// itself is removed.
+//
+// Restored tasks get the revisions of current, so saving bumps the revision
+// of those that differ and clears fields the snapshot has empty. Neither
+// current nor snapshot is modified.
+func Restore(current []*model.TaskItem, snapshot []*model.TaskItem, taskID int64) ([]*model.TaskItem, error) {
+	if taskID == 0 {
+		tasks := cloneTasks(snapshot)
+		matchRevisions(tasks, current)
+		return tasks, nil
+	}
+	snapshotPath := model.FindTaskPath(snapshot, taskID)
+	if len(snapshotPath) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrTaskNotInSnapshot, taskID)
+	}
+	root := snapshotPath[len(snapshotPath)-1].DeepClone()
+	matchRevisions([]*model.TaskItem{root}, current)
+	restored := make(map[int64]*model.TaskItem)
+	model.WalkTasks([]*model.TaskItem{root}, func(task *model.TaskItem, depth int) bool {
+		restored[task.ID] = task
+		return true
+	})
+
+	// kept maps a restored task to its current subtasks that are not restored
+	kept := make(map[int64][]*model.TaskItem)
+	var keptOrder []int64
+	replaced := false
+	var filter func(tasks []*model.TaskItem, parentID int64, underRestored bool) []*model.TaskItem
+	filter = func(tasks []*model.TaskItem, parentID int64, underRestored bool) []*model.TaskItem {
+		result := make([]*model.TaskItem, 0, len(tasks))
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			if restored[task.ID] == nil {
+				task.ParentID = parentID
+				task.SubTasks = filter(task.SubTasks, task.ID, underRestored)
+				result = append(result, task)
+				continue
+			}
+			// placing the root under a restored task would form a cycle,
+			// it goes to its old place then
+			if task.ID == taskID && !underRestored {
+				root.ParentID = parentID
+				result = append(result, root)
+				replaced = true
+			}
+			if subTasks := filter(task.SubTasks, task.ID, true); len(subTasks) > 0 {
+				kept[task.ID] = subTasks
+				keptOrder = append(keptOrder, task.ID)
+			}
+		}
+		return result
+	}
+	tasks := filter(cloneTasks(current), 0, false)
+	for _, id := range keptOrder {
+		task := restored[id]
+		task.SubTasks = append(task.SubTasks, kept[id]...)
+	}
+	if replaced {
+		return tasks, nil
+	}
+
+	// the task was removed, put it back at its old place
+	list := &tasks
+	root.ParentID = 0
+	if len(snapshotPath) > 1 {
+		parentID := snapshotPath[len(snapshotPath)-2].ID
+		parent := model.FindTask(tasks, parentID)
+		if parent != nil && model.FindTask([]*model.TaskItem{root}, parentID) == nil {
+			list = &parent.SubTasks
+			root.ParentID = parent.ID
+		}
+	}
+	index := siblingIndex(snapshot, snapshotPath)
+	if index > len(*list) {
+		index = len(*list)
+	}
+	*list = append((*list)[:index], append([]*model.TaskItem{root}, (*list)[index:]...)...)
+	return tasks, nil
+}
+
+// siblingIndex returns the index of the last task of path among its siblings
+func siblingIndex(tasks []*model.TaskItem, path []*model.TaskItem) int {
+	siblings := tasks
+	if len(path) > 1 {
+		siblings = path[len(path)-2].SubTasks
+	}
+	for i, task := range siblings {
+		if task == path[len(path)-1] {
+			return i
+		}
+	}
+	return 0
+}
+
+func cloneTasks(tasks []*model.TaskItem) []*model.TaskItem {
+	cloned := make([]*model.TaskItem, 0, len(tasks))
+	for _, task := range tasks {
+		if task != nil {
+			cloned = append(cloned, task.DeepClone())
+		}
+	}
+	return cloned
+}
+
+// matchRevisions sets the revisions of tasks to those in current,
+// 0 for tasks not in current
+func matchRevisions(tasks []*model.TaskItem, current []*model.TaskItem) {
+	revisions := make(map[int64]int64)
+	model.WalkTasks(current, func(task *model.TaskItem, depth int) bool {
+		revisions[task.ID] = task.Revision
+		return true
+	})
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		task.Revision = revisions[task.ID]
+		return true
+	})
+}
@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func task(id int64, subTasks ...*model.TaskItem) *model.TaskItem {
+	for _, sub := range subTasks {
+		sub.ParentID = id
+	}
+	return &model.TaskItem{ID: id, Title: fmt.Sprintf("task %d", id), Revision: 1, SubTasks: subTasks}
+}
+
+// shape renders a tree as `1(2,3(4))`, checking the parent ids on the way
+func shape(t *testing.T, tasks []*model.TaskItem, parentID int64) string {
+	var parts []string
+	for _, task := range tasks {
+		if task.ParentID != parentID {
+			t.Errorf("task %d: expect parent %d, actual: %d", task.ID, parentID, task.ParentID)
+		}
+		s := fmt.Sprint(task.ID)
+		if len(task.SubTasks) > 0 {
+			s += "(" + shape(t, task.SubTasks, task.ID) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  func() []*model.TaskItem
+		snapshot func() []*model.TaskItem
+		taskID   int64
+		expect   string
+	}{
+		{
+			name:     "whole snapshot",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(1), task(9)} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2))} },
+			expect:   "1(2)",
+		},
+		{
+			name:     "subtree replaced in place",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(5), task(1, task(3)), task(6)} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2), task(3))} },
+			taskID:   1,
+			expect:   "5,1(2,3),6",
+		},
+		{
+			name:     "added tasks stay under their parent",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2, task(7, task(8))), task(9))} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2))} },
+			taskID:   1,
+			expect:   "1(2(7(8)),9)",
+		},
+		{
+			name:     "moved task comes back with its added subtasks",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(1), task(5, task(2, task(3), task(7)))} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2, task(3))), task(5)} },
+			taskID:   1,
+			expect:   "1(2(3,7)),5",
+		},
+		{
+			name:     "removed task put back at its old place",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(4, task(6))} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(4, task(5), task(1, task(2)), task(6))} },
+			taskID:   1,
+			expect:   "4(6,1(2))",
+		},
+		{
+			name:     "task now nested in its own subtree",
+			current:  func() []*model.TaskItem { return []*model.TaskItem{task(2, task(7, task(1)))} },
+			snapshot: func() []*model.TaskItem { return []*model.TaskItem{task(1, task(2))} },
+			taskID:   1,
+			expect:   "1(2(7))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.current()
+			before := shape(t, current, 0)
+			restored, err := Restore(current, tt.snapshot(), tt.taskID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := shape(t, restored, 0); actual != tt.expect {
+				t.Fatalf("expect %s, actual: %s", tt.expect, actual)
+			}
+			if after := shape(t, current, 0); after != before {
+				t.Fatalf("current modified: %s -> %s", before, after)
+			}
+		})
+	}
+}
+
+func TestRestoreTaskNotInSnapshot(t *testing.T) {
+	_, err := Restore([]*model.TaskItem{task(1)}, []*model.TaskItem{task(2)}, 1)
+	if err == nil || !strings.Contains(err.Error(), ErrTaskNotInSnapshot.Error()) {
+		t.Fatalf("expect %v, actual: %v", ErrTaskNotInSnapshot, err)
+	}
+}
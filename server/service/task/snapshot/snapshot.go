@@ -0,0 +1,282 @@
+// Package snapshot keeps named point-in-time copies of the whole task
+// store as gzipped JSON files in a directory.
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot describes a stored snapshot, the tasks are only read on Load
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Revision of the store when taken
+	Revision  int64 `json:"revision"`
+	TaskCount int   `json:"taskCount"`
+	// Size of the compressed file in bytes
+	Size int64 `json:"size"`
+}
+
+// file is the content of a snapshot file before compression
+type file struct {
+	Name      string            `json:"name"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Revision  int64             `json:"revision"`
+	Tasks     []*model.TaskItem `json:"tasks"`
+}
+
+// Retention limits the snapshots kept, the newest snapshot is always kept
+type Retention struct {
+	// MaxCount is the number of snapshots kept, 0 for no limit
+	MaxCount int
+	// MaxAge removes snapshots older than it, 0 for no limit
+	MaxAge time.Duration
+}
+
+const ext = ".json.gz"
+
+// idRegex guards against paths passed as id
+var idRegex = regexp.MustCompile(`^\d{8}-\d{6}\.\d{3}(-\d+)?$`)
+
+type Store struct {
+	dir       string
+	retention Retention
+	mu        sync.Mutex
+}
+
+func NewStore(dir string, retention Retention) *Store {
+	return &Store{dir: dir, retention: retention}
+}
+
+// Create stores tasks as a new snapshot, then removes the snapshots
+// beyond the retention
+func (s *Store) Create(name string, tasks []*model.TaskItem, revision int64) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	created, err := s.addLocked(name, tasks, revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pruneLocked(created.CreatedAt, nil); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// Add stores tasks as a new snapshot like Create, but leaves the
+// retention to a later Prune
+func (s *Store) Add(name string, tasks []*model.TaskItem, revision int64) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addLocked(name, tasks, revision)
+}
+
+// Prune removes the snapshots beyond the retention, except those in keep
+func (s *Store) Prune(keep ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pruneLocked(time.Now().UTC(), keep)
+}
+
+func (s *Store) addLocked(name string, tasks []*model.TaskItem, revision int64) (*Snapshot, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	id := now.Format("20060102-150405.000")
+	for n := 1; ; n++ {
+		if _, err := os.Stat(s.path(id)); os.IsNotExist(err) {
+			break
+		}
+		id = now.Format("20060102-150405.000") + "-" + strconv.Itoa(n)
+	}
+	f := &file{
+		Name:      name,
+		CreatedAt: now,
+		Revision:  revision,
+		Tasks:     tasks,
+	}
+	size, err := writeFile(s.path(id), f)
+	if err != nil {
+		return nil, err
+	}
+	return f.describe(id, size), nil
+}
+
+// List returns all snapshots, newest first
+func (s *Store) List() ([]*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+// Load returns a snapshot with its tasks
+func (s *Store) Load(id string) (*Snapshot, []*model.TaskItem, error) {
+	if !idRegex.MatchString(id) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, size, err := readFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+		}
+		return nil, nil, err
+	}
+	return f.describe(id, size), f.Tasks, nil
+}
+
+// Delete removes a snapshot
+func (s *Store) Delete(id string) error {
+	if !idRegex.MatchString(id) {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return err
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+func (s *Store) listLocked() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Snapshot{}, nil
+		}
+		return nil, err
+	}
+	snapshots := []*Snapshot{}
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ext)
+		if entry.IsDir() || !idRegex.MatchString(id) || id+ext != entry.Name() {
+			continue
+		}
+		f, size, err := readFile(s.path(id))
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", id, err)
+		}
+		snapshots = append(snapshots, f.describe(id, size))
+	}
+	// ids sort by creation time
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID > snapshots[j].ID
+	})
+	return snapshots, nil
+}
+
+func (s *Store) pruneLocked(now time.Time, keep []string) error {
+	snapshots, err := s.listLocked()
+	if err != nil {
+		return err
+	}
+	for i, snapshot := range snapshots {
+		if i == 0 || slices.Contains(keep, snapshot.ID) {
+			continue
+		}
+		tooMany := s.retention.MaxCount > 0 && i >= s.retention.MaxCount
+		tooOld := s.retention.MaxAge > 0 && now.Sub(snapshot.CreatedAt) > s.retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(s.path(snapshot.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *file) describe(id string, size int64) *Snapshot {
+	count := 0
+	model.WalkTasks(c.Tasks, func(task *model.TaskItem, depth int) bool {
+		count++
+		return true
+	})
+	return &Snapshot{
+		ID:        id,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		Revision:  c.Revision,
+		TaskCount: count,
+		Size:      size,
+	}
+}
+
+// writeFile writes f compressed through a temporary file, so a
+// crash never leaves a truncated snapshot
+func writeFile(filename string, f *file) (int64, error) {
+	tmpFile := filename + ".tmp"
+	out, err := os.Create(tmpFile)
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(out)
+	err = json.NewEncoder(zw).Encode(f)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return 0, err
+	}
+	stat, err := os.Stat(tmpFile)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpFile, filename); err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func readFile(filename string) (*file, int64, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer zr.Close()
+	f := &file{}
+	if err := json.NewDecoder(zr).Decode(f); err != nil {
+		return nil, 0, err
+	}
+	if f.Tasks == nil {
+		f.Tasks = []*model.TaskItem{}
+	}
+	return f, stat.Size(), nil
+}
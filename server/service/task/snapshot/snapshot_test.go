@@ -0,0 +1,32 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestPruneKeep(t *testing.T) {
+	store := NewStore(t.TempDir(), Retention{MaxCount: 1})
+	first, err := store.Add("first", []*model.TaskItem{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("second", []*model.TaskItem{}, 2); err != nil {
+		t.Fatal(err)
+	}
+	third, err := store.Add("third", []*model.TaskItem{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Prune(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != third.ID || list[1].ID != first.ID {
+		t.Fatalf("expect %s and %s kept, actual: %v", third.ID, first.ID, list)
+	}
+}
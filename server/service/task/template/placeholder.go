@@ -0,0 +1,140 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var ErrMissingVariables = errors.New("missing template variables")
+
+// placeholderRegex matches {{name}}, spaces inside the braces are allowed
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// Variables lists the placeholders in the titles and notes of the tasks, sorted
+func Variables(tasks []*model.TaskItem) []string {
+	seen := make(map[string]bool)
+	collect := func(s string) {
+		for _, m := range placeholderRegex.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	}
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		collect(task.Title)
+		for _, note := range task.Notes {
+			collect(note)
+		}
+		return true
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instantiate returns new tasks from the template with the placeholders
+// replaced by vars, or the defaults of the template. The tasks have no IDs
+// and start at now with their status reset.
+func Instantiate(t *Template, vars map[string]string, now model.SwiftTimestamp) ([]*model.TaskItem, error) {
+	values := make(map[string]string, len(t.Defaults)+len(vars))
+	for k, v := range t.Defaults {
+		values[k] = v
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+	var missing []string
+	for _, name := range Variables(t.Tasks) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingVariables, strings.Join(missing, ", "))
+	}
+	expand := func(s string) string {
+		return placeholderRegex.ReplaceAllStringFunc(s, func(m string) string {
+			return values[placeholderRegex.FindStringSubmatch(m)[1]]
+		})
+	}
+	tasks := cloneTasks(t.Tasks)
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		reset(task)
+		task.Title = expand(task.Title)
+		for i, note := range task.Notes {
+			task.Notes[i] = expand(note)
+		}
+		task.StartTime = now
+		return true
+	})
+	return tasks, nil
+}
+
+// Capture copies tasks as the content of a template, replacing each key
+// of placeholders found in titles and notes by the {{variable}} it maps to,
+// e.g. {"v1.2.0": "version"}. Longer keys are replaced first.
+func Capture(tasks []*model.TaskItem, placeholders map[string]string) []*model.TaskItem {
+	literals := make([]string, 0, len(placeholders))
+	for literal := range placeholders {
+		if literal != "" {
+			literals = append(literals, literal)
+		}
+	}
+	sort.Slice(literals, func(i, j int) bool {
+		if len(literals[i]) != len(literals[j]) {
+			return len(literals[i]) > len(literals[j])
+		}
+		return literals[i] < literals[j]
+	})
+	pairs := make([]string, 0, 2*len(literals))
+	for _, literal := range literals {
+		pairs = append(pairs, literal, "{{"+placeholders[literal]+"}}")
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	captured := cloneTasks(tasks)
+	model.WalkTasks(captured, func(task *model.TaskItem, depth int) bool {
+		reset(task)
+		task.StartTime = 0
+		task.Title = replacer.Replace(task.Title)
+		for i, note := range task.Notes {
+			task.Notes[i] = replacer.Replace(note)
+		}
+		return true
+	})
+	return captured
+}
+
+// reset clears what belongs to a task in the store rather than to the
+// template: identity, progress and history
+func reset(task *model.TaskItem) {
+	task.ID = 0
+	task.ParentID = 0
+	task.Revision = 0
+	task.ExternalID = ""
+	task.DueTime = 0
+	task.DoneTime = 0
+	task.StatusHistory = nil
+	task.NoteTimes = nil
+	task.ChildCount = 0
+	task.DescendantCount = 0
+	if task.Status != "" {
+		task.Status = model.TaskStatusCreated
+	}
+}
+
+func cloneTasks(tasks []*model.TaskItem) []*model.TaskItem {
+	cloned := make([]*model.TaskItem, 0, len(tasks))
+	for _, task := range tasks {
+		if task != nil {
+			cloned = append(cloned, task.DeepClone())
+		}
+	}
+	return cloned
+}
@@ -0,0 +1,141 @@
+package template
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestInstantiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		note     string
+		defaults map[string]string
+		vars     map[string]string
+		expect   string
+		err      string
+	}{
+		{name: "no placeholders", title: "Release", expect: "Release"},
+		{name: "given", title: "Release {{version}}", vars: map[string]string{"version": "v1.2.0"}, expect: "Release v1.2.0"},
+		{name: "spaces", title: "Release {{ version }} to {{env\t}}", vars: map[string]string{"version": "v1", "env": "prod"}, expect: "Release v1 to prod"},
+		{name: "default", title: "Deploy {{env}}", defaults: map[string]string{"env": "staging"}, expect: "Deploy staging"},
+		{name: "given overrides default", title: "Deploy {{env}}", defaults: map[string]string{"env": "staging"}, vars: map[string]string{"env": "prod"}, expect: "Deploy prod"},
+		{name: "empty value", title: "Deploy{{suffix}}", vars: map[string]string{"suffix": ""}, expect: "Deploy"},
+		{name: "repeated", title: "{{v}} then {{ v }}", vars: map[string]string{"v": "x"}, expect: "x then x"},
+		{name: "not a placeholder", title: "{{1st}} {{a b}}", expect: "{{1st}} {{a b}}"},
+		{name: "missing", title: "Release {{version}} on {{date}}", err: "missing template variables: date, version"},
+		{name: "missing in note", title: "Release", note: "ask {{owner}}", defaults: map[string]string{"other": "x"}, err: "missing template variables: owner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &model.TaskItem{Title: tt.title}
+			if tt.note != "" {
+				task.Notes = []string{tt.note}
+			}
+			tmpl := &Template{Defaults: tt.defaults, Tasks: []*model.TaskItem{task}}
+			tasks, err := Instantiate(tmpl, tt.vars, 100)
+			if tt.err != "" {
+				if !errors.Is(err, ErrMissingVariables) || err.Error() != tt.err {
+					t.Fatalf("expect error %q, actual: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tasks) != 1 || tasks[0].Title != tt.expect {
+				t.Fatalf("expect %q, actual: %q", tt.expect, tasks[0].Title)
+			}
+			if task.Title != tt.title {
+				t.Fatalf("expect the template unchanged, actual: %q", task.Title)
+			}
+		})
+	}
+}
+
+func TestInstantiateReset(t *testing.T) {
+	tmpl := &Template{Tasks: []*model.TaskItem{
+		{
+			ID: 3, Title: "Release {{version}}", Status: model.TaskStatusDone, DoneTime: 50, Revision: 4,
+			Notes: []string{"tag {{version}}"}, NoteTimes: []model.SwiftTimestamp{40},
+			SubTasks: []*model.TaskItem{{ID: 4, ParentID: 3, Title: "Announce {{ version }}", Status: model.TaskStatusArchived}},
+		},
+		nil,
+	}}
+	tasks, err := Instantiate(tmpl, map[string]string{"version": "v2"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || len(tasks[0].SubTasks) != 1 {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+	root, sub := tasks[0], tasks[0].SubTasks[0]
+	if root.ID != 0 || root.Revision != 0 || root.DoneTime != 0 || root.NoteTimes != nil || root.StartTime != 100 || root.Status != model.TaskStatusCreated {
+		t.Fatalf("expect the task reset, actual: %+v", root)
+	}
+	if root.Notes[0] != "tag v2" || sub.Title != "Announce v2" || sub.ParentID != 0 || sub.StartTime != 100 || sub.Status != model.TaskStatusCreated {
+		t.Fatalf("unexpected subtask: %+v", sub)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name         string
+		title        string
+		placeholders map[string]string
+		expect       string
+	}{
+		{name: "none", title: "Release v1.2.0", expect: "Release v1.2.0"},
+		{name: "literal", title: "Release v1.2.0", placeholders: map[string]string{"v1.2.0": "version"}, expect: "Release {{version}}"},
+		{name: "every occurrence", title: "v1 and v1", placeholders: map[string]string{"v1": "v"}, expect: "{{v}} and {{v}}"},
+		{name: "longer first", title: "v1.2.0 after v1.2", placeholders: map[string]string{"v1.2": "minor", "v1.2.0": "version"}, expect: "{{version}} after {{minor}}"},
+		{name: "empty key ignored", title: "Release", placeholders: map[string]string{"": "nothing"}, expect: "Release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &model.TaskItem{ID: 1, Title: tt.title, StartTime: 100}
+			captured := Capture([]*model.TaskItem{task}, tt.placeholders)
+			if len(captured) != 1 || captured[0].Title != tt.expect {
+				t.Fatalf("expect %q, actual: %q", tt.expect, captured[0].Title)
+			}
+			if captured[0].ID != 0 || captured[0].StartTime != 0 {
+				t.Fatalf("expect identity cleared, actual: %+v", captured[0])
+			}
+			if task.Title != tt.title || task.ID != 1 {
+				t.Fatalf("expect the task unchanged, actual: %+v", task)
+			}
+		})
+	}
+}
+
+func TestCaptureRoundTrip(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{ID: 1, Title: "Release v1.2.0", Status: model.TaskStatusDone, Notes: []string{"deploy to prod"}, SubTasks: []*model.TaskItem{
+			{ID: 2, ParentID: 1, Title: "Tag v1.2.0 on prod", Status: model.TaskStatusCreated},
+		}},
+	}
+	captured := Capture(tasks, map[string]string{"v1.2.0": "version", "prod": "env"})
+	if vars := Variables(captured); !slices.Equal(vars, []string{"env", "version"}) {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+
+	tmpl := &Template{Defaults: map[string]string{"env": "prod"}, Tasks: captured}
+	same, err := Instantiate(tmpl, map[string]string{"version": "v1.2.0"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same[0].Title != "Release v1.2.0" || same[0].Notes[0] != "deploy to prod" || same[0].SubTasks[0].Title != "Tag v1.2.0 on prod" {
+		t.Fatalf("expect the original titles back, actual: %+v", same[0])
+	}
+
+	next, err := Instantiate(tmpl, map[string]string{"version": "v1.3.0", "env": "staging"}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := next[0].SubTasks[0].Title; title != "Tag v1.3.0 on staging" {
+		t.Fatalf("unexpected title: %q", title)
+	}
+}
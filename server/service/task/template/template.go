@@ -0,0 +1,167 @@
+// Package template keeps named task trees, such as release checklists,
+// to be instantiated repeatedly. Titles and notes may hold placeholders
+// like {{version}} filled when instantiating.
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+type Template struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Variables lists the placeholders used by the tasks, sorted
+	Variables []string `json:"variables"`
+	// Defaults are used for variables not given when instantiating
+	Defaults  map[string]string `json:"defaults,omitempty"`
+	Tasks     []*model.TaskItem `json:"tasks"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// file is the content of the templates file
+type file struct {
+	Templates []*Template `json:"templates"`
+}
+
+// Store keeps all templates in a single JSON file
+type Store struct {
+	filename string
+	mu       sync.Mutex
+}
+
+func NewStore(filename string) *Store {
+	return &Store{filename: filename}
+}
+
+// List returns the templates sorted by name
+func (s *Store) List() ([]*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(f.Templates, func(i, j int) bool {
+		return f.Templates[i].Name < f.Templates[j].Name
+	})
+	return f.Templates, nil
+}
+
+func (s *Store) Get(name string) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range f.Templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// Save adds the template, or replaces the one with the same name
+// if overwrite is set. Variables and times are filled.
+func (s *Store) Save(t *Template, overwrite bool) (*Template, error) {
+	name := strings.TrimSpace(t.Name)
+	if name == "" {
+		return nil, errors.New("requires template name")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	saved := *t
+	saved.Name = name
+	saved.Variables = Variables(saved.Tasks)
+	saved.UpdatedAt = time.Now().UTC()
+	saved.CreatedAt = saved.UpdatedAt
+	replaced := false
+	for i, existing := range f.Templates {
+		if existing.Name != name {
+			continue
+		}
+		if !overwrite {
+			return nil, fmt.Errorf("template already exists: %s", name)
+		}
+		saved.CreatedAt = existing.CreatedAt
+		f.Templates[i] = &saved
+		replaced = true
+		break
+	}
+	if !replaced {
+		f.Templates = append(f.Templates, &saved)
+	}
+	if err := s.write(f); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	for i, t := range f.Templates {
+		if t.Name == name {
+			f.Templates = append(f.Templates[:i], f.Templates[i+1:]...)
+			return s.write(f)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+func (s *Store) read() (*file, error) {
+	f := &file{Templates: []*Template{}}
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("read templates %s: %w", s.filename, err)
+	}
+	if f.Templates == nil {
+		f.Templates = []*Template{}
+	}
+	return f, nil
+}
+
+// write replaces the file through a temporary file, so a crash
+// leaves either the old or the new content
+func (s *Store) write(f *file) error {
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
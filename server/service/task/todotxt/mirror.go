@@ -0,0 +1,73 @@
+package todotxt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+// mirrorDelay batches changes arriving together into one write
+const mirrorDelay = 200 * time.Millisecond
+
+// Mirror keeps filename a todo.txt copy of all tasks in storage, it is
+// rewritten after every change until ctx is done. Edits to the file
+// itself are not read back.
+func Mirror(ctx context.Context, storage task.ITaskStorage, filename string) error {
+	for {
+		// subscribe before writing so no change is missed in between
+		sub := storage.Subscribe(0)
+		if err := writeMirror(storage, filename); err != nil {
+			sub.Close()
+			return err
+		}
+		err := func() error {
+			defer sub.Close()
+			var pending <-chan time.Time
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case _, ok := <-sub.C:
+					if !ok {
+						// dropped for lagging behind, subscribe again
+						return nil
+					}
+					if pending == nil {
+						pending = time.After(mirrorDelay)
+					}
+				case <-pending:
+					pending = nil
+					if err := writeMirror(storage, filename); err != nil {
+						return err
+					}
+				}
+			}
+		}()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeMirror(storage task.ITaskStorage, filename string) error {
+	tasks, err := storage.LoadTasks("")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tasks); err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(filename)
+	if err == nil && bytes.Equal(existing, buf.Bytes()) {
+		return nil
+	}
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
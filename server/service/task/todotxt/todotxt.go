@@ -0,0 +1,353 @@
+// Package todotxt converts task trees to and from the todo.txt format,
+// see https://github.com/todotxt/todo.txt.
+//
+// Every task is a line, subtasks follow their parent:
+//
+//	x 2026-09-02 2026-09-01 Tag the commit +Release_v2 @work id:3 parent:2
+//	(A) 2026-09-01 Release v2 @work id:2 due:2026-09-30
+//
+// Priority, creation(start) and completion dates are the standard fields.
+// The path of the parent is a +project, with spaces in titles replaced by `_`
+// and levels separated by `/`. The mode is a @context, other contexts are
+// part of the title. The extensions id and parent keep the hierarchy exact,
+// pri keeps the priority of done tasks, and status marks archived tasks.
+// Notes are not represented.
+package todotxt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+const dateFormat = "2006-01-02"
+
+const (
+	extID     = "id"
+	extParent = "parent"
+	extDue    = "due"
+	extPri    = "pri"
+	extStatus = "status"
+)
+
+var priorityRegex = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+// Render writes tasks and all their subtasks as todo.txt lines
+func Render(w io.Writer, tasks []*model.TaskItem) error {
+	bw := bufio.NewWriter(w)
+	var walk func(tasks []*model.TaskItem, path []string, parentID int64)
+	walk = func(tasks []*model.TaskItem, path []string, parentID int64) {
+		for _, task := range tasks {
+			if task == nil {
+				continue
+			}
+			bw.WriteString(FormatLine(task, path, parentID))
+			bw.WriteString("\n")
+			walk(task.SubTasks, append(path[:len(path):len(path)], projectName(task.Title)), task.ID)
+		}
+	}
+	walk(tasks, nil, 0)
+	return bw.Flush()
+}
+
+// FormatLine formats a task without its subtasks, path is the project
+// names of its ancestors from the top level
+func FormatLine(task *model.TaskItem, path []string, parentID int64) string {
+	var parts []string
+	done := task.Status == model.TaskStatusDone
+	if done {
+		parts = append(parts, "x")
+		doneTime := task.DoneTime
+		if doneTime == 0 {
+			doneTime = task.StartTime
+		}
+		if doneTime != 0 {
+			parts = append(parts, formatDate(doneTime))
+		}
+	} else if task.Priority != "" {
+		parts = append(parts, "("+task.Priority+")")
+	}
+	if task.StartTime != 0 {
+		parts = append(parts, formatDate(task.StartTime))
+	}
+	if title := strings.Join(strings.Fields(task.Title), " "); title != "" {
+		parts = append(parts, title)
+	}
+	if len(path) > 0 {
+		parts = append(parts, "+"+strings.Join(path, "/"))
+	}
+	if task.Mode != "" {
+		parts = append(parts, "@"+string(task.Mode))
+	}
+	if task.ID != 0 {
+		parts = append(parts, extID+":"+strconv.FormatInt(task.ID, 10))
+	}
+	if parentID != 0 {
+		parts = append(parts, extParent+":"+strconv.FormatInt(parentID, 10))
+	}
+	if task.DueTime != 0 {
+		parts = append(parts, extDue+":"+formatDate(task.DueTime))
+	}
+	if done && task.Priority != "" {
+		parts = append(parts, extPri+":"+task.Priority)
+	}
+	if task.Status == model.TaskStatusArchived {
+		parts = append(parts, extStatus+":"+string(task.Status))
+	}
+	return strings.Join(parts, " ")
+}
+
+func projectName(title string) string {
+	name := strings.Join(strings.Fields(title), "_")
+	name = strings.ReplaceAll(name, "/", "_")
+	return strings.TrimLeft(name, "+")
+}
+
+func formatDate(ts model.SwiftTimestamp) string {
+	return model.ConvertSwiftTimestamp(ts).Local().Format(dateFormat)
+}
+
+func parseDate(s string) (model.SwiftTimestamp, bool) {
+	t, err := time.ParseInLocation(dateFormat, s, time.Local)
+	if err != nil {
+		return 0, false
+	}
+	return model.ToSwiftTimestamp(t), true
+}
+
+// line is a parsed todo.txt line
+type line struct {
+	task     *model.TaskItem
+	id       int64
+	parentID int64
+	project  string
+
+	hasContext bool
+}
+
+// Parse reads todo.txt lines as a task tree. The hierarchy comes from the
+// id and parent extensions, or the +project path when there is no parent,
+// missing tasks on the path are created. Tasks without @context get mode,
+// and without creation date start now.
+func Parse(r io.Reader, mode model.TaskMode) ([]*model.TaskItem, error) {
+	var lines []*line
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		l, err := parseLine(text, mode)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		lines = append(lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return buildTree(lines), nil
+}
+
+func parseLine(text string, mode model.TaskMode) (*line, error) {
+	tokens := strings.Fields(text)
+	task := &model.TaskItem{
+		StartTime: model.ToSwiftTimestamp(time.Now()),
+		SubTasks:  []*model.TaskItem{},
+		Mode:      mode,
+		Status:    model.TaskStatusCreated,
+		Notes:     []string{},
+	}
+	l := &line{task: task}
+
+	if len(tokens) > 0 && tokens[0] == "x" {
+		task.Status = model.TaskStatusDone
+		tokens = tokens[1:]
+		if len(tokens) > 0 {
+			if ts, ok := parseDate(tokens[0]); ok {
+				task.DoneTime = ts
+				tokens = tokens[1:]
+			}
+		}
+	} else if len(tokens) > 0 {
+		if m := priorityRegex.FindStringSubmatch(tokens[0]); m != nil {
+			task.Priority = m[1]
+			tokens = tokens[1:]
+		}
+	}
+	if len(tokens) > 0 {
+		if ts, ok := parseDate(tokens[0]); ok {
+			task.StartTime = ts
+			tokens = tokens[1:]
+		}
+	}
+
+	// the last +project and mode @context are the ones written by Render,
+	// other tags, unknown extensions and values stay in the title
+	var title []string
+	for i := len(tokens) - 1; i >= 0; i-- {
+		ok, err := l.parseMeta(tokens[i])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			title = append(title, tokens[i])
+		}
+	}
+	for i, j := 0, len(title)-1; i < j; i, j = i+1, j-1 {
+		title[i], title[j] = title[j], title[i]
+	}
+	task.Title = strings.Join(title, " ")
+	if task.Status != model.TaskStatusDone {
+		task.DoneTime = 0
+	}
+	return l, nil
+}
+
+func (c *line) parseMeta(token string) (bool, error) {
+	task := c.task
+	if strings.HasPrefix(token, "+") && len(token) > 1 && c.project == "" {
+		c.project = token[1:]
+		return true, nil
+	}
+	if strings.HasPrefix(token, "@") && !c.hasContext {
+		switch m := model.TaskMode(token[1:]); m {
+		case model.TaskModeWork, model.TaskModeLife:
+			task.Mode = m
+		case model.TaskModeShared:
+			task.Mode = ""
+		default:
+			return false, nil
+		}
+		c.hasContext = true
+		return true, nil
+	}
+	key, value, ok := strings.Cut(token, ":")
+	if !ok || value == "" {
+		return false, nil
+	}
+	switch key {
+	case extID, extParent:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %s", key, value)
+		}
+		if key == extID {
+			c.id = id
+		} else {
+			c.parentID = id
+		}
+	case extDue:
+		ts, ok := parseDate(value)
+		if !ok {
+			return false, fmt.Errorf("invalid due: %s", value)
+		}
+		task.DueTime = ts
+	case extPri:
+		if len(value) != 1 || value[0] < 'A' || value[0] > 'Z' {
+			return false, nil
+		}
+		task.Priority = value
+	case extStatus:
+		switch status := model.TaskStatus(value); status {
+		case model.TaskStatusCreated, model.TaskStatusDone, model.TaskStatusArchived:
+			task.Status = status
+		default:
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func buildTree(lines []*line) []*model.TaskItem {
+	byID := make(map[int64]*line)
+	for _, l := range lines {
+		if l.id != 0 {
+			byID[l.id] = l
+		}
+	}
+	parentOf := func(l *line) *line {
+		if l.parentID == 0 {
+			return nil
+		}
+		return byID[l.parentID]
+	}
+
+	tasks := []*model.TaskItem{}
+	// projects maps a path to the task it names
+	projects := make(map[string]*model.TaskItem)
+	paths := make(map[*model.TaskItem]string)
+	addProject := func(t *model.TaskItem, parent *model.TaskItem) {
+		path := projectName(t.Title)
+		if parent != nil {
+			path = paths[parent] + "/" + path
+		}
+		paths[t] = path
+		if _, ok := projects[path]; !ok {
+			projects[path] = t
+		}
+	}
+	var projectTask func(path string) *model.TaskItem
+	projectTask = func(path string) *model.TaskItem {
+		if t, ok := projects[path]; ok {
+			return t
+		}
+		var parent *model.TaskItem
+		name := path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent = projectTask(path[:i])
+			name = path[i+1:]
+		}
+		t := &model.TaskItem{
+			Title:     strings.ReplaceAll(name, "_", " "),
+			StartTime: model.ToSwiftTimestamp(time.Now()),
+			SubTasks:  []*model.TaskItem{},
+			Status:    model.TaskStatusCreated,
+			Notes:     []string{},
+		}
+		if parent != nil {
+			t.Mode = parent.Mode
+			parent.SubTasks = append(parent.SubTasks, t)
+		} else {
+			tasks = append(tasks, t)
+		}
+		projects[path] = t
+		paths[t] = path
+		return t
+	}
+
+	for _, l := range lines {
+		parent := parentOf(l)
+		for p, n := parent, 0; p != nil && n <= len(lines); p, n = parentOf(p), n+1 {
+			if p == l {
+				parent = nil
+				break
+			}
+		}
+		var parentTask *model.TaskItem
+		if parent != nil {
+			parentTask = parent.task
+		} else if l.project != "" && l.parentID == 0 {
+			parentTask = projectTask(l.project)
+		}
+		if parentTask != nil {
+			parentTask.SubTasks = append(parentTask.SubTasks, l.task)
+		} else {
+			tasks = append(tasks, l.task)
+		}
+		// later lines may name this task by its path
+		addProject(l.task, parentTask)
+	}
+	return tasks
+}
@@ -0,0 +1,118 @@
+package todotxt
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func localDate(s string) model.SwiftTimestamp {
+	t, err := time.ParseInLocation(dateFormat, s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return model.ToSwiftTimestamp(t)
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+// clearIDs zeroes the ids, which Parse leaves zero
+func clearIDs(tasks []*model.TaskItem) []*model.TaskItem {
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		task.ID = 0
+		task.ParentID = 0
+		return true
+	})
+	return tasks
+}
+
+func TestRoundTrip(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{
+			ID:        2,
+			Title:     "Release v2",
+			StartTime: localDate("2026-09-01"),
+			DueTime:   localDate("2026-09-30"),
+			Mode:      model.TaskModeWork,
+			Status:    model.TaskStatusCreated,
+			Priority:  "A",
+			Notes:     []string{},
+			SubTasks: []*model.TaskItem{
+				{
+					ID:        3,
+					ParentID:  2,
+					Title:     "Tag the commit",
+					StartTime: localDate("2026-09-01"),
+					DoneTime:  localDate("2026-09-02"),
+					Mode:      model.TaskModeWork,
+					Status:    model.TaskStatusDone,
+					Priority:  "B",
+					Notes:     []string{},
+					SubTasks:  []*model.TaskItem{},
+				},
+			},
+		},
+		{
+			ID:        5,
+			Title:     "Old errand",
+			StartTime: localDate("2026-08-01"),
+			Mode:      model.TaskModeLife,
+			Status:    model.TaskStatusArchived,
+			Notes:     []string{},
+			SubTasks:  []*model.TaskItem{},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Render(&buf, tasks); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, expect := toJSON(parsed), toJSON(clearIDs(tasks)); actual != expect {
+		t.Fatalf("round trip changed the tasks, expect: %s\nactual: %s", expect, actual)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		title    string
+		mode     model.TaskMode
+		status   model.TaskStatus
+		priority string
+	}{
+		{line: "(B) 2026-09-01 Call mom @life", title: "Call mom", mode: model.TaskModeLife, status: model.TaskStatusCreated, priority: "B"},
+		{line: "Buy stamps @errands", title: "Buy stamps @errands", mode: model.TaskModeWork, status: model.TaskStatusCreated},
+		{line: "Buy stamps @errands @shared", title: "Buy stamps @errands", mode: "", status: model.TaskStatusCreated},
+		{line: "Review status:waiting", title: "Review status:waiting", mode: model.TaskModeWork, status: model.TaskStatusCreated},
+		{line: "Review status:archived pri:high", title: "Review pri:high", mode: model.TaskModeWork, status: model.TaskStatusArchived},
+		{line: "x 2026-09-02 Done thing", title: "Done thing", mode: model.TaskModeWork, status: model.TaskStatusDone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			l, err := parseLine(tt.line, model.TaskModeWork)
+			if err != nil {
+				t.Fatal(err)
+			}
+			task := l.task
+			if task.Title != tt.title || task.Mode != tt.mode || task.Status != tt.status || task.Priority != tt.priority {
+				t.Fatalf("expect %q %q %q %q, actual: %q %q %q %q", tt.title, tt.mode, tt.status, tt.priority, task.Title, task.Mode, task.Status, task.Priority)
+			}
+		})
+	}
+}
+
+func TestFormatLineWithoutStartTime(t *testing.T) {
+	line := FormatLine(&model.TaskItem{ID: 1, Title: "No date", Mode: model.TaskModeWork}, nil, 0)
+	if line != "No date @work id:1" {
+		t.Fatalf("unexpected line: %q", line)
+	}
+}
@@ -0,0 +1,147 @@
+// Package validate checks the integrity of a task tree before it is saved
+package validate
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+type ProblemKind string
+
+const (
+	ProblemNilTask        ProblemKind = "nil_task"
+	ProblemZeroID         ProblemKind = "zero_id"
+	ProblemDuplicateID    ProblemKind = "duplicate_id"
+	ProblemParentMismatch ProblemKind = "parent_mismatch"
+	ProblemUnknownStatus  ProblemKind = "unknown_status"
+	ProblemUnknownMode    ProblemKind = "unknown_mode"
+)
+
+type Problem struct {
+	Kind ProblemKind `json:"kind"`
+	// Path locates the task, e.g. tasks[0].subTasks[2]
+	Path    string `json:"path"`
+	TaskID  int64  `json:"taskID"`
+	Message string `json:"message"`
+	// Repaired is set when the problem was fixed by Repair
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+var validStatus = map[model.TaskStatus]bool{
+	"":                       true,
+	model.TaskStatusCreated:  true,
+	model.TaskStatusDone:     true,
+	model.TaskStatusArchived: true,
+}
+
+var validMode = map[model.TaskMode]bool{
+	"":                   true,
+	model.TaskModeShared: true,
+	model.TaskModeWork:   true,
+	model.TaskModeLife:   true,
+}
+
+// Validate reports all problems of the tree without modifying it
+func Validate(tasks []*model.TaskItem) []*Problem {
+	v := &validator{}
+	v.check(tasks)
+	return v.problems
+}
+
+// Repair fixes the tree in place and returns the problems fixed:
+// nil tasks are dropped, zero and duplicate IDs get fresh IDs,
+// ParentID follows the nesting, unknown status becomes created
+// and unknown mode is cleared, which makes the task shared.
+func Repair(tasks []*model.TaskItem) ([]*model.TaskItem, []*Problem) {
+	v := &validator{repair: true}
+	model.WalkTasks(tasks, func(task *model.TaskItem, depth int) bool {
+		if task.ID > v.maxID {
+			v.maxID = task.ID
+		}
+		return true
+	})
+	tasks = v.check(tasks)
+	return tasks, v.problems
+}
+
+type validator struct {
+	repair   bool
+	maxID    int64
+	seen     map[int64]string
+	problems []*Problem
+}
+
+func (v *validator) report(kind ProblemKind, path string, taskID int64, format string, args ...interface{}) {
+	v.problems = append(v.problems, &Problem{
+		Kind:     kind,
+		Path:     path,
+		TaskID:   taskID,
+		Message:  fmt.Sprintf(format, args...),
+		Repaired: v.repair,
+	})
+}
+
+func (v *validator) check(tasks []*model.TaskItem) []*model.TaskItem {
+	v.seen = make(map[int64]string)
+	return v.checkList(tasks, "tasks", 0)
+}
+
+func (v *validator) checkList(tasks []*model.TaskItem, path string, parentID int64) []*model.TaskItem {
+	result := tasks
+	if v.repair {
+		result = make([]*model.TaskItem, 0, len(tasks))
+	}
+	for i, task := range tasks {
+		taskPath := fmt.Sprintf("%s[%d]", path, i)
+		if task == nil {
+			v.report(ProblemNilTask, taskPath, 0, "task is null")
+			continue
+		}
+		v.checkTask(task, taskPath, parentID)
+		if v.repair {
+			result = append(result, task)
+		}
+	}
+	return result
+}
+
+func (v *validator) checkTask(task *model.TaskItem, path string, parentID int64) {
+	if task.ID == 0 {
+		v.report(ProblemZeroID, path, 0, "task %q has no id", task.Title)
+		if v.repair {
+			v.maxID++
+			task.ID = v.maxID
+		}
+	} else if prev, ok := v.seen[task.ID]; ok {
+		v.report(ProblemDuplicateID, path, task.ID, "id %d is already used by %s", task.ID, prev)
+		if v.repair {
+			v.maxID++
+			task.ID = v.maxID
+		}
+	}
+	v.seen[task.ID] = path
+
+	if task.ParentID != parentID {
+		v.report(ProblemParentMismatch, path, task.ID, "parentID is %d, but nested under %d", task.ParentID, parentID)
+		if v.repair {
+			task.ParentID = parentID
+		}
+	}
+	if !validStatus[task.Status] {
+		v.report(ProblemUnknownStatus, path, task.ID, "unknown status: %q", task.Status)
+		if v.repair {
+			task.Status = model.TaskStatusCreated
+		}
+	}
+	if !validMode[task.Mode] {
+		v.report(ProblemUnknownMode, path, task.ID, "unknown mode: %q", task.Mode)
+		if v.repair {
+			task.Mode = ""
+		}
+	}
+	subTasks := v.checkList(task.SubTasks, path+".subTasks", task.ID)
+	if v.repair {
+		task.SubTasks = subTasks
+	}
+}
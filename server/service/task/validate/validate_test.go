@@ -0,0 +1,135 @@
+package validate
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    []*model.TaskItem
+		problems []string
+	}{
+		{
+			name: "valid",
+			tasks: []*model.TaskItem{
+				{ID: 1, Status: model.TaskStatusCreated, Mode: model.TaskModeShared, SubTasks: []*model.TaskItem{
+					{ID: 2, ParentID: 1, Status: model.TaskStatusDone, Mode: model.TaskModeWork},
+				}},
+				{ID: 3},
+			},
+		},
+		{
+			name:     "nil task",
+			tasks:    []*model.TaskItem{{ID: 1}, nil},
+			problems: []string{"nil_task tasks[1]"},
+		},
+		{
+			name:     "zero id",
+			tasks:    []*model.TaskItem{{Title: "untitled"}},
+			problems: []string{"zero_id tasks[0]"},
+		},
+		{
+			name: "duplicate id",
+			tasks: []*model.TaskItem{
+				{ID: 1, SubTasks: []*model.TaskItem{{ID: 1, ParentID: 1}}},
+			},
+			problems: []string{"duplicate_id tasks[0].subTasks[0]"},
+		},
+		{
+			name: "parent mismatch",
+			tasks: []*model.TaskItem{
+				{ID: 1, ParentID: 5, SubTasks: []*model.TaskItem{{ID: 2, ParentID: 3}, {ID: 3}}},
+			},
+			problems: []string{
+				"parent_mismatch tasks[0]",
+				"parent_mismatch tasks[0].subTasks[0]",
+				"parent_mismatch tasks[0].subTasks[1]",
+			},
+		},
+		{
+			name:     "unknown status and mode",
+			tasks:    []*model.TaskItem{{ID: 1, Status: "doing", Mode: "home"}},
+			problems: []string{"unknown_status tasks[0]", "unknown_mode tasks[0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := toJSON(tt.tasks)
+			problems := Validate(tt.tasks)
+			if actual := problemKeys(problems); !slices.Equal(actual, tt.problems) {
+				t.Fatalf("expect %v, actual: %v", tt.problems, actual)
+			}
+			for _, p := range problems {
+				if p.Repaired {
+					t.Errorf("expect %s not repaired", p.Path)
+				}
+			}
+			if after := toJSON(tt.tasks); after != before {
+				t.Fatalf("expect tasks unchanged, actual: %s", after)
+			}
+		})
+	}
+}
+
+func TestRepair(t *testing.T) {
+	tasks := []*model.TaskItem{
+		{ID: 4, Status: "doing", SubTasks: []*model.TaskItem{
+			{ID: 4, ParentID: 4, Mode: "home"},
+			nil,
+			{ParentID: 9},
+		}},
+		{ID: 2, ParentID: 4},
+	}
+	repaired, problems := Repair(tasks)
+	expectProblems := []string{
+		"unknown_status tasks[0]",
+		"duplicate_id tasks[0].subTasks[0]",
+		"unknown_mode tasks[0].subTasks[0]",
+		"nil_task tasks[0].subTasks[1]",
+		"zero_id tasks[0].subTasks[2]",
+		"parent_mismatch tasks[0].subTasks[2]",
+		"parent_mismatch tasks[1]",
+	}
+	if actual := problemKeys(problems); !slices.Equal(actual, expectProblems) {
+		t.Fatalf("expect %v, actual: %v", expectProblems, actual)
+	}
+	for _, p := range problems {
+		if !p.Repaired {
+			t.Errorf("expect %s repaired", p.Path)
+		}
+	}
+
+	root := repaired[0]
+	if root.Status != model.TaskStatusCreated || len(root.SubTasks) != 2 {
+		t.Fatalf("unexpected root: %s", toJSON(root))
+	}
+	// fresh IDs continue from the largest one
+	dup, zero := root.SubTasks[0], root.SubTasks[1]
+	if dup.ID != 5 || dup.Mode != "" || zero.ID != 6 || zero.ParentID != 4 {
+		t.Fatalf("unexpected subtasks: %s", toJSON(root.SubTasks))
+	}
+	if repaired[1].ParentID != 0 {
+		t.Fatalf("expect top level parentID cleared, actual: %d", repaired[1].ParentID)
+	}
+	if problems := Validate(repaired); len(problems) != 0 {
+		t.Fatalf("expect repaired tasks valid, actual: %s", toJSON(problems))
+	}
+}
+
+func problemKeys(problems []*Problem) []string {
+	var keys []string
+	for _, p := range problems {
+		keys = append(keys, string(p.Kind)+" "+p.Path)
+	}
+	return keys
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
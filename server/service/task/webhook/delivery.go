@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed is set after the last attempt failed
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is a payload sent to a webhook, logged once finished
+type Delivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookID"`
+	URL       string `json:"url"`
+	Event     string `json:"event"`
+	// EventID is the id of the task event, 0 for a ping
+	EventID   int64          `json:"eventID,omitempty"`
+	Status    DeliveryStatus `json:"status"`
+	Attempts  []*Attempt     `json:"attempts"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type Attempt struct {
+	Time time.Time `json:"time"`
+	// StatusCode is the response status, 0 if no response
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// DeliveryLog appends finished deliveries to a JSON lines file,
+// keeping about the most recent maxEntries
+type DeliveryLog struct {
+	filename   string
+	maxEntries int
+	mu         sync.Mutex
+	// lines is the number of lines in the file, -1 if not counted yet
+	lines int
+}
+
+func NewDeliveryLog(filename string, maxEntries int) *DeliveryLog {
+	return &DeliveryLog{filename: filename, maxEntries: maxEntries, lines: -1}
+}
+
+// Append records a delivery, the file is compacted once it holds
+// twice the entries kept
+func (c *DeliveryLog) Append(d *Delivery) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(c.filename), 0755); err != nil {
+		return err
+	}
+	if c.lines < 0 {
+		entries, err := c.readLocked()
+		if err != nil {
+			return err
+		}
+		c.lines = len(entries)
+	}
+	f, err := os.OpenFile(c.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	c.lines++
+	if c.maxEntries > 0 && c.lines > 2*c.maxEntries {
+		return c.compactLocked()
+	}
+	return nil
+}
+
+// List returns the deliveries newest first, of one webhook if webhookID
+// is not empty, at most limit if limit > 0
+func (c *DeliveryLog) List(webhookID string, limit int) ([]*Delivery, error) {
+	c.mu.Lock()
+	entries, err := c.readLocked()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Delivery, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if webhookID != "" && entries[i].WebhookID != webhookID {
+			continue
+		}
+		result = append(result, entries[i])
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// readLocked reads all entries, a line that fails to parse,
+// such as one cut by a crash, is skipped
+func (c *DeliveryLog) readLocked() ([]*Delivery, error) {
+	data, err := os.ReadFile(c.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*Delivery
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		d := &Delivery{}
+		if err := json.Unmarshal(line, d); err != nil {
+			continue
+		}
+		entries = append(entries, d)
+	}
+	return entries, scanner.Err()
+}
+
+func (c *DeliveryLog) compactLocked() error {
+	entries, err := c.readLocked()
+	if err != nil {
+		return err
+	}
+	if len(entries) > c.maxEntries {
+		entries = entries[len(entries)-c.maxEntries:]
+	}
+	var buf bytes.Buffer
+	for _, d := range entries {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	tmp := c.filename + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.filename); err != nil {
+		return err
+	}
+	c.lines = len(entries)
+	return nil
+}
@@ -0,0 +1,336 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+	"github.com/xhd2015/task-banner/server/service/task"
+)
+
+// queueSize is the number of deliveries a webhook may have pending,
+// more are logged as failed right away
+const queueSize = 256
+
+type Options struct {
+	// Client sends the requests, a client with a 10s timeout if nil
+	Client *http.Client
+	// MaxAttempts is the number of tries of a delivery, 5 if 0
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled on each retry
+	// up to MaxBackoff, 2s and 5m if 0
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	// ID is the delivery id, the same for all attempts
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	WebhookID string    `json:"webhookID"`
+	Time      time.Time `json:"time"`
+	// Data is the task event, nil for a ping
+	Data *model.TaskEvent `json:"data,omitempty"`
+}
+
+// Dispatcher delivers task events to the webhooks of a store. Deliveries
+// of a webhook are sent one at a time in order, so a failing receiver
+// only delays its own deliveries. The webhook is read again before each
+// attempt, so updates apply to pending deliveries.
+type Dispatcher struct {
+	store *Store
+	log   *DeliveryLog
+	opts  Options
+
+	mu      sync.Mutex
+	workers map[string]*worker
+}
+
+// worker sends the deliveries of one webhook
+type worker struct {
+	queue  chan *job
+	cancel context.CancelFunc
+}
+
+type job struct {
+	webhookID string
+	event     string
+	data      *model.TaskEvent
+}
+
+func NewDispatcher(store *Store, deliveryLog *DeliveryLog, opts Options) *Dispatcher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 2 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	return &Dispatcher{
+		store:   store,
+		log:     deliveryLog,
+		opts:    opts,
+		workers: make(map[string]*worker),
+	}
+}
+
+// Run delivers the events committed to storage until ctx is done
+func (c *Dispatcher) Run(ctx context.Context, storage task.ITaskStorage) error {
+	var lastID int64
+	for {
+		sub := storage.Subscribe(lastID)
+		if sub.Missed {
+			log.Printf("webhook: events after %d are no longer kept, they are not delivered", lastID)
+		}
+		for _, ev := range sub.Replay {
+			c.Dispatch(ctx, ev)
+			lastID = ev.ID
+		}
+		err := func() error {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case ev, ok := <-sub.C:
+					if !ok {
+						// dropped for lagging behind, resume from the last event
+						return nil
+					}
+					c.Dispatch(ctx, ev)
+					lastID = ev.ID
+				}
+			}
+		}()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Dispatch queues the event for the webhooks subscribing to it
+func (c *Dispatcher) Dispatch(ctx context.Context, ev *model.TaskEvent) {
+	webhooks, err := c.store.List()
+	if err != nil {
+		log.Printf("webhook: list webhooks: %v", err)
+		return
+	}
+	event := EventName(ev)
+	for _, w := range webhooks {
+		if !w.Wants(event, ev) {
+			continue
+		}
+		c.enqueue(ctx, w, &job{webhookID: w.ID, event: event, data: ev})
+	}
+}
+
+func (c *Dispatcher) enqueue(ctx context.Context, w *Webhook, j *job) {
+	c.mu.Lock()
+	wk, ok := c.workers[j.webhookID]
+	if !ok {
+		workerCtx, cancel := context.WithCancel(ctx)
+		wk = &worker{queue: make(chan *job, queueSize), cancel: cancel}
+		c.workers[j.webhookID] = wk
+		go c.work(workerCtx, j.webhookID, wk)
+	}
+	c.mu.Unlock()
+	select {
+	case wk.queue <- j:
+	default:
+		d := c.newDelivery(j)
+		d.URL = w.URL
+		d.Status = DeliveryFailed
+		d.Attempts = append(d.Attempts, &Attempt{Time: time.Now(), Error: "too many pending deliveries"})
+		c.record(d)
+	}
+}
+
+func (c *Dispatcher) work(ctx context.Context, webhookID string, wk *worker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-wk.queue:
+			d, removed := c.deliver(ctx, j, c.opts.MaxAttempts)
+			if d != nil {
+				c.record(d)
+			}
+			if removed {
+				c.stop(webhookID, wk)
+				return
+			}
+		}
+	}
+}
+
+// Remove stops delivering to a deleted webhook, pending deliveries are dropped
+func (c *Dispatcher) Remove(webhookID string) {
+	c.stop(webhookID, nil)
+}
+
+// stop stops the worker of the webhook if it is wk, or any if wk is nil
+func (c *Dispatcher) stop(webhookID string, wk *worker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, ok := c.workers[webhookID]
+	if ok && (wk == nil || wk == current) {
+		delete(c.workers, webhookID)
+		current.cancel()
+	}
+	if wk != nil {
+		wk.cancel()
+	}
+}
+
+// Test sends a ping to the webhook once and logs the delivery
+func (c *Dispatcher) Test(ctx context.Context, webhookID string) (*Delivery, error) {
+	if _, err := c.store.Get(webhookID); err != nil {
+		return nil, err
+	}
+	d, _ := c.deliver(ctx, &job{webhookID: webhookID, event: EventPing}, 1)
+	if d == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, webhookID)
+	}
+	c.record(d)
+	return d, nil
+}
+
+func (c *Dispatcher) newDelivery(j *job) *Delivery {
+	d := &Delivery{
+		ID:        newID(),
+		WebhookID: j.webhookID,
+		Event:     j.event,
+		Attempts:  []*Attempt{},
+		CreatedAt: time.Now().UTC(),
+	}
+	if j.data != nil {
+		d.EventID = j.data.ID
+	}
+	return d
+}
+
+// deliver sends the job until it succeeds, fails permanently or
+// maxAttempts are made. The delivery is nil if nothing was sent as the
+// webhook no longer wants the event, removed tells the webhook is deleted.
+func (c *Dispatcher) deliver(ctx context.Context, j *job, maxAttempts int) (d *Delivery, removed bool) {
+	d = c.newDelivery(j)
+	d.Status = DeliveryFailed
+	backoff := c.opts.Backoff
+	for i := 0; i < maxAttempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return d, false
+			case <-timer.C:
+			}
+			backoff *= 2
+			if backoff > c.opts.MaxBackoff {
+				backoff = c.opts.MaxBackoff
+			}
+		}
+		w, err := c.store.Get(j.webhookID)
+		if err != nil {
+			removed = errors.Is(err, ErrWebhookNotFound)
+			if removed && len(d.Attempts) == 0 {
+				return nil, true
+			}
+			d.Attempts = append(d.Attempts, &Attempt{Time: time.Now().UTC(), Error: err.Error()})
+			return d, removed
+		}
+		if j.event != EventPing && !w.Wants(j.event, j.data) {
+			if len(d.Attempts) == 0 {
+				return nil, false
+			}
+			return d, false
+		}
+		d.URL = w.URL
+		body, err := c.payload(w, d, j)
+		if err != nil {
+			d.Attempts = append(d.Attempts, &Attempt{Time: time.Now().UTC(), Error: err.Error()})
+			return d, false
+		}
+		attempt, retry := c.send(ctx, w, d, body)
+		d.Attempts = append(d.Attempts, attempt)
+		if attempt.Error == "" {
+			d.Status = DeliveryDelivered
+			return d, false
+		}
+		if !retry {
+			return d, false
+		}
+	}
+	return d, false
+}
+
+// payload is the body of the delivery, the same for all attempts
+// unless the time format of the webhook changes
+func (c *Dispatcher) payload(w *Webhook, d *Delivery, j *job) ([]byte, error) {
+	format := w.TimeFormat
+	if format == "" {
+		format = model.TimeFormatRFC3339
+	}
+	return model.MarshalJSONTimes(&Payload{
+		ID:        d.ID,
+		Event:     j.event,
+		WebhookID: w.ID,
+		Time:      d.CreatedAt,
+		Data:      j.data,
+	}, format, time.UTC)
+}
+
+// send makes one attempt, retry tells whether a failure may be temporary
+func (c *Dispatcher) send(ctx context.Context, w *Webhook, d *Delivery, body []byte) (attempt *Attempt, retry bool) {
+	start := time.Now()
+	attempt = &Attempt{Time: start.UTC()}
+	defer func() {
+		attempt.DurationMs = time.Since(start).Milliseconds()
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-banner-webhook")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, body))
+	}
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, true
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return attempt, false
+	}
+	attempt.Error = fmt.Sprintf("unexpected status: %s", resp.Status)
+	// other client errors will not go away by retrying
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return attempt, retry
+}
+
+func (c *Dispatcher) record(d *Delivery) {
+	if err := c.log.Append(d); err != nil {
+		log.Printf("webhook: log delivery %s: %v", d.ID, err)
+	}
+}
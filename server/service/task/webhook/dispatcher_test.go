@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, *Store, *DeliveryLog) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "webhooks.json"))
+	deliveryLog := NewDeliveryLog(filepath.Join(dir, "webhooks.log.jsonl"), 100)
+	d := NewDispatcher(store, deliveryLog, Options{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+	})
+	return d, store, deliveryLog
+}
+
+func createWebhook(t *testing.T, store *Store, w *Webhook) *Webhook {
+	created, err := store.Create(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	var payload Payload
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified = Verify("s3cret", body, r.Header.Get(HeaderSignature))
+		json.Unmarshal(body, &payload)
+		if r.Header.Get(HeaderEvent) != EventAdded || r.Header.Get(HeaderDelivery) != payload.ID {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	d, store, _ := newTestDispatcher(t)
+	w := createWebhook(t, store, &Webhook{URL: server.URL, Secret: "s3cret"})
+	ev := &model.TaskEvent{ID: 7, Type: model.TaskEventAdded, TaskID: 1}
+	delivery, removed := d.deliver(context.Background(), &job{webhookID: w.ID, event: EventAdded, data: ev}, 3)
+	if removed || delivery == nil || delivery.Status != DeliveryDelivered {
+		t.Fatalf("expect delivered, actual: %s", toJSON(delivery))
+	}
+	if !verified {
+		t.Fatal("expect the signature to verify")
+	}
+	if payload.WebhookID != w.ID || payload.Data == nil || payload.Data.ID != 7 || delivery.EventID != 7 {
+		t.Fatalf("unexpected payload: %s", toJSON(payload))
+	}
+}
+
+func TestDeliverRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		status   DeliveryStatus
+	}{
+		{name: "retried until delivered", statuses: []int{503, 500, 200}, attempts: 3, status: DeliveryDelivered},
+		{name: "rate limited", statuses: []int{429, 204}, attempts: 2, status: DeliveryDelivered},
+		{name: "client error not retried", statuses: []int{404, 200}, attempts: 1, status: DeliveryFailed},
+		{name: "gives up", statuses: []int{500, 500, 500, 200}, attempts: 3, status: DeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := atomic.AddInt32(&n, 1) - 1
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer server.Close()
+
+			d, store, _ := newTestDispatcher(t)
+			w := createWebhook(t, store, &Webhook{URL: server.URL})
+			delivery, _ := d.deliver(context.Background(), &job{webhookID: w.ID, event: EventAdded, data: &model.TaskEvent{}}, 3)
+			if len(delivery.Attempts) != tt.attempts || delivery.Status != tt.status {
+				t.Fatalf("expect %d attempts %s, actual: %s", tt.attempts, tt.status, toJSON(delivery))
+			}
+			for i, attempt := range delivery.Attempts {
+				if attempt.StatusCode != tt.statuses[i] {
+					t.Errorf("attempt %d: expect status %d, actual: %d", i, tt.statuses[i], attempt.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAppliesToPending(t *testing.T) {
+	moved := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer moved.Close()
+
+	d, store, _ := newTestDispatcher(t)
+	var w *Webhook
+	old := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		updated := *w
+		updated.URL = moved.URL
+		if _, err := store.Update(&updated); err != nil {
+			t.Error(err)
+		}
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer old.Close()
+	w = createWebhook(t, store, &Webhook{URL: old.URL})
+
+	delivery, _ := d.deliver(context.Background(), &job{webhookID: w.ID, event: EventAdded, data: &model.TaskEvent{}}, 3)
+	if delivery.Status != DeliveryDelivered || len(delivery.Attempts) != 2 || delivery.URL != moved.URL {
+		t.Fatalf("expect the retry sent to the updated url, actual: %s", toJSON(delivery))
+	}
+}
+
+func TestDispatchLogsDeliveries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	d, store, deliveryLog := newTestDispatcher(t)
+	wanted := createWebhook(t, store, &Webhook{URL: server.URL, Events: []string{EventRemoved}})
+	createWebhook(t, store, &Webhook{URL: server.URL, Events: []string{EventAdded}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Dispatch(ctx, &model.TaskEvent{ID: 3, Type: model.TaskEventRemoved, TaskID: 1})
+
+	var deliveries []*Delivery
+	waitFor(t, "the delivery logged", func() bool {
+		var err error
+		deliveries, err = deliveryLog.List("", 0)
+		return err == nil && len(deliveries) > 0
+	})
+	if len(deliveries) != 1 || deliveries[0].WebhookID != wanted.ID || deliveries[0].EventID != 3 || deliveries[0].Status != DeliveryDelivered {
+		t.Fatalf("unexpected deliveries: %s", toJSON(deliveries))
+	}
+}
+
+func TestDeletedWebhookStopsWorker(t *testing.T) {
+	var n int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+	}))
+	defer server.Close()
+
+	d, store, deliveryLog := newTestDispatcher(t)
+	w := createWebhook(t, store, &Webhook{URL: server.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	workers := func() int {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.workers)
+	}
+
+	// queued before the webhook was deleted
+	if err := store.Delete(w.ID); err != nil {
+		t.Fatal(err)
+	}
+	d.enqueue(ctx, w, &job{webhookID: w.ID, event: EventAdded, data: &model.TaskEvent{}})
+	waitFor(t, "the worker to stop", func() bool { return workers() == 0 })
+	if atomic.LoadInt32(&n) != 0 {
+		t.Fatal("expect nothing sent to a deleted webhook")
+	}
+	if deliveries, _ := deliveryLog.List("", 0); len(deliveries) != 0 {
+		t.Fatalf("expect nothing logged, actual: %s", toJSON(deliveries))
+	}
+
+	w = createWebhook(t, store, &Webhook{URL: server.URL})
+	d.enqueue(ctx, w, &job{webhookID: w.ID, event: EventAdded, data: &model.TaskEvent{}})
+	if workers() != 1 {
+		t.Fatalf("expect a worker, actual: %d", workers())
+	}
+	d.Remove(w.ID)
+	if workers() != 0 {
+		t.Fatalf("expect the worker removed, actual: %d", workers())
+	}
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
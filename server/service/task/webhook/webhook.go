@@ -0,0 +1,278 @@
+// Package webhook POSTs signed JSON payloads to configured URLs when
+// tasks change, retrying failed deliveries with backoff and recording
+// every delivery in a log.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/task-banner/server/model"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Event names of the payloads, the task events of the same name, and
+// task.status_changed for a task.updated changing the status
+const (
+	EventAdded         = string(model.TaskEventAdded)
+	EventUpdated       = string(model.TaskEventUpdated)
+	EventStatusChanged = "task.status_changed"
+	EventRemoved       = string(model.TaskEventRemoved)
+	EventReordered     = string(model.TaskEventReordered)
+	EventMoved         = string(model.TaskEventMoved)
+	EventNote          = string(model.TaskEventNote)
+	EventReplaced      = string(model.TaskEventReplaced)
+	// EventPing is only sent by a test fire
+	EventPing = "ping"
+)
+
+var knownEvents = map[string]bool{
+	EventAdded:         true,
+	EventUpdated:       true,
+	EventStatusChanged: true,
+	EventRemoved:       true,
+	EventReordered:     true,
+	EventMoved:         true,
+	EventNote:          true,
+	EventReplaced:      true,
+}
+
+// Headers of a delivery
+const (
+	HeaderEvent     = "X-Task-Banner-Event"
+	HeaderDelivery  = "X-Task-Banner-Delivery"
+	HeaderSignature = "X-Task-Banner-Signature"
+)
+
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the payloads, see Sign, no signature if empty
+	Secret string `json:"secret,omitempty"`
+	// Events are the event names delivered, all but ping if empty.
+	// task.updated includes task.status_changed.
+	Events []string `json:"events,omitempty"`
+	// Mode only delivers events of tasks visible in the mode, all if empty
+	Mode model.TaskMode `json:"mode,omitempty"`
+	// TimeFormat of the times in the payload, rfc3339 if empty
+	TimeFormat model.TimeFormat `json:"timeFormat,omitempty"`
+	Disabled   bool             `json:"disabled,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// Wants reports whether the webhook subscribes to the event
+func (c *Webhook) Wants(event string, ev *model.TaskEvent) bool {
+	if c.Disabled {
+		return false
+	}
+	if ev != nil && !ev.MatchMode(c.Mode) {
+		return false
+	}
+	if len(c.Events) == 0 {
+		return event != EventPing
+	}
+	for _, e := range c.Events {
+		if e == event || (e == EventUpdated && event == EventStatusChanged) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventName is the name a task event is delivered as
+func EventName(ev *model.TaskEvent) string {
+	if ev.Type == model.TaskEventUpdated && ev.PreviousStatus != nil {
+		return EventStatusChanged
+	}
+	return string(ev.Type)
+}
+
+// Sign returns the signature header of body, the hex HMAC-SHA256
+// with the secret, prefixed by sha256=
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header made by Sign, for receivers
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func validate(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %q, expect http(s)://host/path", w.URL)
+	}
+	for _, e := range w.Events {
+		if !knownEvents[e] {
+			return fmt.Errorf("unknown event: %s", e)
+		}
+	}
+	if w.TimeFormat != "" {
+		if _, err := model.ParseTimeFormat(string(w.TimeFormat)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// file is the content of the webhooks file
+type file struct {
+	Webhooks []*Webhook `json:"webhooks"`
+}
+
+// Store keeps the webhooks in a JSON file
+type Store struct {
+	filename string
+	mu       sync.Mutex
+}
+
+func NewStore(filename string) *Store {
+	return &Store{filename: filename}
+}
+
+// List returns the webhooks oldest first
+func (s *Store) List() ([]*Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return f.Webhooks, nil
+}
+
+func (s *Store) Get(id string) (*Webhook, error) {
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range list {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+}
+
+// Create adds a webhook with a new ID
+func (s *Store) Create(w *Webhook) (*Webhook, error) {
+	if err := validate(w); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	created := *w
+	created.ID = newID()
+	created.CreatedAt = time.Now().UTC()
+	f.Webhooks = append(f.Webhooks, &created)
+	if err := s.write(f); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Update replaces the webhook with the same ID, keeping its creation time
+func (s *Store) Update(w *Webhook) (*Webhook, error) {
+	if err := validate(w); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	for i, existing := range f.Webhooks {
+		if existing.ID == w.ID {
+			updated := *w
+			updated.CreatedAt = existing.CreatedAt
+			f.Webhooks[i] = &updated
+			if err := s.write(f); err != nil {
+				return nil, err
+			}
+			return &updated, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, w.ID)
+}
+
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.read()
+	if err != nil {
+		return err
+	}
+	for i, w := range f.Webhooks {
+		if w.ID == id {
+			f.Webhooks = append(f.Webhooks[:i], f.Webhooks[i+1:]...)
+			return s.write(f)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+}
+
+func (s *Store) read() (*file, error) {
+	f := &file{Webhooks: []*Webhook{}}
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("read webhooks %s: %w", s.filename, err)
+	}
+	if f.Webhooks == nil {
+		f.Webhooks = []*Webhook{}
+	}
+	sort.SliceStable(f.Webhooks, func(i, j int) bool {
+		return f.Webhooks[i].CreatedAt.Before(f.Webhooks[j].CreatedAt)
+	})
+	return f, nil
+}
+
+// write replaces the file through a temporary file, the file
+// holds secrets so it is only readable by the owner
+func (s *Store) write(f *file) error {
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
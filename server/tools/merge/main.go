@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/task-banner/server/crdt"
+	"github.com/xhd2015/task-banner/server/service/task/local_impl"
+)
+
+const help = `
+merge combines two task files edited independently on different devices.
+
+Usage: merge --base BASE.json [OPTIONS] <A.json> <B.json>
+
+The result does not depend on the order of A and B. Concurrent edits to the
+same field are resolved by task revision, moves that would form a cycle are
+dropped, notes added on both sides are all kept, and a task removed on one
+side but edited on the other is kept.
+
+Options:
+  --base FILE   required, the common ancestor of A and B, e.g. the file
+                as last synced. Without it removals and edits cannot be
+                told from additions.
+  --out FILE    write the merged tasks to FILE instead of stdout, both
+                in the format of the tasks file
+  --help        show help message
+`
+
+func main() {
+	err := handle(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handle(args []string) error {
+	var baseFile string
+	var outFile string
+	var remainArgs []string
+	n := len(args)
+	for i := 0; i < n; i++ {
+		if args[i] == "--base" || args[i] == "--out" {
+			if i+1 >= n {
+				return fmt.Errorf("%v requires arg", args[i])
+			}
+			if args[i] == "--base" {
+				baseFile = args[i+1]
+			} else {
+				outFile = args[i+1]
+			}
+			i++
+			continue
+		}
+		if args[i] == "--help" {
+			fmt.Println(strings.TrimSpace(help))
+			return nil
+		}
+		if args[i] == "--" {
+			remainArgs = append(remainArgs, args[i+1:]...)
+			break
+		}
+		if strings.HasPrefix(args[i], "-") {
+			return fmt.Errorf("unrecognized flag: %v", args[i])
+		}
+		remainArgs = append(remainArgs, args[i])
+	}
+	if len(remainArgs) != 2 {
+		return fmt.Errorf("requires two task files, see --help")
+	}
+	if baseFile == "" {
+		return fmt.Errorf("requires --base, see --help")
+	}
+	fileA, fileB := remainArgs[0], remainArgs[1]
+
+	baseTasks, _, err := local_impl.ReadTasksFile(baseFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", baseFile, err)
+	}
+	tasksA, revisionA, err := local_impl.ReadTasksFile(fileA)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", fileA, err)
+	}
+	tasksB, revisionB, err := local_impl.ReadTasksFile(fileB)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", fileB, err)
+	}
+
+	replicaA, replicaB := replicaName(fileA), replicaName(fileB)
+	if replicaA == replicaB {
+		replicaA, replicaB = fileA, fileB
+	}
+	merged := crdt.Merge(
+		crdt.FromTasks(baseTasks, tasksA, replicaA),
+		crdt.FromTasks(baseTasks, tasksB, replicaB),
+	)
+	tasks := merged.Tasks()
+
+	revision := revisionA
+	if revisionB > revision {
+		revision = revisionB
+	}
+	revision++
+	// times stay Swift timestamps until either side migrated them
+	format, err := local_impl.ReadTasksFileTimeFormat(fileA)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", fileA, err)
+	}
+	if formatB, err := local_impl.ReadTasksFileTimeFormat(fileB); err != nil {
+		return fmt.Errorf("failed to read %s: %v", fileB, err)
+	} else if formatB != "" {
+		format = formatB
+	}
+	if outFile != "" {
+		return local_impl.WriteTasksFile(outFile, tasks, revision, format)
+	}
+	data, err := local_impl.MarshalTasksFile(tasks, revision, format)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+func replicaName(file string) string {
+	name := filepath.Base(file)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}